@@ -0,0 +1,534 @@
+package main
+
+import (
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cbrnrd/pasted/pkg/auth"
+	"github.com/cbrnrd/pasted/pkg/backends"
+	"github.com/cbrnrd/pasted/pkg/metrics"
+	"github.com/cbrnrd/pasted/pkg/transforms"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/httprate"
+	"gopkg.in/yaml.v3"
+)
+
+// apiPrefix is the path under which the JSON API is mounted.
+const apiPrefix = "/api/v1"
+
+//go:embed openapi.yaml
+var openAPIYAML []byte
+
+// apiRoutes registers the JSON API.
+func (s *webServer) apiRoutes(router chi.Router) {
+	router.Use(httprate.Limit(10, 1*time.Minute,
+		httprate.WithKeyByIP(),
+		httprate.WithLimitHandler(s.rateLimited(func(w http.ResponseWriter, r *http.Request) {
+			writeAPIError(w, http.StatusTooManyRequests, "rate_limited", "Too many requests")
+		})),
+	))
+
+	router.Use(s.authenticate(writeAPIAuthError))
+
+	router.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusNotFound, "not_found", "No such endpoint")
+	})
+	router.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusMethodNotAllowed, "invalid_request", "Method not allowed")
+	})
+
+	router.Get("/openapi.json", s.handleOpenAPI)
+	router.Post("/pastes", s.handleAPICreate)
+	router.Get("/pastes", s.handleAPIList)
+	router.Delete("/pastes/{id}", s.handleAPIDelete)
+	router.Patch("/pastes/{id}", s.handleAPIUpdate)
+	router.With(s.requireScope(auth.ScopeRead, writeAPIAuthError)).Get("/pastes/{id}", s.handleAPIGet)
+	router.With(s.requireScope(auth.ScopeRead, writeAPIAuthError)).Get("/pastes/{id}/content", s.handleAPIContent)
+	router.With(s.requireScope(auth.ScopeRead, writeAPIAuthError)).Post("/pastes/{id}/report", s.handleAPIReport)
+	router.Get("/usage", s.handleAPIUsage)
+	router.Get("/pow", s.handleAPIChallenge)
+	router.Route("/moderation", s.apiModerationRoutes)
+}
+
+// apiPaste is the JSON representation of a paste.
+type apiPaste struct {
+	ID          string     `json:"id"`
+	URL         string     `json:"url"`
+	RawURL      string     `json:"raw_url"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	Namespace   string     `json:"namespace,omitempty"`
+	ContentType string     `json:"content_type"`
+	Language    string     `json:"language,omitempty"`
+	Flags       []string   `json:"flags,omitempty"`
+
+	BurnAfterRead     bool `json:"burn_after_read,omitempty"`
+	PasswordProtected bool `json:"password_protected,omitempty"`
+
+	// Hidden is set on pastes hidden by a moderator, which are only listed.
+	Hidden bool `json:"hidden,omitempty"`
+
+	// Owner is only set in lists, which only the owner, namespace members
+	// and admins can see.
+	Owner string `json:"owner,omitempty"`
+
+	// DeleteToken is only set in the response to a create request.
+	DeleteToken string `json:"delete_token,omitempty"`
+}
+
+func (s *webServer) apiPaste(key string, meta *backends.Metadata) *apiPaste {
+	return &apiPaste{
+		ID:          key,
+		URL:         pasteURL(s.cfg, meta.Namespace, key),
+		RawURL:      s.cfg.Domain + pastePrefix(meta.Namespace) + "raw/" + key,
+		CreatedAt:   meta.CreatedAt,
+		ExpiresAt:   meta.ExpiresAt,
+		Namespace:   meta.Namespace,
+		ContentType: meta.ContentType,
+		Language:    meta.Language,
+		Flags:       meta.Flags,
+
+		BurnAfterRead:     meta.BurnAfterRead,
+		PasswordProtected: meta.PasswordHash != "",
+		Hidden:            meta.Hidden,
+	}
+}
+
+// apiCreateRequest is the JSON body of a create request.
+type apiCreateRequest struct {
+	Content       *string         `json:"content"`
+	Language      string          `json:"language"`
+	ExpiresIn     json.RawMessage `json:"expires_in"`
+	BurnAfterRead bool            `json:"burn_after_read"`
+	Password      string          `json:"password"`
+	Namespace     string          `json:"namespace"`
+}
+
+// handleAPICreate stores the request body, or the content of a JSON request, as a new paste.
+func (s *webServer) handleAPICreate(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	isJSON := mediaType == "application/json"
+
+	body := r.Body
+	if limit := s.cfg.SizeLimitBytes; limit > 0 {
+		if isJSON {
+			// JSON escaping can grow the content, so the backend enforces the exact limit.
+			limit = 6*limit + 4096
+		}
+		body = http.MaxBytesReader(w, body, limit)
+	}
+
+	var input io.Reader = body
+	query := r.URL.Query()
+	language := query.Get("language")
+	expiresIn := query.Get("expires_in")
+	namespace := query.Get("namespace")
+	burnAfterRead, _ := strconv.ParseBool(query.Get("burn_after_read"))
+	var password string
+
+	if isJSON {
+		var req apiCreateRequest
+		if err := json.NewDecoder(body).Decode(&req); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeAPIError(w, http.StatusRequestEntityTooLarge, "too_large", "Paste is too large")
+				return
+			}
+			writeAPIError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body: "+err.Error())
+			return
+		}
+		if req.Content == nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid_request", "content is required")
+			return
+		}
+		input = strings.NewReader(*req.Content)
+		language = req.Language
+		burnAfterRead = req.BurnAfterRead
+		password = req.Password
+		if req.Namespace != "" {
+			namespace = req.Namespace
+		}
+		if len(req.ExpiresIn) > 0 {
+			var str string
+			if json.Unmarshal(req.ExpiresIn, &str) != nil {
+				str = string(req.ExpiresIn)
+			}
+			expiresIn = str
+		}
+	}
+
+	// The body of a raw upload has not been read yet, so it is only read once
+	// the client is authorized.
+	key := requestKey(r)
+	err := authorizeUpload(s.cfg, s.keys, s.mod, key, clientIP(r), namespace)
+	if err == nil {
+		err = checkProofOfWork(s.work, key, r.Header.Get(proofOfWorkHeader))
+	}
+	if err != nil {
+		countUploadRejection(err)
+		writeStoreError(w, err)
+		return
+	}
+
+	expiresAt, err := expiryTime(s.cfg, namespace, expiresIn)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_request", "Invalid expires_in: "+err.Error())
+		return
+	}
+
+	deleteToken, deleteTokenHash, err := newDeleteToken()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "backend_error", "Could not generate a delete token")
+		return
+	}
+	meta := &backends.Metadata{
+		Language:        language,
+		ExpiresAt:       expiresAt,
+		DeleteTokenHash: deleteTokenHash,
+		BurnAfterRead:   burnAfterRead,
+		Namespace:       namespace,
+		SourceIP:        clientIP(r),
+	}
+	if password != "" {
+		if meta.PasswordHash, err = hashPassword(password); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid_request", "Invalid password: "+err.Error())
+			return
+		}
+	}
+
+	pasteKey, err := storePaste(input, s.cfg, s.backend, s.chain, s.quotas, key, meta)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	stored, err := s.backend.Stat(pasteKey)
+	if err != nil {
+		stored = meta
+	}
+	resp := s.apiPaste(pasteKey, stored)
+	resp.DeleteToken = deleteToken
+
+	w.Header().Set("Location", apiPrefix+"/pastes/"+pasteKey)
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// handleAPIGet returns the metadata of a paste.
+func (s *webServer) handleAPIGet(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "id")
+	meta, err := s.statPaste(key)
+	if err == nil && meta.Hidden {
+		err = errHidden
+	}
+	if err != nil {
+		writeAPILoadError(w, key, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.apiPaste(key, meta))
+}
+
+// handleAPIContent returns the content of a paste, as /raw/{key} does. The
+// password of a protected paste is sent with HTTP basic authentication.
+func (s *webServer) handleAPIContent(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "id")
+	body, meta, err := s.loadPaste(key)
+	if err != nil {
+		writeAPILoadError(w, key, err)
+		return
+	}
+	if meta.PasswordHash != "" {
+		if _, password, ok := r.BasicAuth(); !ok || !passwordMatches(meta, password) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="pasted", charset="UTF-8"`)
+			writeAPIError(w, http.StatusUnauthorized, "unauthorized", "The paste's password is required")
+			return
+		}
+	}
+	if err := s.claim(r, key, meta); err != nil {
+		writeAPILoadError(w, key, err)
+		return
+	}
+	s.writeRaw(w, r, key, body, meta)
+	metrics.PastesServed.Add(1)
+}
+
+// handleAPIDelete deletes a paste given its delete token, or a key that can
+// manage it.
+func (s *webServer) handleAPIDelete(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "id")
+	meta, err := s.statPaste(key)
+	if err != nil {
+		writeAPILoadError(w, key, err)
+		return
+	}
+
+	token := r.Header.Get("X-Delete-Token")
+	apiKey := requestKey(r)
+	switch {
+	case token != "" && meta.DeleteTokenHash != "" &&
+		subtle.ConstantTimeCompare([]byte(auth.HashToken(token)), []byte(meta.DeleteTokenHash)) == 1:
+	case s.canManage(apiKey, meta):
+	case token == "" && apiKey == nil:
+		writeAPIError(w, http.StatusUnauthorized, "unauthorized", "A delete token or API key is required")
+		return
+	default:
+		writeAPIError(w, http.StatusForbidden, "forbidden", "Not allowed to delete this paste")
+		return
+	}
+
+	if err := s.deletePaste(key, meta); err != nil {
+		writeAPILoadError(w, key, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiUpdateRequest is the JSON body of an update request.
+type apiUpdateRequest struct {
+	ExpiresIn json.RawMessage `json:"expires_in"`
+}
+
+// handleAPIUpdate extends, or shortens, the lifetime of a paste. The new
+// expiry counts from now and follows the rules of the paste's namespace.
+func (s *webServer) handleAPIUpdate(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "id")
+	meta, err := s.statPaste(key)
+	if err != nil {
+		writeAPILoadError(w, key, err)
+		return
+	}
+
+	apiKey := requestKey(r)
+	switch {
+	case apiKey == nil:
+		writeAPIAuthError(w, http.StatusUnauthorized, "An API key is required")
+		return
+	case !s.canManage(apiKey, meta):
+		writeAPIError(w, http.StatusForbidden, "forbidden", "Not allowed to change this paste")
+		return
+	}
+
+	var req apiUpdateRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body: "+err.Error())
+		return
+	}
+	if len(req.ExpiresIn) == 0 {
+		writeAPIError(w, http.StatusBadRequest, "invalid_request", "expires_in is required")
+		return
+	}
+	var expiresIn string
+	if json.Unmarshal(req.ExpiresIn, &expiresIn) != nil {
+		expiresIn = string(req.ExpiresIn)
+	}
+	if meta.ExpiresAt, err = expiryTime(s.cfg, meta.Namespace, expiresIn); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_request", "Invalid expires_in: "+err.Error())
+		return
+	}
+
+	if err := s.backend.Update(key, meta); err != nil {
+		writeAPILoadError(w, key, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.apiPaste(key, meta))
+}
+
+// canManage reports whether key can delete or extend a paste: it is an admin
+// key, a key of the paste's owner or of a member of the paste's namespace.
+func (s *webServer) canManage(key *auth.Key, meta *backends.Metadata) bool {
+	switch {
+	case key == nil:
+		return false
+	case key.Has(auth.ScopeAdmin):
+		return true
+	case meta.Owner != "" && meta.Owner == key.OwnerName():
+		return true
+	case meta.Namespace != "":
+		ns := s.cfg.Namespace(meta.Namespace)
+		return ns != nil && ns.IsMember(key)
+	default:
+		return false
+	}
+}
+
+// handleAPIList lists the pastes of the owner of the request's API key.
+// Admin keys can list another owner's pastes with ?owner=. Members of a
+// namespace can list its pastes with ?namespace=, and narrow them to an
+// owner's with ?owner=.
+func (s *webServer) handleAPIList(w http.ResponseWriter, r *http.Request) {
+	key := requestKey(r)
+	switch {
+	case key == nil:
+		writeAPIAuthError(w, http.StatusUnauthorized, "An API key is required")
+		return
+	case !key.Has(auth.ScopeRead):
+		writeAPIAuthError(w, http.StatusForbidden, "The API key does not allow read access")
+		return
+	}
+	query := r.URL.Query()
+	filter := backends.Filter{Owner: key.OwnerName()}
+	if other := query.Get("owner"); other != "" && key.Has(auth.ScopeAdmin) {
+		filter.Owner = other
+	}
+	if namespace := query.Get("namespace"); namespace != "" {
+		ns := s.cfg.Namespace(namespace)
+		switch {
+		case ns == nil:
+			writeAPIError(w, http.StatusNotFound, "not_found", "No such namespace")
+			return
+		case !ns.IsMember(key):
+			writeAPIError(w, http.StatusForbidden, "forbidden", "Only members can list the namespace's pastes")
+			return
+		}
+		filter = backends.Filter{Owner: query.Get("owner"), Namespace: namespace}
+	}
+
+	pastes, err := s.listPastes(filter)
+	if err != nil {
+		writeAPILoadError(w, "", err)
+		return
+	}
+
+	list := make([]*apiPaste, 0, len(pastes))
+	for _, p := range pastes {
+		paste := s.apiPaste(p.key, p.meta)
+		paste.Owner = p.meta.Owner
+		list = append(list, paste)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"pastes": list})
+}
+
+// handleAPIUsage returns the storage used by each owner, each anonymous
+// client address and the whole server, with the configured quotas.
+func (s *webServer) handleAPIUsage(w http.ResponseWriter, r *http.Request) {
+	key := requestKey(r)
+	switch {
+	case key == nil:
+		writeAPIAuthError(w, http.StatusUnauthorized, "An API key is required")
+		return
+	case !key.Has(auth.ScopeAdmin):
+		writeAPIAuthError(w, http.StatusForbidden, "The API key does not allow admin access")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.quotas.Report())
+}
+
+// proofOfWorkHeader carries the proof of work of anonymous uploads: the
+// challenge token, a colon and the solution.
+const proofOfWorkHeader = "X-Proof-Of-Work"
+
+// apiChallenge is the JSON representation of a proof of work challenge.
+type apiChallenge struct {
+	Challenge  string    `json:"challenge"`
+	Difficulty int       `json:"difficulty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// handleAPIChallenge issues a proof of work challenge for an anonymous upload.
+func (s *webServer) handleAPIChallenge(w http.ResponseWriter, r *http.Request) {
+	if s.work == nil {
+		writeAPIError(w, http.StatusNotFound, "not_found", "Uploads do not need a proof of work")
+		return
+	}
+	c := s.work.Issue()
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, &apiChallenge{Challenge: c.Token, Difficulty: c.Bits, ExpiresAt: c.ExpiresAt})
+}
+
+// handleOpenAPI serves the OpenAPI document as JSON.
+func (s *webServer) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	var doc any
+	if err := yaml.Unmarshal(openAPIYAML, &doc); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "backend_error", "Invalid OpenAPI document")
+		return
+	}
+	writeJSON(w, http.StatusOK, doc)
+}
+
+// statPaste returns the metadata of an unexpired paste.
+func (s *webServer) statPaste(key string) (*backends.Metadata, error) {
+	if !validKey.MatchString(key) {
+		return nil, backends.ErrNotFound
+	}
+	meta, err := s.backend.Stat(key)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Expired(time.Now()) {
+		return nil, backends.ErrNotFound
+	}
+	return meta, nil
+}
+
+// apiError is the JSON body of every API error response.
+type apiError struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	var e apiError
+	e.Error.Code, e.Error.Message = code, message
+	writeJSON(w, status, e)
+}
+
+// writeAPIAuthError reports an authentication failure on an API route.
+func writeAPIAuthError(w http.ResponseWriter, status int, message string) {
+	code := "unauthorized"
+	if status == http.StatusForbidden {
+		code = "forbidden"
+	}
+	writeAPIError(w, status, code, message)
+}
+
+// writeAPILoadError maps errors from reading a paste to API errors and counts them.
+func writeAPILoadError(w http.ResponseWriter, key string, err error) {
+	switch {
+	case errors.Is(err, backends.ErrNotFound):
+		writeAPIError(w, http.StatusNotFound, "not_found", "Paste not found")
+	case errors.Is(err, errHidden):
+		writeAPIError(w, http.StatusGone, "removed", "Paste was removed by a moderator")
+	case errors.Is(err, transforms.ErrIntegrity):
+		metrics.IntegrityFailures.Add(1)
+		log.Printf("paste %s failed integrity check", key)
+		writeAPIError(w, http.StatusInternalServerError, "integrity_error", "Paste failed integrity check")
+	case errors.Is(err, errTransform):
+		metrics.TransformErrors.Add(1)
+		writeAPIError(w, http.StatusInternalServerError, "transform_error", "Error retrieving paste")
+	default:
+		metrics.BackendErrors.Add(1)
+		log.Printf("backend error for paste %s: %v", key, err)
+		writeAPIError(w, http.StatusInternalServerError, "backend_error", "Error retrieving paste")
+	}
+}
+
+// writeStoreError maps errors from storePaste to API errors. storePaste has already counted them.
+func writeStoreError(w http.ResponseWriter, err error) {
+	status, code, message := storeErrorStatus(err)
+	writeAPIError(w, status, code, message)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", "application/json")
+	h.Set("Content-Length", strconv.Itoa(len(data)+1))
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(append(data, '\n'))
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/cbrnrd/pasted/pkg/config"
+	"github.com/go-chi/chi/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// TestOpenAPIMatchesRoutes checks that the API routes and the operations in
+// openapi.yaml are the same, so the document cannot drift from the handlers.
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	var doc struct {
+		Paths map[string]map[string]yaml.Node `yaml:"paths"`
+	}
+	if err := yaml.Unmarshal(openAPIYAML, &doc); err != nil {
+		t.Fatalf("openapi.yaml: %v", err)
+	}
+	documented := map[string]bool{}
+	for path, item := range doc.Paths {
+		for method := range item {
+			if method != "parameters" {
+				documented[strings.ToUpper(method)+" "+path] = true
+			}
+		}
+	}
+
+	s := &webServer{cfg: &config.CLIConfig{}}
+	registered := map[string]bool{}
+	err := chi.Walk(s.routes(nil), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if strings.HasPrefix(route, apiPrefix+"/") {
+			registered[method+" "+strings.TrimSuffix(route, "/")] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for op := range registered {
+		if !documented[op] {
+			t.Errorf("openapi.yaml does not document %s", op)
+		}
+	}
+	for op := range documented {
+		if !registered[op] {
+			t.Errorf("openapi.yaml documents %s, which has no handler", op)
+		}
+	}
+}
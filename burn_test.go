@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cbrnrd/pasted/pkg/backends"
+	"github.com/cbrnrd/pasted/pkg/config"
+	"github.com/cbrnrd/pasted/pkg/quota"
+	"github.com/cbrnrd/pasted/pkg/transforms"
+	"github.com/go-chi/chi/v5"
+)
+
+// newBurnServer returns a router serving raw pastes from a memory backend
+// that holds one burn-after-read paste, and the paste's key.
+func newBurnServer(t *testing.T, content string) (http.Handler, backends.Backend, string) {
+	t.Helper()
+	backend := backends.NewMemoryBackend()
+	quotas := quota.NewTracker(quota.Limits{})
+	key, err := backend.Put(strings.NewReader(content), &backends.Metadata{BurnAfterRead: true, ContentType: "text/plain; charset=utf-8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &webServer{backend: backend, cfg: &config.CLIConfig{}, chain: transforms.NewChainTransformer(), quotas: quotas}
+	router := chi.NewRouter()
+	router.Get("/raw/{key}", s.handleRaw)
+	router.Head("/raw/{key}", s.handleRaw)
+	router.Get("/api/v1/pastes/{id}/content", s.handleAPIContent)
+	return router, backend, key
+}
+
+func TestBurnAfterReadConcurrent(t *testing.T) {
+	const content = "read me once"
+	router, backend, key := newBurnServer(t, content)
+
+	const readers = 20
+	var (
+		wg    sync.WaitGroup
+		start = make(chan struct{})
+		codes = make(chan int, readers)
+		mu    sync.Mutex
+		got   []string
+	)
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/raw/"+key, nil))
+			codes <- w.Code
+			if w.Code == http.StatusOK {
+				mu.Lock()
+				got = append(got, w.Body.String())
+				mu.Unlock()
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(codes)
+
+	for code := range codes {
+		if code != http.StatusOK && code != http.StatusNotFound {
+			t.Errorf("unexpected status %d", code)
+		}
+	}
+	if len(got) != 1 || got[0] != content {
+		t.Fatalf("paste served %d times: %q", len(got), got)
+	}
+	if _, err := backend.Stat(key); err != backends.ErrNotFound {
+		t.Fatalf("paste not deleted: Stat() error = %v", err)
+	}
+}
+
+func TestBurnAfterReadIgnoresRange(t *testing.T) {
+	const content = "read me once, all of me"
+	for _, target := range []string{"/raw/", "/api/v1/pastes/"} {
+		router, backend, key := newBurnServer(t, content)
+		url := target + key
+		if target == "/api/v1/pastes/" {
+			url += "/content"
+		}
+
+		r := httptest.NewRequest(http.MethodGet, url, nil)
+		r.Header.Set("Range", "bytes=0-3")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || w.Body.String() != content {
+			t.Errorf("%s with Range: status %d, body %q; want the whole paste", target, w.Code, w.Body.String())
+		}
+		if _, err := backend.Stat(key); err != backends.ErrNotFound {
+			t.Errorf("%s: paste not deleted: Stat() error = %v", target, err)
+		}
+	}
+}
+
+func TestBurnAfterReadHead(t *testing.T) {
+	router, backend, key := newBurnServer(t, "still here")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/raw/"+key, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("HEAD: status %d", w.Code)
+	}
+	if _, err := backend.Stat(key); err != nil {
+		t.Fatalf("HEAD deleted the paste: Stat() error = %v", err)
+	}
+}
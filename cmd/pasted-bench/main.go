@@ -0,0 +1,296 @@
+// Command pasted-bench compares the compression transformers on sample data,
+// reporting ratio and throughput so a default can be picked for a dataset.
+//
+// Samples are split into paste-sized chunks before being compressed, since
+// that is how the transformers see data in production.
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cbrnrd/pasted/pkg/transforms"
+	"github.com/klauspost/compress/dict"
+	"github.com/urfave/cli/v3"
+)
+
+type sample struct {
+	name   string
+	chunks [][]byte
+}
+
+type candidate struct {
+	name string
+	t    transforms.Transformer
+}
+
+func main() {
+	cmd := &cli.Command{
+		Name:  "pasted-bench",
+		Usage: "Compare compression transformers on log and code samples",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:  "sample",
+				Usage: "Path to a sample file to include (may be repeated)",
+			},
+			&cli.StringFlag{
+				Name:  "code-dir",
+				Usage: "Directory of source files used for the built-in code sample",
+				Value: ".",
+			},
+			&cli.IntFlag{
+				Name:  "log-lines",
+				Usage: "Number of lines in the built-in synthetic log sample",
+				Value: 20000,
+			},
+			&cli.IntFlag{
+				Name:  "paste-size",
+				Usage: "Size in bytes of each simulated paste",
+				Value: 4096,
+			},
+			&cli.StringFlag{
+				Name:  "write-dict",
+				Usage: "Write the zstd dictionary trained on all samples to this path",
+			},
+		},
+		Action: func(ctx context.Context, c *cli.Command) error {
+			pasteSize := int(c.Int("paste-size"))
+			if pasteSize <= 0 {
+				return fmt.Errorf("paste-size must be positive")
+			}
+
+			samples := []sample{
+				{name: "logs", chunks: chunk(syntheticLogs(int(c.Int("log-lines"))), pasteSize)},
+			}
+
+			code, err := codeSample(c.String("code-dir"))
+			if err != nil {
+				return fmt.Errorf("could not read code sample: %v", err)
+			}
+			if len(code) > 0 {
+				samples = append(samples, sample{name: "code", chunks: chunk(code, pasteSize)})
+			}
+
+			for _, path := range c.StringSlice("sample") {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					return fmt.Errorf("could not read sample: %v", err)
+				}
+				samples = append(samples, sample{name: filepath.Base(path), chunks: chunk(data, pasteSize)})
+			}
+
+			if out := c.String("write-dict"); out != "" {
+				var all [][]byte
+				for _, s := range samples {
+					all = append(all, s.chunks...)
+				}
+				d, err := trainDict(all)
+				if err != nil {
+					return fmt.Errorf("could not train dictionary: %v", err)
+				}
+				if err := os.WriteFile(out, d, 0o644); err != nil {
+					return err
+				}
+				log.Printf("wrote %d byte zstd dictionary to %s", len(d), out)
+			}
+
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+			fmt.Fprintln(tw, "sample\ttransformer\tin\tout\tratio\tcompress MB/s\tdecompress MB/s\t")
+			for _, s := range samples {
+				cands, err := candidates(s)
+				if err != nil {
+					return err
+				}
+				for _, cand := range cands {
+					r, err := run(cand.t, s.chunks)
+					if err != nil {
+						return fmt.Errorf("%s on %s: %v", cand.name, s.name, err)
+					}
+					fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%.3f\t%.1f\t%.1f\t\n",
+						s.name, cand.name, r.in, r.out, float64(r.in)/float64(r.out),
+						mbps(r.in, r.compress), mbps(r.in, r.decompress))
+				}
+			}
+			return tw.Flush()
+		},
+	}
+	if err := cmd.Run(context.Background(), os.Args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// candidates returns the transformer configurations to compare for s.
+// The zstd dictionary is trained on every other chunk so that it is not
+// measured purely on the data it was built from.
+func candidates(s sample) ([]candidate, error) {
+	var cands []candidate
+	for _, l := range []int{1, 6, 9} {
+		cands = append(cands, candidate{fmt.Sprintf("gzip-%d", l), transforms.NewGZipTransformer(l)})
+	}
+	for _, l := range []int{1, 3, 9, 19} {
+		cands = append(cands, candidate{fmt.Sprintf("zstd-%d", l), transforms.NewZstdTransformer(l, nil)})
+	}
+
+	var training [][]byte
+	for i := 0; i < len(s.chunks); i += 2 {
+		training = append(training, s.chunks[i])
+	}
+	if d, err := trainDict(training); err == nil {
+		cands = append(cands, candidate{"zstd-3+dict", transforms.NewZstdTransformer(3, d)})
+	} else {
+		log.Printf("skipping zstd dictionary for %s: %v", s.name, err)
+	}
+
+	for _, l := range []int{1, 6, 11} {
+		cands = append(cands, candidate{fmt.Sprintf("brotli-%d", l), transforms.NewBrotliTransformer(l)})
+	}
+	for _, l := range []int{1, 6, 9} {
+		xzTransformer, err := transforms.NewXZTransformer(l)
+		if err != nil {
+			return nil, err
+		}
+		cands = append(cands, candidate{fmt.Sprintf("xz-%d", l), xzTransformer})
+	}
+	for _, l := range []int{0, 9} {
+		lz4Transformer, err := transforms.NewLZ4Transformer(l)
+		if err != nil {
+			return nil, err
+		}
+		cands = append(cands, candidate{fmt.Sprintf("lz4-%d", l), lz4Transformer})
+	}
+	return cands, nil
+}
+
+type result struct {
+	in, out              int64
+	compress, decompress time.Duration
+}
+
+// run compresses and decompresses every chunk with t, checking that each round-trips.
+func run(t transforms.Transformer, chunks [][]byte) (result, error) {
+	var r result
+	compressed := make([][]byte, len(chunks))
+
+	start := time.Now()
+	for i, c := range chunks {
+		out, err := t.Transform(bytes.NewReader(c))
+		if err != nil {
+			return r, err
+		}
+		compressed[i], err = io.ReadAll(out)
+		if err != nil {
+			return r, err
+		}
+		r.in += int64(len(c))
+		r.out += int64(len(compressed[i]))
+	}
+	r.compress = time.Since(start)
+
+	start = time.Now()
+	for i, c := range compressed {
+		out, err := t.ReverseTransform(bytes.NewReader(c))
+		if err != nil {
+			return r, err
+		}
+		plain, err := io.ReadAll(out)
+		if err != nil {
+			return r, err
+		}
+		if !bytes.Equal(plain, chunks[i]) {
+			return r, fmt.Errorf("chunk %d did not round-trip", i)
+		}
+	}
+	r.decompress = time.Since(start)
+	return r, nil
+}
+
+func trainDict(chunks [][]byte) ([]byte, error) {
+	return dict.BuildZstdDict(chunks, dict.Options{
+		MaxDictSize: 64 << 10,
+		HashBytes:   6,
+	})
+}
+
+func mbps(n int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) / d.Seconds() / (1 << 20)
+}
+
+func chunk(data []byte, size int) [][]byte {
+	var chunks [][]byte
+	for len(data) > 0 {
+		n := min(size, len(data))
+		chunks = append(chunks, data[:n])
+		data = data[n:]
+	}
+	return chunks
+}
+
+// syntheticLogs generates a deterministic mix of access log and application log lines.
+func syntheticLogs(lines int) []byte {
+	rng := rand.New(rand.NewSource(1))
+	methods := []string{"GET", "GET", "GET", "POST", "PUT", "DELETE"}
+	paths := []string{"/", "/api/v1/pastes", "/healthz", "/static/app.js", "/raw/aB3dE", "/login"}
+	levels := []string{"INFO", "INFO", "INFO", "DEBUG", "WARN", "ERROR"}
+	messages := []string{
+		"request completed",
+		"cache miss for key",
+		"connection reset by peer",
+		"retrying upstream request",
+		"slow query detected",
+		"user session refreshed",
+	}
+
+	var buf bytes.Buffer
+	ts := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < lines; i++ {
+		ts = ts.Add(time.Duration(rng.Intn(2000)) * time.Millisecond)
+		if rng.Intn(2) == 0 {
+			fmt.Fprintf(&buf, "10.%d.%d.%d - - [%s] \"%s %s HTTP/1.1\" %d %d \"-\" \"curl/8.%d.0\"\n",
+				rng.Intn(256), rng.Intn(256), rng.Intn(256),
+				ts.Format("02/Jan/2006:15:04:05 -0700"),
+				methods[rng.Intn(len(methods))], paths[rng.Intn(len(paths))],
+				[]int{200, 200, 200, 304, 404, 500}[rng.Intn(6)], rng.Intn(50000), rng.Intn(10))
+		} else {
+			fmt.Fprintf(&buf, "%s %-5s [worker-%d] %s request_id=%08x duration_ms=%d\n",
+				ts.Format(time.RFC3339Nano), levels[rng.Intn(len(levels))], rng.Intn(16),
+				messages[rng.Intn(len(messages))], rng.Uint32(), rng.Intn(3000))
+		}
+	}
+	return buf.Bytes()
+}
+
+// codeSample concatenates the Go source files under dir.
+func codeSample(dir string) ([]byte, error) {
+	var buf bytes.Buffer
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && strings.HasPrefix(d.Name(), ".") && path != dir {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".go") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		return nil
+	})
+	return buf.Bytes(), err
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/cbrnrd/pasted/pkg/ipfilter"
+	"github.com/cbrnrd/pasted/pkg/moderation"
+)
+
+// filterIP is middleware that refuses requests from clients the IP filter
+// does not allow.
+func (s *webServer) filterIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr, _ := netip.ParseAddr(clientIP(r))
+		if s.filter.Allowed(addr) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, apiPrefix+"/") {
+			writeAPIError(w, http.StatusForbidden, "forbidden", "Access denied")
+			return
+		}
+		http.Error(w, "Access denied", http.StatusForbidden)
+	})
+}
+
+// rateLimited returns a handler for requests over a rate limit that counts
+// the violation towards an automatic ban before calling fail.
+func (s *webServer) rateLimited(fail http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.strike(clientIP(r), ipfilter.StrikeRateLimit)
+		fail(w, r)
+	}
+}
+
+// strike counts a strike of kind against the client at ip and records any
+// resulting ban in the moderation audit trail.
+func (s *webServer) strike(ip string, kind ipfilter.Strike) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return
+	}
+	ban := s.filter.Strike(addr, kind)
+	if ban == nil {
+		return
+	}
+	entry := moderation.AuditEntry{
+		Actor:  "auto",
+		Action: "auto_ban",
+		Target: "ip " + ban.Network.String() + " until " + ban.ExpiresAt.Format("2006-01-02 15:04 MST"),
+		Reason: ban.Reason,
+	}
+	if err := s.mod.Record(entry); err != nil {
+		log.Printf("could not record automatic ban of %s: %v", ban.Network, err)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cbrnrd/pasted/pkg/auth"
+	"github.com/cbrnrd/pasted/pkg/config"
+	"github.com/urfave/cli/v3"
+	"gopkg.in/yaml.v3"
+)
+
+var keysFileFlag = &cli.StringFlag{
+	Name:    "keys-file",
+	Usage:   "Path to the keys file; defaults to auth.keys_file from --config",
+	Sources: cli.EnvVars("PASTED_KEYS_FILE"),
+}
+
+var keysCommand = &cli.Command{
+	Name:  "keys",
+	Usage: "Manage API keys",
+	Commands: []*cli.Command{
+		{
+			Name:  "issue",
+			Usage: "Issue a new API key and print its token",
+			Flags: []cli.Flag{
+				keysFileFlag,
+				&cli.StringFlag{
+					Name:     "id",
+					Usage:    "Name of the key",
+					Required: true,
+				},
+				&cli.StringSliceFlag{
+					Name:  "scope",
+					Usage: "Scope the key allows: read, write or admin (repeatable)",
+					Value: []string{"read", "write"},
+				},
+				&cli.StringFlag{
+					Name:  "owner",
+					Usage: "Owner recorded on pastes created with the key; defaults to the id",
+				},
+				&cli.DurationFlag{
+					Name:  "expires-in",
+					Usage: "Lifetime of the key; keys do not expire by default",
+				},
+				&cli.StringFlag{
+					Name:  "namespace",
+					Usage: "Namespace that TCP uploads with the key are stored in",
+				},
+				&cli.StringSliceFlag{
+					Name:  "ip",
+					Usage: "Network whose TCP uploads use this key without a token (repeatable)",
+				},
+				&cli.IntFlag{
+					Name:  "pastes-per-hour",
+					Usage: "Number of pastes the key can create per hour",
+				},
+				&cli.IntFlag{
+					Name:  "max-paste-bytes",
+					Usage: "Largest paste the key can create",
+				},
+			},
+			Action: issueKey,
+		},
+		{
+			Name:      "revoke",
+			Usage:     "Revoke an API key",
+			ArgsUsage: "ID",
+			Flags:     []cli.Flag{keysFileFlag},
+			Action:    revokeKey,
+		},
+		{
+			Name:   "list",
+			Usage:  "List API keys",
+			Flags:  []cli.Flag{keysFileFlag},
+			Action: listKeys,
+		},
+	},
+}
+
+// keysFilePath returns the keys file named by --keys-file, or by the
+// configuration file given with --config.
+func keysFilePath(c *cli.Command) (string, error) {
+	if path := c.String("keys-file"); path != "" {
+		return path, nil
+	}
+	configPath := c.String("config")
+	if configPath == "" {
+		return "", fmt.Errorf("--keys-file or --config is required")
+	}
+
+	configFile, err := os.Open(configPath)
+	if err != nil {
+		return "", fmt.Errorf("could not open config file: %v", err)
+	}
+	defer configFile.Close()
+
+	var cfg config.CLIConfig
+	if err := yaml.NewDecoder(configFile).Decode(&cfg); err != nil {
+		return "", fmt.Errorf("could not parse config file: %v", err)
+	}
+	if cfg.Auth.KeysFile == "" {
+		return "", fmt.Errorf("auth.keys_file is not set in %s", configPath)
+	}
+	return cfg.Auth.KeysFile, nil
+}
+
+func issueKey(ctx context.Context, c *cli.Command) error {
+	path, err := keysFilePath(c)
+	if err != nil {
+		return err
+	}
+	f, err := auth.LoadKeyFile(path)
+	if err != nil {
+		return err
+	}
+
+	id := c.String("id")
+	if f.Find(id) != nil {
+		return fmt.Errorf("a key with id %q already exists", id)
+	}
+
+	var scopes []auth.Scope
+	for _, s := range c.StringSlice("scope") {
+		scope, err := auth.ParseScope(s)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	token, hash, err := auth.GenerateToken()
+	if err != nil {
+		return fmt.Errorf("could not generate a token: %v", err)
+	}
+	key := &auth.Key{
+		ID:        id,
+		Hash:      hash,
+		Owner:     c.String("owner"),
+		Scopes:    scopes,
+		IPs:       c.StringSlice("ip"),
+		Namespace: c.String("namespace"),
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		Quota: auth.Quota{
+			PastesPerHour: int(c.Int("pastes-per-hour")),
+			MaxPasteBytes: c.Int("max-paste-bytes"),
+		},
+	}
+	if lifetime := c.Duration("expires-in"); lifetime > 0 {
+		expires := key.CreatedAt.Add(lifetime)
+		key.ExpiresAt = &expires
+	}
+
+	f.Keys = append(f.Keys, key)
+	if err := f.Save(path); err != nil {
+		return fmt.Errorf("could not save keys file: %v", err)
+	}
+	fmt.Println(token)
+	return nil
+}
+
+func revokeKey(ctx context.Context, c *cli.Command) error {
+	id := c.Args().First()
+	if id == "" {
+		return fmt.Errorf("the id of the key to revoke is required")
+	}
+	path, err := keysFilePath(c)
+	if err != nil {
+		return err
+	}
+	f, err := auth.LoadKeyFile(path)
+	if err != nil {
+		return err
+	}
+
+	key := f.Find(id)
+	if key == nil {
+		return fmt.Errorf("no key with id %q in %s", id, path)
+	}
+	if key.RevokedAt == nil {
+		now := time.Now().UTC().Truncate(time.Second)
+		key.RevokedAt = &now
+	}
+	if err := f.Save(path); err != nil {
+		return fmt.Errorf("could not save keys file: %v", err)
+	}
+	return nil
+}
+
+func listKeys(ctx context.Context, c *cli.Command) error {
+	path, err := keysFilePath(c)
+	if err != nil {
+		return err
+	}
+	f, err := auth.LoadKeyFile(path)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tOWNER\tSCOPES\tCREATED\tEXPIRES\tSTATUS")
+	for _, k := range f.Keys {
+		scopes := make([]string, len(k.Scopes))
+		for i, s := range k.Scopes {
+			scopes[i] = string(s)
+		}
+		expires := "never"
+		if k.ExpiresAt != nil {
+			expires = k.ExpiresAt.Format(time.RFC3339)
+		}
+		status := "active"
+		switch {
+		case k.RevokedAt != nil:
+			status = "revoked"
+		case !k.Active(now):
+			status = "expired"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", k.ID, k.OwnerName(), strings.Join(scopes, ","),
+			k.CreatedAt.Format(time.RFC3339), expires, status)
+	}
+	return tw.Flush()
+}
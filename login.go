@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cbrnrd/pasted/pkg/auth"
+	"github.com/cbrnrd/pasted/pkg/metrics"
+	"github.com/cbrnrd/pasted/pkg/render"
+	"github.com/cbrnrd/pasted/pkg/util"
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// sessionCookie holds the signed identity of a user who logged in.
+	sessionCookie = "pasted_session"
+
+	// loginCookie holds the state of a login until the provider redirects back.
+	loginCookie = "pasted_login"
+
+	// loginLifetime is how long a user has to complete a login at the provider.
+	loginLifetime = 10 * time.Minute
+)
+
+// loginState is kept in the login cookie so that the callback can check that
+// it completes a login this browser started.
+type loginState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Next     string `json:"next"`
+}
+
+// loginRoutes registers the single sign-on routes.
+func (s *webServer) loginRoutes(router chi.Router) {
+	router.Get("/auth/login", s.handleLogin)
+	router.Get("/auth/callback", s.handleCallback)
+	router.Post("/auth/logout", s.handleLogout)
+	router.Get("/my", s.handleMyPastes)
+	router.Post("/my/{key}/delete", s.handleMyDelete)
+	router.Post("/my/{key}/extend", s.handleMyExtend)
+}
+
+// session returns middleware that identifies browsers by their session
+// cookie, for requests that did not send an API key. It is only used on page
+// routes; API clients authenticate with keys.
+func (s *webServer) session(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.sessions == nil || requestKey(r) != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if id := s.sessionIdentity(r); id != nil {
+			r = r.WithContext(context.WithValue(r.Context(), keyContextKey{}, id.Key()))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sessionIdentity returns the user the session cookie belongs to, or nil.
+func (s *webServer) sessionIdentity(r *http.Request) *auth.Identity {
+	if s.sessions == nil {
+		return nil
+	}
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil
+	}
+	var id auth.Identity
+	if err := s.sessions.Decode(sessionCookie, cookie.Value, &id); err != nil {
+		return nil
+	}
+	return &id
+}
+
+// account returns the header shown to the user who made the request.
+func (s *webServer) account(r *http.Request) render.Account {
+	a := render.Account{SSO: s.oidc != nil}
+	if id := s.sessionIdentity(r); id != nil {
+		a.User = id.DisplayName()
+	}
+	return a
+}
+
+// handleLogin starts a login by redirecting to the provider. ?next= is the
+// local path to return to afterwards.
+func (s *webServer) handleLogin(w http.ResponseWriter, r *http.Request) {
+	state, err := util.GenerateRandomString(32)
+	if err != nil {
+		http.Error(w, "Could not start login", http.StatusInternalServerError)
+		return
+	}
+	nonce, err := util.GenerateRandomString(32)
+	if err != nil {
+		http.Error(w, "Could not start login", http.StatusInternalServerError)
+		return
+	}
+	login := loginState{
+		State:    state,
+		Nonce:    nonce,
+		Verifier: oauth2.GenerateVerifier(),
+		Next:     localPath(r.URL.Query().Get("next")),
+	}
+	value, err := s.sessions.Encode(loginCookie, login, loginLifetime)
+	if err != nil {
+		http.Error(w, "Could not start login", http.StatusInternalServerError)
+		return
+	}
+	s.setCookie(w, loginCookie, value, "/auth/", loginLifetime)
+	http.Redirect(w, r, s.oidc.AuthCodeURL(login.State, login.Nonce, login.Verifier), http.StatusFound)
+}
+
+// handleCallback completes a login when the provider redirects back, and
+// starts a session for the user.
+func (s *webServer) handleCallback(w http.ResponseWriter, r *http.Request) {
+	var login loginState
+	cookie, err := r.Cookie(loginCookie)
+	if err != nil || s.sessions.Decode(loginCookie, cookie.Value, &login) != nil {
+		http.Error(w, "Login expired, please try again", http.StatusBadRequest)
+		return
+	}
+	s.setCookie(w, loginCookie, "", "/auth/", -1)
+
+	query := r.URL.Query()
+	if query.Get("state") != login.State {
+		http.Error(w, "Login state does not match, please try again", http.StatusBadRequest)
+		return
+	}
+	if e := query.Get("error"); e != "" {
+		metrics.AuthFailures.Add(1)
+		message := e
+		if desc := query.Get("error_description"); desc != "" {
+			message += ": " + desc
+		}
+		http.Error(w, "Login failed: "+message, http.StatusForbidden)
+		return
+	}
+
+	id, err := s.oidc.Exchange(r.Context(), query.Get("code"), login.Nonce, login.Verifier)
+	switch {
+	case errors.Is(err, auth.ErrLoginDenied):
+		metrics.AuthFailures.Add(1)
+		log.Print(err)
+		http.Error(w, "You are not allowed to use this server", http.StatusForbidden)
+		return
+	case err != nil:
+		metrics.AuthFailures.Add(1)
+		log.Printf("login failed: %v", err)
+		http.Error(w, "Login failed", http.StatusBadGateway)
+		return
+	}
+
+	lifetime := s.cfg.Auth.OIDC.GetSessionLifetime()
+	value, err := s.sessions.Encode(sessionCookie, id, lifetime)
+	if err != nil {
+		http.Error(w, "Could not start session", http.StatusInternalServerError)
+		return
+	}
+	s.setCookie(w, sessionCookie, value, "/", lifetime)
+	http.Redirect(w, r, login.Next, http.StatusSeeOther)
+}
+
+// handleLogout ends the session. Sessions are not stored on the server, so a
+// copy of the cookie stays valid until it expires.
+func (s *webServer) handleLogout(w http.ResponseWriter, r *http.Request) {
+	s.setCookie(w, sessionCookie, "", "/", -1)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// setCookie sets an HTTP-only cookie, or deletes it if maxAge is negative.
+// Cookies are SameSite=Lax, so other sites cannot post forms with them.
+func (s *webServer) setCookie(w http.ResponseWriter, name, value, path string, maxAge time.Duration) {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(s.cfg.Domain, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	}
+	if maxAge < 0 {
+		cookie.MaxAge = -1
+	} else {
+		cookie.MaxAge = int(maxAge.Seconds())
+	}
+	http.SetCookie(w, cookie)
+}
+
+// localPath returns next if it is a path on this server, and "/" otherwise,
+// so that a login link cannot redirect to another site.
+func localPath(next string) string {
+	u, err := url.Parse(next)
+	if err != nil || u.Scheme != "" || u.Host != "" || !strings.HasPrefix(u.Path, "/") ||
+		strings.HasPrefix(next, "//") || strings.Contains(next, `\`) {
+		return "/"
+	}
+	return next
+}
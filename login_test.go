@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/cbrnrd/pasted/pkg/auth"
+	"github.com/cbrnrd/pasted/pkg/auth/oidctest"
+	"github.com/cbrnrd/pasted/pkg/config"
+	"github.com/go-chi/chi/v5"
+)
+
+// loginServer serves the login routes of a web server that uses a mock
+// provider.
+type loginServer struct {
+	s        *webServer
+	router   chi.Router
+	provider *oidctest.Provider
+}
+
+func newLoginServer(t *testing.T, opts auth.OIDCOptions) *loginServer {
+	t.Helper()
+	provider := oidctest.NewProvider(t, "pasted", "secret")
+	cfg := &config.CLIConfig{Domain: "http://pasted.test"}
+	opts.Issuer = provider.URL
+	opts.ClientID = provider.ClientID
+	opts.ClientSecret = provider.ClientSecret
+	opts.RedirectURL = cfg.Domain + "/auth/callback"
+	opts.GroupsClaim = "groups"
+	oidc, err := auth.NewOIDC(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &webServer{cfg: cfg, oidc: oidc, sessions: auth.NewSessions([]byte("secret"))}
+	router := chi.NewRouter()
+	s.loginRoutes(router)
+	return &loginServer{s: s, router: router, provider: provider}
+}
+
+func (ls *loginServer) get(target string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	ls.router.ServeHTTP(w, r)
+	return w
+}
+
+// start begins a login and returns the login cookie and the callback URL
+// the provider redirects to.
+func (ls *loginServer) start(t *testing.T, next string) (*http.Cookie, *url.URL) {
+	t.Helper()
+	w := ls.get("/auth/login?next=" + url.QueryEscape(next))
+	if w.Code != http.StatusFound {
+		t.Fatalf("GET /auth/login: status %d", w.Code)
+	}
+	login := responseCookie(w, loginCookie)
+	if login == nil {
+		t.Fatal("GET /auth/login did not set the login cookie")
+	}
+	return login, ls.provider.Authorize(t, w.Header().Get("Location"))
+}
+
+func responseCookie(w *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestLoginCallback(t *testing.T) {
+	ls := newLoginServer(t, auth.OIDCOptions{DefaultScopes: []auth.Scope{auth.ScopeRead, auth.ScopeWrite}})
+	ls.provider.SetClaims(map[string]any{"email": "alice@example.com", "email_verified": true})
+	login, callback := ls.start(t, "/my")
+
+	w := ls.get(callback.RequestURI(), login)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/my" {
+		t.Fatalf("callback: status %d, location %q", w.Code, w.Header().Get("Location"))
+	}
+	session := responseCookie(w, sessionCookie)
+	if session == nil {
+		t.Fatal("callback did not set the session cookie")
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(session)
+	id := ls.s.sessionIdentity(r)
+	if id == nil || id.Email != "alice@example.com" {
+		t.Fatalf("session identity = %+v", id)
+	}
+}
+
+func TestLoginCallbackStateMismatch(t *testing.T) {
+	ls := newLoginServer(t, auth.OIDCOptions{DefaultScopes: []auth.Scope{auth.ScopeRead}})
+	login, callback := ls.start(t, "/")
+
+	query := callback.Query()
+	query.Set("state", "forged")
+	callback.RawQuery = query.Encode()
+	w := ls.get(callback.RequestURI(), login)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("callback with another state: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if responseCookie(w, sessionCookie) != nil {
+		t.Fatal("callback with another state set a session cookie")
+	}
+}
+
+func TestLoginCallbackWithoutLoginCookie(t *testing.T) {
+	ls := newLoginServer(t, auth.OIDCOptions{DefaultScopes: []auth.Scope{auth.ScopeRead}})
+	_, callback := ls.start(t, "/")
+
+	if w := ls.get(callback.RequestURI()); w.Code != http.StatusBadRequest {
+		t.Fatalf("callback without the login cookie: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestLoginCallbackDenied(t *testing.T) {
+	ls := newLoginServer(t, auth.OIDCOptions{AllowedGroups: []string{"eng"}, DefaultScopes: []auth.Scope{auth.ScopeRead}})
+	ls.provider.SetClaims(map[string]any{"groups": []string{"sales"}})
+	login, callback := ls.start(t, "/")
+
+	w := ls.get(callback.RequestURI(), login)
+	if w.Code != http.StatusForbidden || responseCookie(w, sessionCookie) != nil {
+		t.Fatalf("callback for a denied user: status %d", w.Code)
+	}
+}
+
+func TestLoginCookieIsNotASession(t *testing.T) {
+	ls := newLoginServer(t, auth.OIDCOptions{DefaultScopes: []auth.Scope{auth.ScopeRead}})
+	login, _ := ls.start(t, "/")
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: sessionCookie, Value: login.Value})
+	if id := ls.s.sessionIdentity(r); id != nil {
+		t.Fatalf("login cookie was accepted as a session for %+v", id)
+	}
+}
@@ -1,21 +1,29 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
-	"net/http"
+	"net/netip"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/cbrnrd/pasted/pkg/auth"
 	"github.com/cbrnrd/pasted/pkg/backends"
 	"github.com/cbrnrd/pasted/pkg/config"
+	"github.com/cbrnrd/pasted/pkg/content"
+	"github.com/cbrnrd/pasted/pkg/ipfilter"
+	"github.com/cbrnrd/pasted/pkg/moderation"
+	"github.com/cbrnrd/pasted/pkg/pow"
+	"github.com/cbrnrd/pasted/pkg/proxyproto"
+	"github.com/cbrnrd/pasted/pkg/quota"
 	"github.com/cbrnrd/pasted/pkg/transforms"
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
-	"github.com/go-chi/httprate"
 	"github.com/urfave/cli/v3"
 	"gopkg.in/yaml.v3"
 )
@@ -31,6 +39,12 @@ func main() {
 				Sources: cli.EnvVars("PASTED_CONFIG"),
 			},
 		},
+		Commands: []*cli.Command{
+			recordCommand,
+			keysCommand,
+			moderationCommand,
+			powCommand,
+		},
 		Action: func(ctx context.Context, c *cli.Command) error {
 			configPath := c.String("config")
 			if configPath == "" {
@@ -73,62 +87,92 @@ func startListeners(cfg *config.CLIConfig) {
 		tfs...,
 	)
 
-	go startPasteListener(backend, cfg, transformerChain)
+	keys, err := cfg.Auth.GetKeyStore()
+	if err != nil {
+		panic(err)
+	}
 
-	startWebServer(backend, cfg, transformerChain)
-}
+	if err := cfg.CheckNamespaces(); err != nil {
+		panic(err)
+	}
 
-func startWebServer(backend backends.Backend, cfg *config.CLIConfig, chain *transforms.ChainTransformer) {
-	router := chi.NewRouter()
+	oidc, err := cfg.Auth.OIDC.GetOIDC(context.Background(), cfg.Domain)
+	if err != nil {
+		panic(err)
+	}
 
-	router.Use(middleware.RealIP)
-	router.Use(middleware.RequestID)
-	router.Use(middleware.Logger)
-	router.Use(middleware.Recoverer)
-	router.Use(httprate.LimitByIP(10, 1*time.Minute))
+	quotas, err := cfg.Quotas.GetQuotaTracker()
+	if err != nil {
+		panic(err)
+	}
+	if err := countStored(backend, quotas); err != nil {
+		panic(fmt.Errorf("could not count stored pastes for quotas: %w", err))
+	}
 
-	router.Get("/{key}", func(w http.ResponseWriter, r *http.Request) {
-		pr, pw := io.Pipe()
-		errCh := make(chan error, 1)
+	mod, err := cfg.Moderation.GetModerationStore()
+	if err != nil {
+		panic(err)
+	}
 
-		go func() {
-			defer pw.Close()
-			key := chi.URLParam(r, "key")
-			err := backend.Get(key, pw)
-			if err != nil {
-				errCh <- err
-				return
-			}
-			errCh <- nil
-		}()
+	filter, err := cfg.IPFilter.GetIPFilter()
+	if err != nil {
+		panic(err)
+	}
+
+	proxies, err := cfg.GetTrustedProxies()
+	if err != nil {
+		panic(err)
+	}
 
-		reversed, transformErr := chain.ReverseTransform(pr)
+	work, err := cfg.ProofOfWork.GetProofOfWork()
+	if err != nil {
+		panic(err)
+	}
 
-		// Wait for the goroutine's error, if any
-		goroutineErr := <-errCh
+	if cfg.MetricsListenAddr != "" {
+		go startMetricsServer(cfg)
+	}
 
-		if goroutineErr != nil || transformErr != nil {
-			// Close the pipe to ensure no further writes
-			pr.Close()
-			http.Error(w, "Error retrieving paste", http.StatusInternalServerError)
-			return
+	go reapExpired(backend, quotas)
+
+	for _, lc := range cfg.GetListeners() {
+		listenerTfs, err := lc.GetTransforms()
+		if err != nil {
+			panic(err)
 		}
+		listenerChain := transforms.NewChainTransformer(append(listenerTfs, tfs...)...)
 
-		_, err := io.Copy(w, reversed)
+		tlsConfig, err := lc.GetTLSConfig()
 		if err != nil {
-			http.Error(w, "Error writing paste", http.StatusInternalServerError)
-			return
+			panic(err)
 		}
 
-	})
-	http.ListenAndServe(cfg.HttpListenAddr, router)
+		var listenerProxies []netip.Prefix
+		if lc.ProxyProtocol {
+			listenerProxies = proxies
+		}
+
+		go startPasteListener(backend, cfg, lc.Addr, tlsConfig, listenerProxies, listenerChain, keys, quotas, mod, filter, work)
+	}
+
+	startWebServer(backend, cfg, transformerChain, keys, quotas, mod, filter, proxies, work, oidc)
 }
 
-func startPasteListener(backend backends.Backend, cfg *config.CLIConfig, chain *transforms.ChainTransformer) {
-	l, err := net.Listen("tcp", cfg.ListenAddr)
+func startPasteListener(backend backends.Backend, cfg *config.CLIConfig, addr string, tlsConfig *tls.Config, proxies []netip.Prefix, chain *transforms.ChainTransformer, keys *auth.Store, quotas *quota.Tracker, mod *moderation.Store, filter *ipfilter.Filter, work *pow.Verifier) {
+	l, err := net.Listen("tcp", addr)
 	if err != nil {
 		panic(err)
 	}
+	// Read PROXY protocol headers first, so that clients are filtered by
+	// their own address, and filter before the TLS handshake, so that denied
+	// clients are dropped without any work.
+	if len(proxies) > 0 {
+		l = proxyproto.Listener(l, proxies)
+	}
+	l = filter.Listener(l)
+	if tlsConfig != nil {
+		l = tls.NewListener(l, tlsConfig)
+	}
 
 	for {
 		conn, err := l.Accept()
@@ -136,26 +180,157 @@ func startPasteListener(backend backends.Backend, cfg *config.CLIConfig, chain *
 			panic(err)
 		}
 
-		go handlePaste(conn, cfg, backend, chain)
+		go handlePaste(conn, cfg, backend, chain, keys, quotas, mod, work)
 	}
 }
 
-func handlePaste(conn net.Conn, cfg *config.CLIConfig, backend backends.Backend, chain *transforms.ChainTransformer) {
+func handlePaste(conn net.Conn, cfg *config.CLIConfig, backend backends.Backend, chain *transforms.ChainTransformer, keys *auth.Store, quotas *quota.Tracker, mod *moderation.Store, work *pow.Verifier) {
 	defer conn.Close()
 
-	transformed, err := chain.Transform(conn)
+	// Complete the TLS handshake up front so that a client certificate is
+	// available, and so that clients that never finish it are dropped.
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		tlsConn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+		err := tlsConn.Handshake()
+		tlsConn.SetDeadline(time.Time{})
+		if err != nil {
+			log.Printf("TLS handshake with %s failed: %v", conn.RemoteAddr(), err)
+			return
+		}
+	}
+
+	var ip string
+	if addr := connIP(conn); addr != nil {
+		ip = addr.String()
+	}
+	key, input, err := authenticateConn(conn, &cfg.Auth.Certificates, keys, work)
+	var namespace string
+	if key != nil {
+		namespace = key.Namespace
+	}
+	if err == nil {
+		err = authorizeUpload(cfg, keys, mod, key, ip, namespace)
+	}
 	if err != nil {
-		fmt.Println("Error during transformation:", err)
+		countUploadRejection(err)
+		io.WriteString(conn, "Paste rejected: "+err.Error()+"\n")
+		drain(conn, input)
 		return
 	}
 
-	path, err := backend.Put(transformed)
-	if err != nil {
+	meta := &backends.Metadata{SourceIP: ip, Namespace: namespace}
+	pasteKey, err := storePaste(input, cfg, backend, chain, quotas, key, meta)
+	var typeErr *contentTypeError
+	switch {
+	case errors.As(err, &typeErr), errors.Is(err, quota.ErrExceeded), errors.Is(err, errImageMetadata):
+		io.WriteString(conn, "Paste rejected: "+err.Error()+"\n")
+		drain(conn, input)
+		return
+	case errors.Is(err, transforms.ErrSecretDetected):
+		io.WriteString(conn, "Paste rejected: "+err.Error()+"\n")
+		return
+	case errors.Is(err, errStoreTransform):
+		log.Printf("Storing paste from %s failed: %v", conn.RemoteAddr(), err)
+		return
+	case err != nil:
 		io.WriteString(conn, "Error storing paste: "+err.Error())
 		return
 	}
 
-	path = cfg.Domain + "/" + path
+	io.WriteString(conn, pasteURL(cfg, namespace, pasteKey))
+}
+
+// tlsHandshakeTimeout bounds the TLS handshake on paste listeners.
+const tlsHandshakeTimeout = 10 * time.Second
+
+// authLinePrefix starts the optional first line of a TCP upload that carries
+// an API key: "AUTH pasted_...".
+const authLinePrefix = "AUTH " + auth.TokenPrefix
+
+// powLinePrefix starts the challenge line sent to anonymous clients when a
+// proof of work is required, "POW <bits> <token>", and the line they answer
+// with, "POW <solution>".
+const powLinePrefix = "POW "
+
+// authenticateConn identifies the client of a TCP upload by an API key sent
+// on the first line, or else by its client certificate, under certs if no key
+// claims it, or address. Other clients are sent a challenge if work is not
+// nil, and must answer it on the first line. It returns the key, which is nil
+// for anonymous clients, and the rest of the upload.
+func authenticateConn(conn net.Conn, certs *auth.CertPolicy, keys *auth.Store, work *pow.Verifier) (*auth.Key, io.Reader, error) {
+	input := bufio.NewReaderSize(conn, content.SampleSize)
+	key, err := connKey(conn, certs, keys)
+	if err != nil {
+		return nil, input, err
+	}
+
+	// The challenge is sent before reading anything, as clients wait for it.
+	var challenge pow.Challenge
+	if key == nil && work != nil {
+		challenge = work.Issue()
+		if _, err := fmt.Fprintf(conn, "%s%d %s\n", powLinePrefix, challenge.Bits, challenge.Token); err != nil {
+			return nil, input, err
+		}
+	}
+
+	prefix, _ := input.Peek(len(authLinePrefix))
+	switch {
+	case string(prefix) == authLinePrefix:
+		line, err := input.ReadSlice('\n')
+		if err != nil {
+			return nil, input, auth.ErrInvalidKey
+		}
+		token := strings.TrimSpace(strings.TrimPrefix(string(line), "AUTH "))
+		key, err := keys.Authenticate(token)
+		return key, input, err
+	case key != nil || work == nil:
+		return key, input, nil
+	case strings.HasPrefix(string(prefix), powLinePrefix):
+		line, err := input.ReadSlice('\n')
+		if err != nil {
+			return nil, input, pow.ErrInvalid
+		}
+		solution := strings.TrimSpace(strings.TrimPrefix(string(line), powLinePrefix))
+		return nil, input, work.Verify(challenge.Token, solution)
+	default:
+		return nil, input, pow.ErrRequired
+	}
+}
+
+// connKey returns the key of the client of conn, identified by its client
+// certificate or address, or nil. Certificates that no key claims follow
+// certs, and fail with errCertNotListed if it requires a key.
+func connKey(conn net.Conn, certs *auth.CertPolicy, keys *auth.Store) (*auth.Key, error) {
+	// Certificates are only presented on listeners with a client CA, which verifies them.
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if peer := tlsConn.ConnectionState().PeerCertificates; len(peer) > 0 {
+			subject := peer[0].Subject.String()
+			if key := keys.AuthenticateCert(subject); key != nil {
+				return key, nil
+			}
+			if certs.RequireKey {
+				return nil, errCertNotListed
+			}
+			return auth.CertKey(subject, certs.Quota), nil
+		}
+	}
+	return keys.AuthenticateIP(connIP(conn)), nil
+}
+
+// connIP returns the address of the client of a TCP connection.
+func connIP(conn net.Conn) net.IP {
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		return addr.IP
+	}
+	return nil
+}
+
+// maxDrainBytes bounds the input discarded from a rejected paste.
+const maxDrainBytes = 64 << 20
 
-	io.WriteString(conn, path)
+// drain discards the rest of a paste that was rejected before it was read, so
+// that closing the connection does not reset it before the client reads the reply.
+func drain(conn net.Conn, r io.Reader) {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	io.Copy(io.Discard, io.LimitReader(r, maxDrainBytes))
 }
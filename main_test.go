@@ -0,0 +1,184 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cbrnrd/pasted/pkg/auth"
+	"github.com/cbrnrd/pasted/pkg/backends"
+	"github.com/cbrnrd/pasted/pkg/config"
+	"github.com/cbrnrd/pasted/pkg/moderation"
+	"github.com/cbrnrd/pasted/pkg/quota"
+	"github.com/cbrnrd/pasted/pkg/transforms"
+)
+
+func TestHandlePasteKeyNamespace(t *testing.T) {
+	backend := backends.NewMemoryBackend()
+	cfg := &config.CLIConfig{
+		Domain:     "http://pasted.test",
+		Namespaces: []config.NamespaceConfig{{Name: "team-infra", Members: []string{"ci"}}},
+	}
+	keys, err := auth.NewStore("", []*auth.Key{{ID: "ci", IPs: []string{"127.0.0.1"}, Scopes: []auth.Scope{auth.ScopeWrite}, Namespace: "team-infra"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mod, err := moderation.NewStore("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			handlePaste(conn, cfg, backend, transforms.NewChainTransformer(), keys, quota.NewTracker(quota.Limits{}), mod, nil)
+		}
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(conn, "from ci")
+	conn.(*net.TCPConn).CloseWrite()
+	reply, err := io.ReadAll(conn)
+	conn.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, ok := strings.CutPrefix(string(reply), "http://pasted.test/team-infra/")
+	if !ok {
+		t.Fatalf("reply = %q, want a URL in team-infra", reply)
+	}
+	meta, err := backend.Stat(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Namespace != "team-infra" || meta.Owner != "ci" {
+		t.Errorf("namespace %q, owner %q; want team-infra and ci", meta.Namespace, meta.Owner)
+	}
+}
+
+// newCert returns a certificate for subject signed by parent, or self-signed
+// if parent is nil.
+func newCert(t *testing.T, subject pkix.Name, parent *tls.Certificate) tls.Certificate {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      subject,
+		DNSNames:     []string{"pasted.test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+	signer, signerKey := tmpl, any(priv)
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &priv.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: priv, Leaf: leaf}
+}
+
+// certConn returns the server side of a TLS connection from a client that
+// presented a certificate for subject.
+func certConn(t *testing.T, subject string) net.Conn {
+	t.Helper()
+	ca := newCert(t, pkix.Name{CommonName: "ca"}, nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	server := newCert(t, pkix.Name{CommonName: "pasted.test"}, &ca)
+	client := newCert(t, pkix.Name{CommonName: subject, Organization: []string{"CI"}}, &ca)
+
+	c, s := net.Pipe()
+	t.Cleanup(func() { c.Close(); s.Close() })
+	serverConn := tls.Server(s, &tls.Config{Certificates: []tls.Certificate{server}, ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert})
+	clientConn := tls.Client(c, &tls.Config{Certificates: []tls.Certificate{client}, RootCAs: pool, ServerName: "pasted.test"})
+	done := make(chan error, 1)
+	go func() { done <- clientConn.Handshake() }()
+	if err := serverConn.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	return serverConn
+}
+
+func TestConnKeyCertificates(t *testing.T) {
+	keys, err := auth.NewStore("", []*auth.Key{{ID: "ci", Owner: "team-infra", CertSubjects: []string{"CN=runner-1,O=CI"}, Scopes: []auth.Scope{auth.ScopeWrite}, Namespace: "team-infra"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	limit := auth.Quota{PastesPerHour: 1}
+
+	for _, tc := range []struct {
+		name       string
+		subject    string
+		requireKey bool
+		wantID     string
+		wantErr    error
+	}{
+		{name: "listed", subject: "runner-1", wantID: "ci"},
+		{name: "listed, key required", subject: "runner-1", requireKey: true, wantID: "ci"},
+		{name: "unlisted", subject: "laptop", wantID: "cert:CN=laptop,O=CI"},
+		{name: "unlisted, key required", subject: "laptop", requireKey: true, wantErr: errCertNotListed},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			key, err := connKey(certConn(t, tc.subject), &auth.CertPolicy{RequireKey: tc.requireKey, Quota: limit}, keys)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tc.wantErr)
+			}
+			if tc.wantErr != nil {
+				return
+			}
+			if key == nil || key.ID != tc.wantID {
+				t.Fatalf("key = %+v, want %s", key, tc.wantID)
+			}
+			if key.ID == "ci" && key.Namespace != "team-infra" {
+				t.Errorf("namespace = %q, want team-infra", key.Namespace)
+			}
+			if strings.HasPrefix(key.ID, "cert:") {
+				if key.Quota != limit {
+					t.Errorf("quota = %+v, want %+v", key.Quota, limit)
+				}
+				if err := keys.Allow(key); err != nil {
+					t.Fatal(err)
+				}
+				if err := keys.Allow(key); !errors.Is(err, auth.ErrQuotaExceeded) {
+					t.Errorf("second paste in the hour: error = %v, want %v", err, auth.ErrQuotaExceeded)
+				}
+			}
+		})
+	}
+}
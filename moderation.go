@@ -0,0 +1,498 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/cbrnrd/pasted/pkg/auth"
+	"github.com/cbrnrd/pasted/pkg/backends"
+	"github.com/cbrnrd/pasted/pkg/ipfilter"
+	"github.com/cbrnrd/pasted/pkg/metrics"
+	"github.com/cbrnrd/pasted/pkg/moderation"
+	"github.com/cbrnrd/pasted/pkg/render"
+	"github.com/go-chi/chi/v5"
+)
+
+// Actions moderators can take on a paste.
+const (
+	actionHide    = "hide"
+	actionUnhide  = "unhide"
+	actionDelete  = "delete"
+	actionDismiss = "dismiss"
+	actionBanIP   = "ban_ip"
+	actionBanKey  = "ban_key"
+)
+
+// Errors returned by moderatePaste.
+var (
+	errUnknownAction = errors.New("unknown action")
+	errNoSubmitter   = errors.New("the paste does not record who uploaded it")
+)
+
+// auditLimit is the number of audit entries shown on the moderation page.
+const auditLimit = 50
+
+// moderationRoutes registers the moderation pages.
+func (s *webServer) moderationRoutes(router chi.Router) {
+	router.Use(s.requireAdmin(func(w http.ResponseWriter, r *http.Request, status int, message string) {
+		if status == http.StatusUnauthorized && s.oidc != nil {
+			http.Redirect(w, r, "/auth/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+			return
+		}
+		http.Error(w, message, status)
+	}))
+	router.Get("/admin/moderation", s.handleModerationQueue)
+	router.Get("/admin/moderation/{key}", s.handleModeratedPaste)
+	router.Get("/admin/moderation/{key}/raw", s.handleModeratedRaw)
+	router.Post("/admin/moderation/{key}", s.handleModerate)
+	router.Post("/admin/bans", s.handleBan)
+	router.Post("/admin/bans/{id}/delete", s.handleUnban)
+}
+
+// requireAdmin returns middleware that only lets requests with an admin key
+// or login through. Other requests are failed with fail.
+func (s *webServer) requireAdmin(fail func(w http.ResponseWriter, r *http.Request, status int, message string)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch key := requestKey(r); {
+			case key == nil:
+				metrics.AuthFailures.Add(1)
+				fail(w, r, http.StatusUnauthorized, "An admin key is required")
+			case !key.Has(auth.ScopeAdmin):
+				metrics.AuthFailures.Add(1)
+				fail(w, r, http.StatusForbidden, "The API key does not allow admin access")
+			default:
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// moderatedMeta returns the metadata of the paste at key, including hidden
+// and expired pastes.
+func (s *webServer) moderatedMeta(key string) (*backends.Metadata, error) {
+	if !validKey.MatchString(key) {
+		return nil, backends.ErrNotFound
+	}
+	return s.backend.Stat(key)
+}
+
+// moderatePaste takes action on the paste at key for the moderator with
+// actor, records it in the audit trail, and returns the paste's metadata,
+// which is nil once it is deleted.
+func (s *webServer) moderatePaste(actor *auth.Key, key, action, reason string) (*backends.Metadata, error) {
+	meta, err := s.moderatedMeta(key)
+	if errors.Is(err, backends.ErrNotFound) && action == actionDismiss {
+		// Reports about pastes that expired or were deleted can still be dismissed.
+		meta, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var uploader string
+	if meta != nil {
+		uploader = meta.SourceIP
+	}
+	target := key
+	switch action {
+	case actionHide, actionUnhide:
+		meta.Hidden = action == actionHide
+		if err := s.backend.Update(key, meta); err != nil {
+			return nil, err
+		}
+	case actionDelete:
+		if err := s.deletePaste(key, meta); err != nil {
+			return nil, err
+		}
+		meta = nil
+	case actionDismiss:
+	case actionBanIP, actionBanKey:
+		ban := moderation.Ban{Kind: moderation.BanIP, Value: meta.SourceIP, Reason: reason, By: actor.OwnerName()}
+		if action == actionBanKey {
+			ban.Kind, ban.Value = moderation.BanKey, meta.KeyID
+		}
+		if ban.Value == "" {
+			return nil, errNoSubmitter
+		}
+		if _, err := s.mod.AddBan(ban); err != nil {
+			return nil, err
+		}
+		target = fmt.Sprintf("%s %s, who uploaded %s", ban.Kind, ban.Value, key)
+	default:
+		return nil, errUnknownAction
+	}
+
+	if action != actionUnhide && action != actionBanIP && action != actionBanKey {
+		if err := s.mod.Resolve(key, action); err != nil {
+			return nil, err
+		}
+	}
+	s.audit(actor, action, target, reason)
+	if action == actionHide || action == actionDelete {
+		s.strike(uploader, ipfilter.StrikeModerated)
+	}
+	return meta, nil
+}
+
+// banClient places a ban for the moderator with actor and records it in the
+// audit trail. expiresIn is a Go duration or a number of seconds, and empty
+// for bans that do not expire.
+func (s *webServer) banClient(actor *auth.Key, kind, value, reason, expiresIn string) (*moderation.Ban, error) {
+	banKind, err := moderation.ParseBanKind(kind)
+	if err != nil {
+		return nil, err
+	}
+	ban := moderation.Ban{Kind: banKind, Value: value, Reason: reason, By: actor.OwnerName()}
+	lifetime, err := parseExpiresIn(expiresIn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expiry: %v", err)
+	}
+	if lifetime > 0 {
+		expires := time.Now().UTC().Add(lifetime)
+		ban.ExpiresAt = &expires
+	}
+	stored, err := s.mod.AddBan(ban)
+	if err != nil {
+		return nil, err
+	}
+	s.audit(actor, "ban", string(stored.Kind)+" "+stored.Value, reason)
+	return stored, nil
+}
+
+// unbanClient lifts the ban with id for the moderator with actor and records
+// it in the audit trail.
+func (s *webServer) unbanClient(actor *auth.Key, id string) (*moderation.Ban, error) {
+	ban, err := s.mod.RemoveBan(id)
+	if err != nil {
+		return nil, err
+	}
+	s.audit(actor, "unban", string(ban.Kind)+" "+ban.Value, "")
+	return ban, nil
+}
+
+// audit records a moderation action. Failures are logged, as the action has
+// already been taken.
+func (s *webServer) audit(actor *auth.Key, action, target, reason string) {
+	entry := moderation.AuditEntry{Actor: actor.OwnerName(), Action: action, Target: target, Reason: reason}
+	if err := s.mod.Record(entry); err != nil {
+		log.Printf("could not record moderation action %s on %s by %s: %v", action, target, entry.Actor, err)
+	}
+}
+
+// reportedPaste describes the paste at key and the reports about it for the
+// moderation pages.
+func (s *webServer) reportedPaste(key string) (*render.ReportedPaste, error) {
+	p := &render.ReportedPaste{Key: key, Reports: s.mod.Reports(key)}
+	meta, err := s.moderatedMeta(key)
+	switch {
+	case errors.Is(err, backends.ErrNotFound):
+		p.Missing = true
+		return p, nil
+	case err != nil:
+		return nil, err
+	}
+	p.URL = pasteURL(s.cfg, meta.Namespace, key)
+	p.ContentType = meta.ContentType
+	p.Owner = meta.Owner
+	p.KeyID = meta.KeyID
+	p.SourceIP = meta.SourceIP
+	p.Namespace = meta.Namespace
+	p.Flags = meta.Flags
+	p.CreatedAt = meta.CreatedAt
+	p.ExpiresAt = meta.ExpiresAt
+	p.Hidden = meta.Hidden
+	return p, nil
+}
+
+// handleModerationQueue lists the reported pastes, the bans and the latest
+// moderation actions. ?all=1 includes pastes whose reports were resolved.
+func (s *webServer) handleModerationQueue(w http.ResponseWriter, r *http.Request) {
+	s.writeModerationQueue(w, r, http.StatusOK, "")
+}
+
+// writeModerationQueue writes the moderation page with an error message, if any.
+func (s *webServer) writeModerationQueue(w http.ResponseWriter, r *http.Request, status int, message string) {
+	all, _ := strconv.ParseBool(r.URL.Query().Get("all"))
+	q := &render.ModerationQueue{Account: s.account(r), All: all, Bans: s.mod.Bans(), Error: message}
+	for _, key := range s.mod.Reported(all) {
+		p, err := s.reportedPaste(key)
+		if err != nil {
+			writeLoadError(w, key, err)
+			return
+		}
+		q.Pastes = append(q.Pastes, p)
+	}
+	audit, err := s.mod.Audit(auditLimit)
+	if err != nil {
+		log.Printf("could not read the audit trail: %v", err)
+	}
+	q.Audit = audit
+	writeHTML(w, status, func(w io.Writer) error {
+		return render.WriteModerationQueue(w, q)
+	})
+}
+
+// handleModeratedPaste shows the metadata of a paste and the reports about it.
+func (s *webServer) handleModeratedPaste(w http.ResponseWriter, r *http.Request) {
+	s.writeReportedPaste(w, r, http.StatusOK, "")
+}
+
+// writeReportedPaste writes the moderation page of the paste named by the
+// route, with an error message, if any.
+func (s *webServer) writeReportedPaste(w http.ResponseWriter, r *http.Request, status int, message string) {
+	key := chi.URLParam(r, "key")
+	p, err := s.reportedPaste(key)
+	if err != nil {
+		writeLoadError(w, key, err)
+		return
+	}
+	p.Account = s.account(r)
+	p.Error = message
+	writeHTML(w, status, func(w io.Writer) error {
+		return render.WriteReportedPaste(w, p)
+	})
+}
+
+// handleModeratedRaw serves the content of a paste to moderators, even if it
+// is hidden. Reading it does not burn it.
+func (s *webServer) handleModeratedRaw(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "key")
+	meta, err := s.moderatedMeta(key)
+	if err != nil {
+		writeLoadError(w, key, err)
+		return
+	}
+	body, err := s.readPaste(key)
+	if err != nil {
+		writeLoadError(w, key, err)
+		return
+	}
+	s.writeRaw(w, r, key, body, meta)
+}
+
+// handleModerate takes the action posted from a paste's moderation page.
+func (s *webServer) handleModerate(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUnlockFormBytes)
+	key := chi.URLParam(r, "key")
+	action := r.PostFormValue("action")
+	_, err := s.moderatePaste(requestKey(r), key, action, r.PostFormValue("reason"))
+	switch {
+	case errors.Is(err, errUnknownAction), errors.Is(err, errNoSubmitter):
+		s.writeReportedPaste(w, r, http.StatusBadRequest, "Could not "+action+": "+err.Error())
+	case err != nil:
+		writeLoadError(w, key, err)
+	case action == actionDelete:
+		http.Redirect(w, r, "/admin/moderation", http.StatusSeeOther)
+	default:
+		http.Redirect(w, r, "/admin/moderation/"+key, http.StatusSeeOther)
+	}
+}
+
+// handleBan places a ban posted from the moderation page.
+func (s *webServer) handleBan(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUnlockFormBytes)
+	_, err := s.banClient(requestKey(r), r.PostFormValue("kind"), r.PostFormValue("value"),
+		r.PostFormValue("reason"), r.PostFormValue("expires_in"))
+	if err != nil {
+		s.writeModerationQueue(w, r, http.StatusBadRequest, "Could not ban: "+err.Error())
+		return
+	}
+	http.Redirect(w, r, "/admin/moderation", http.StatusSeeOther)
+}
+
+// handleUnban lifts a ban from the moderation page.
+func (s *webServer) handleUnban(w http.ResponseWriter, r *http.Request) {
+	if _, err := s.unbanClient(requestKey(r), chi.URLParam(r, "id")); err != nil {
+		s.writeModerationQueue(w, r, http.StatusNotFound, "Could not lift the ban: "+err.Error())
+		return
+	}
+	http.Redirect(w, r, "/admin/moderation", http.StatusSeeOther)
+}
+
+// apiModerationRoutes registers the moderation API, which needs an admin key.
+func (s *webServer) apiModerationRoutes(router chi.Router) {
+	router.Use(s.requireAdmin(func(w http.ResponseWriter, r *http.Request, status int, message string) {
+		writeAPIAuthError(w, status, message)
+	}))
+	router.Get("/reports", s.handleAPIModerationQueue)
+	router.Get("/pastes/{id}", s.handleAPIModeratedPaste)
+	router.Post("/pastes/{id}", s.handleAPIModerate)
+	router.Get("/bans", s.handleAPIBans)
+	router.Post("/bans", s.handleAPIBan)
+	router.Delete("/bans/{id}", s.handleAPIUnban)
+	router.Get("/audit", s.handleAPIAudit)
+}
+
+// apiModeratedPaste is the JSON representation of a paste and the reports
+// about it, for moderators.
+type apiModeratedPaste struct {
+	ID string `json:"id"`
+
+	// Paste is nil if the paste no longer exists.
+	Paste *apiPaste `json:"paste,omitempty"`
+
+	KeyID    string `json:"key_id,omitempty"`
+	SourceIP string `json:"source_ip,omitempty"`
+
+	Reports []moderation.Report `json:"reports"`
+}
+
+// apiModeratedPaste describes the paste at key and the reports about it.
+func (s *webServer) apiModeratedPaste(key string) (*apiModeratedPaste, error) {
+	p := &apiModeratedPaste{ID: key, Reports: s.mod.Reports(key)}
+	if p.Reports == nil {
+		p.Reports = []moderation.Report{}
+	}
+	meta, err := s.moderatedMeta(key)
+	switch {
+	case errors.Is(err, backends.ErrNotFound):
+		return p, nil
+	case err != nil:
+		return nil, err
+	}
+	p.Paste = s.apiPaste(key, meta)
+	p.Paste.Owner = meta.Owner
+	p.KeyID = meta.KeyID
+	p.SourceIP = meta.SourceIP
+	return p, nil
+}
+
+// handleAPIModerationQueue lists the pastes with open reports, or with
+// ?all=true, every reported paste, most recently reported first.
+func (s *webServer) handleAPIModerationQueue(w http.ResponseWriter, r *http.Request) {
+	all, _ := strconv.ParseBool(r.URL.Query().Get("all"))
+	list := []*apiModeratedPaste{}
+	for _, key := range s.mod.Reported(all) {
+		p, err := s.apiModeratedPaste(key)
+		if err != nil {
+			writeAPILoadError(w, key, err)
+			return
+		}
+		list = append(list, p)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"pastes": list})
+}
+
+// handleAPIModeratedPaste returns a paste, including hidden ones, with the
+// reports about it.
+func (s *webServer) handleAPIModeratedPaste(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "id")
+	p, err := s.apiModeratedPaste(key)
+	if err != nil {
+		writeAPILoadError(w, key, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+// apiModerateRequest is the JSON body of a moderation action.
+type apiModerateRequest struct {
+	Action string `json:"action"`
+	Reason string `json:"reason"`
+}
+
+// handleAPIModerate takes action on a paste and returns it as it is afterwards.
+func (s *webServer) handleAPIModerate(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "id")
+	var req apiModerateRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxUnlockFormBytes)).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body: "+err.Error())
+		return
+	}
+	_, err := s.moderatePaste(requestKey(r), key, req.Action, req.Reason)
+	switch {
+	case errors.Is(err, errUnknownAction):
+		writeAPIError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("Unknown action %q", req.Action))
+		return
+	case errors.Is(err, errNoSubmitter):
+		writeAPIError(w, http.StatusConflict, "invalid_request", "The paste does not record who uploaded it")
+		return
+	case err != nil:
+		writeAPILoadError(w, key, err)
+		return
+	}
+	s.handleAPIModeratedPaste(w, r)
+}
+
+// handleAPIBans lists the bans that have not expired.
+func (s *webServer) handleAPIBans(w http.ResponseWriter, r *http.Request) {
+	bans := s.mod.Bans()
+	if bans == nil {
+		bans = []moderation.Ban{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"bans": bans})
+}
+
+// apiBanRequest is the JSON body of a ban request.
+type apiBanRequest struct {
+	Kind      string          `json:"kind"`
+	Value     string          `json:"value"`
+	Reason    string          `json:"reason"`
+	ExpiresIn json.RawMessage `json:"expires_in"`
+}
+
+// handleAPIBan places a ban.
+func (s *webServer) handleAPIBan(w http.ResponseWriter, r *http.Request) {
+	var req apiBanRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxUnlockFormBytes)).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body: "+err.Error())
+		return
+	}
+	var expiresIn string
+	if len(req.ExpiresIn) > 0 && json.Unmarshal(req.ExpiresIn, &expiresIn) != nil {
+		expiresIn = string(req.ExpiresIn)
+	}
+	ban, err := s.banClient(requestKey(r), req.Kind, req.Value, req.Reason, expiresIn)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_request", "Invalid ban: "+err.Error())
+		return
+	}
+	w.Header().Set("Location", apiPrefix+"/moderation/bans/"+ban.ID)
+	writeJSON(w, http.StatusCreated, ban)
+}
+
+// handleAPIUnban lifts a ban.
+func (s *webServer) handleAPIUnban(w http.ResponseWriter, r *http.Request) {
+	_, err := s.unbanClient(requestKey(r), chi.URLParam(r, "id"))
+	switch {
+	case errors.Is(err, moderation.ErrNotFound):
+		writeAPIError(w, http.StatusNotFound, "not_found", "Ban not found")
+		return
+	case err != nil:
+		writeAPIError(w, http.StatusInternalServerError, "backend_error", "Could not lift the ban")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAPIAudit returns the latest moderation actions, newest first. ?limit=
+// bounds the number returned, which defaults to 100.
+func (s *webServer) handleAPIAudit(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 {
+			writeAPIError(w, http.StatusBadRequest, "invalid_request", "Invalid limit")
+			return
+		}
+		limit = n
+	}
+	entries, err := s.mod.Audit(limit)
+	if err != nil {
+		log.Printf("could not read the audit trail: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, "backend_error", "Could not read the audit trail")
+		return
+	}
+	if entries == nil {
+		entries = []moderation.AuditEntry{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"entries": entries})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cbrnrd/pasted/pkg/auth"
+	"github.com/cbrnrd/pasted/pkg/backends"
+	"github.com/cbrnrd/pasted/pkg/config"
+	"github.com/cbrnrd/pasted/pkg/ipfilter"
+	"github.com/cbrnrd/pasted/pkg/moderation"
+)
+
+// TestModerationFormsRefuseOtherOrigins checks that a page on another origin
+// cannot ban a client with the session of a logged-in moderator.
+func TestModerationFormsRefuseOtherOrigins(t *testing.T) {
+	mod, err := moderation.NewStore("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := ipfilter.New(ipfilter.Rules{}, "", ipfilter.AutoBan{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &webServer{
+		backend:  backends.NewMemoryBackend(),
+		cfg:      &config.CLIConfig{Domain: "https://pasted.test"},
+		mod:      mod,
+		filter:   filter,
+		sessions: auth.NewSessions([]byte("secret")),
+	}
+	router := s.routes(nil)
+	session, err := s.sessions.Encode(sessionCookie, auth.Identity{Subject: "mod", Scopes: []auth.Scope{auth.ScopeAdmin}}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ban := func(origin, ip string) int {
+		form := url.Values{"kind": {"ip"}, "value": {ip}, "reason": {"spam"}}
+		r := httptest.NewRequest(http.MethodPost, "/admin/bans", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Origin", origin)
+		r.AddCookie(&http.Cookie{Name: sessionCookie, Value: session})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := ban("https://evil.pasted.test", "192.0.2.1"); code != http.StatusForbidden {
+		t.Errorf("ban from another origin: status %d, want %d", code, http.StatusForbidden)
+	}
+	if mod.Banned("", "192.0.2.1") != nil {
+		t.Error("a page on another origin banned a client")
+	}
+
+	if code := ban("https://pasted.test", "192.0.2.2"); code != http.StatusSeeOther {
+		t.Errorf("ban from the moderation page: status %d, want %d", code, http.StatusSeeOther)
+	}
+	if mod.Banned("", "192.0.2.2") == nil {
+		t.Error("the moderation page could not ban a client")
+	}
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cbrnrd/pasted/pkg/moderation"
+	"github.com/urfave/cli/v3"
+)
+
+var moderationServerFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:     "server",
+		Usage:    "URL of the pasted web server",
+		Sources:  cli.EnvVars("PASTED_SERVER"),
+		Required: true,
+	},
+	&cli.StringFlag{
+		Name:     "token",
+		Usage:    "Admin API key",
+		Sources:  cli.EnvVars("PASTED_TOKEN"),
+		Required: true,
+	},
+}
+
+var moderationReasonFlag = &cli.StringFlag{
+	Name:  "reason",
+	Usage: "Reason, recorded in the audit trail",
+}
+
+// moderationActionCommand returns the command that takes action on a paste.
+func moderationActionCommand(action, usage string) *cli.Command {
+	return &cli.Command{
+		Name:      strings.ReplaceAll(action, "_", "-"),
+		Usage:     usage,
+		ArgsUsage: "KEY",
+		Flags:     append([]cli.Flag{moderationReasonFlag}, moderationServerFlags...),
+		Action: func(ctx context.Context, c *cli.Command) error {
+			key := c.Args().First()
+			if key == "" {
+				return fmt.Errorf("the key of the paste is required")
+			}
+			var p apiModeratedPaste
+			req := apiModerateRequest{Action: action, Reason: c.String("reason")}
+			if err := moderationRequest(ctx, c, http.MethodPost, "/moderation/pastes/"+url.PathEscape(key), req, &p); err != nil {
+				return err
+			}
+			return printModeratedPaste(&p)
+		},
+	}
+}
+
+var moderationCommand = &cli.Command{
+	Name:  "moderation",
+	Usage: "Review abuse reports and moderate pastes on a running server",
+	Commands: []*cli.Command{
+		{
+			Name:  "reports",
+			Usage: "List reported pastes",
+			Flags: append([]cli.Flag{
+				&cli.BoolFlag{
+					Name:  "all",
+					Usage: "Include pastes whose reports were resolved",
+				},
+			}, moderationServerFlags...),
+			Action: listReportedPastes,
+		},
+		{
+			Name:      "show",
+			Usage:     "Show the metadata of a paste and the reports about it",
+			ArgsUsage: "KEY",
+			Flags:     moderationServerFlags,
+			Action:    showModeratedPaste,
+		},
+		{
+			Name:      "report",
+			Usage:     "Record a report about a paste, e.g. one received by email",
+			ArgsUsage: "KEY",
+			Flags: append([]cli.Flag{
+				&cli.StringFlag{
+					Name:     "reason",
+					Usage:    "What is wrong with the paste",
+					Required: true,
+				},
+			}, moderationServerFlags...),
+			Action: reportPaste,
+		},
+		moderationActionCommand(actionHide, "Hide a paste, so that it is no longer served"),
+		moderationActionCommand(actionUnhide, "Serve a hidden paste again"),
+		moderationActionCommand(actionDelete, "Delete a paste"),
+		moderationActionCommand(actionDismiss, "Close the reports about a paste without acting on it"),
+		moderationActionCommand(actionBanIP, "Ban the address a paste was uploaded from"),
+		moderationActionCommand(actionBanKey, "Ban the API key or login a paste was created with"),
+		{
+			Name:  "ban",
+			Usage: "Ban an address, a network or a key from uploading",
+			Flags: append([]cli.Flag{
+				&cli.StringFlag{
+					Name:  "ip",
+					Usage: "Address or network in CIDR notation to ban",
+				},
+				&cli.StringFlag{
+					Name:  "key",
+					Usage: "ID of the API key to ban, as shown by `moderation show`",
+				},
+				moderationReasonFlag,
+				&cli.DurationFlag{
+					Name:  "expires-in",
+					Usage: "Lifetime of the ban; bans do not expire by default",
+				},
+			}, moderationServerFlags...),
+			Action: banClient,
+		},
+		{
+			Name:      "unban",
+			Usage:     "Lift a ban",
+			ArgsUsage: "ID",
+			Flags:     moderationServerFlags,
+			Action:    unbanClient,
+		},
+		{
+			Name:   "bans",
+			Usage:  "List bans",
+			Flags:  moderationServerFlags,
+			Action: listBans,
+		},
+		{
+			Name:  "audit",
+			Usage: "Show the latest moderation actions",
+			Flags: append([]cli.Flag{
+				&cli.IntFlag{
+					Name:  "limit",
+					Usage: "Number of actions to show",
+					Value: 50,
+				},
+			}, moderationServerFlags...),
+			Action: showAudit,
+		},
+	},
+}
+
+// moderationRequest sends a request to the API of the server given with
+// --server and decodes the JSON response into out, which may be nil.
+func moderationRequest(ctx context.Context, c *cli.Command, method, path string, body, out any) error {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.String("server"), "/")+apiPrefix+path, &reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.String("token"))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var e apiError
+		if json.NewDecoder(resp.Body).Decode(&e) == nil && e.Error.Message != "" {
+			return fmt.Errorf("%s: %s", resp.Status, e.Error.Message)
+		}
+		return fmt.Errorf("%s", resp.Status)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func listReportedPastes(ctx context.Context, c *cli.Command) error {
+	var list struct {
+		Pastes []apiModeratedPaste `json:"pastes"`
+	}
+	path := "/moderation/reports"
+	if c.Bool("all") {
+		path += "?all=true"
+	}
+	if err := moderationRequest(ctx, c, http.MethodGet, path, nil, &list); err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tSTATUS\tOWNER\tADDRESS\tOPEN\tREPORTS\tLATEST REASON")
+	for _, p := range list.Pastes {
+		open, latest := 0, ""
+		for _, r := range p.Reports {
+			if r.Open() {
+				open++
+			}
+			latest = r.Reason
+		}
+		owner := ""
+		if p.Paste != nil {
+			owner = p.Paste.Owner
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\t%s\n", p.ID, moderatedStatus(&p), owner, p.SourceIP,
+			open, len(p.Reports), oneLine(latest, 60))
+	}
+	return tw.Flush()
+}
+
+func showModeratedPaste(ctx context.Context, c *cli.Command) error {
+	key := c.Args().First()
+	if key == "" {
+		return fmt.Errorf("the key of the paste is required")
+	}
+	var p apiModeratedPaste
+	if err := moderationRequest(ctx, c, http.MethodGet, "/moderation/pastes/"+url.PathEscape(key), nil, &p); err != nil {
+		return err
+	}
+	return printModeratedPaste(&p)
+}
+
+func reportPaste(ctx context.Context, c *cli.Command) error {
+	key := c.Args().First()
+	if key == "" {
+		return fmt.Errorf("the key of the paste is required")
+	}
+	var report apiReport
+	req := apiReportRequest{Reason: c.String("reason")}
+	if err := moderationRequest(ctx, c, http.MethodPost, "/pastes/"+url.PathEscape(key)+"/report", req, &report); err != nil {
+		return err
+	}
+	fmt.Println(report.ID)
+	return nil
+}
+
+// printModeratedPaste prints the metadata of a paste and the reports about it.
+func printModeratedPaste(p *apiModeratedPaste) error {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Key:\t%s\n", p.ID)
+	fmt.Fprintf(tw, "Status:\t%s\n", moderatedStatus(p))
+	if paste := p.Paste; paste != nil {
+		fmt.Fprintf(tw, "URL:\t%s\n", paste.URL)
+		fmt.Fprintf(tw, "Content type:\t%s\n", paste.ContentType)
+		fmt.Fprintf(tw, "Created:\t%s\n", paste.CreatedAt.Format(time.RFC3339))
+		if paste.ExpiresAt != nil {
+			fmt.Fprintf(tw, "Expires:\t%s\n", paste.ExpiresAt.Format(time.RFC3339))
+		}
+		if paste.Namespace != "" {
+			fmt.Fprintf(tw, "Namespace:\t%s\n", paste.Namespace)
+		}
+		if paste.Owner != "" {
+			fmt.Fprintf(tw, "Owner:\t%s\n", paste.Owner)
+		}
+		if len(paste.Flags) > 0 {
+			fmt.Fprintf(tw, "Flags:\t%s\n", strings.Join(paste.Flags, ", "))
+		}
+	}
+	if p.KeyID != "" {
+		fmt.Fprintf(tw, "Key ID:\t%s\n", p.KeyID)
+	}
+	if p.SourceIP != "" {
+		fmt.Fprintf(tw, "Address:\t%s\n", p.SourceIP)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if len(p.Reports) == 0 {
+		return nil
+	}
+
+	fmt.Println()
+	tw = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RECEIVED\tREPORTER\tRESOLUTION\tREASON")
+	for _, r := range p.Reports {
+		reporter := r.Reporter
+		if reporter == "" {
+			reporter = r.ReporterIP
+		}
+		resolution := r.Resolution
+		if r.Open() {
+			resolution = "open"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.CreatedAt.Format(time.RFC3339), reporter, resolution, oneLine(r.Reason, 0))
+	}
+	return tw.Flush()
+}
+
+// moderatedStatus describes whether a paste is served.
+func moderatedStatus(p *apiModeratedPaste) string {
+	switch {
+	case p.Paste == nil:
+		return "gone"
+	case p.Paste.Hidden:
+		return "hidden"
+	default:
+		return "visible"
+	}
+}
+
+func banClient(ctx context.Context, c *cli.Command) error {
+	req := apiBanRequest{Kind: string(moderation.BanIP), Value: c.String("ip"), Reason: c.String("reason")}
+	switch {
+	case req.Value != "" && c.String("key") != "":
+		return fmt.Errorf("only one of --ip and --key can be given")
+	case c.String("key") != "":
+		req.Kind, req.Value = string(moderation.BanKey), c.String("key")
+	case req.Value == "":
+		return fmt.Errorf("--ip or --key is required")
+	}
+	if lifetime := c.Duration("expires-in"); lifetime > 0 {
+		req.ExpiresIn = json.RawMessage(strconv.Quote(lifetime.String()))
+	}
+	var ban moderation.Ban
+	if err := moderationRequest(ctx, c, http.MethodPost, "/moderation/bans", req, &ban); err != nil {
+		return err
+	}
+	fmt.Println(ban.ID)
+	return nil
+}
+
+func unbanClient(ctx context.Context, c *cli.Command) error {
+	id := c.Args().First()
+	if id == "" {
+		return fmt.Errorf("the id of the ban is required")
+	}
+	return moderationRequest(ctx, c, http.MethodDelete, "/moderation/bans/"+url.PathEscape(id), nil, nil)
+}
+
+func listBans(ctx context.Context, c *cli.Command) error {
+	var list struct {
+		Bans []moderation.Ban `json:"bans"`
+	}
+	if err := moderationRequest(ctx, c, http.MethodGet, "/moderation/bans", nil, &list); err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tKIND\tVALUE\tBY\tCREATED\tEXPIRES\tREASON")
+	for _, b := range list.Bans {
+		expires := "never"
+		if b.ExpiresAt != nil {
+			expires = b.ExpiresAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", b.ID, b.Kind, b.Value, b.By,
+			b.CreatedAt.Format(time.RFC3339), expires, oneLine(b.Reason, 60))
+	}
+	return tw.Flush()
+}
+
+func showAudit(ctx context.Context, c *cli.Command) error {
+	var list struct {
+		Entries []moderation.AuditEntry `json:"entries"`
+	}
+	path := "/moderation/audit?limit=" + strconv.FormatInt(c.Int("limit"), 10)
+	if err := moderationRequest(ctx, c, http.MethodGet, path, nil, &list); err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tMODERATOR\tACTION\tTARGET\tREASON")
+	for _, e := range list.Entries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", e.Time.Format(time.RFC3339), e.Actor, e.Action, e.Target, oneLine(e.Reason, 60))
+	}
+	return tw.Flush()
+}
+
+// oneLine joins the lines of s for a table cell and shortens it to max
+// runes, unless max is zero.
+func oneLine(s string, max int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); max > 0 && len(r) > max {
+		return string(r[:max-1]) + "…"
+	}
+	return s
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/cbrnrd/pasted/pkg/auth"
+	"github.com/cbrnrd/pasted/pkg/backends"
+	"github.com/cbrnrd/pasted/pkg/metrics"
+	"github.com/cbrnrd/pasted/pkg/render"
+	"github.com/go-chi/chi/v5"
+)
+
+// handleMyPastes lists the pastes owned by the user who is logged in, or
+// with ?namespace=, the pastes in a namespace the user is a member of.
+func (s *webServer) handleMyPastes(w http.ResponseWriter, r *http.Request) {
+	key := requestKey(r)
+	switch {
+	case key == nil:
+		http.Redirect(w, r, "/auth/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+		return
+	case !key.Has(auth.ScopeRead):
+		metrics.AuthFailures.Add(1)
+		http.Error(w, "You are not allowed to read pastes", http.StatusForbidden)
+		return
+	}
+
+	page := &render.MyPastes{
+		Account:    s.account(r),
+		Owner:      key.OwnerName(),
+		Namespaces: s.cfg.MemberOf(key),
+		Expiries:   expiryOptions(&s.cfg.Expiry),
+	}
+	filter := backends.Filter{Owner: page.Owner}
+	if namespace := r.URL.Query().Get("namespace"); namespace != "" {
+		if !slices.Contains(page.Namespaces, namespace) {
+			http.Error(w, "No such namespace", http.StatusNotFound)
+			return
+		}
+		page.Namespace = namespace
+		page.Expiries = expiryOptions(s.cfg.ExpiryFor(namespace))
+		filter = backends.Filter{Namespace: namespace}
+	}
+
+	pastes, err := s.listPastes(filter)
+	if err != nil {
+		writeLoadError(w, "", err)
+		return
+	}
+	for _, p := range pastes {
+		page.Pastes = append(page.Pastes, render.ListedPaste{
+			Key:           p.key,
+			URL:           pastePrefix(p.meta.Namespace) + p.key,
+			Owner:         p.meta.Owner,
+			Namespace:     p.meta.Namespace,
+			Language:      p.meta.Language,
+			CreatedAt:     p.meta.CreatedAt,
+			ExpiresAt:     p.meta.ExpiresAt,
+			BurnAfterRead: p.meta.BurnAfterRead,
+			Password:      p.meta.PasswordHash != "",
+		})
+	}
+	writeHTML(w, http.StatusOK, func(w io.Writer) error {
+		return render.WriteMyPastes(w, page)
+	})
+}
+
+// handleMyDelete deletes a paste from the list of the user's pastes.
+func (s *webServer) handleMyDelete(w http.ResponseWriter, r *http.Request) {
+	key, meta, ok := s.managedPaste(w, r)
+	if !ok {
+		return
+	}
+	if err := s.deletePaste(key, meta); err != nil {
+		writeLoadError(w, key, err)
+		return
+	}
+	redirectToMyPastes(w, r)
+}
+
+// handleMyExtend changes the expiry of a paste from the list of the user's
+// pastes. The new expiry counts from now.
+func (s *webServer) handleMyExtend(w http.ResponseWriter, r *http.Request) {
+	key, meta, ok := s.managedPaste(w, r)
+	if !ok {
+		return
+	}
+	expiresAt, err := expiryTime(s.cfg, meta.Namespace, r.PostFormValue("expires_in"))
+	if err != nil {
+		http.Error(w, "Invalid expiry: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	meta.ExpiresAt = expiresAt
+	if err := s.backend.Update(key, meta); err != nil {
+		writeLoadError(w, key, err)
+		return
+	}
+	redirectToMyPastes(w, r)
+}
+
+// managedPaste returns the paste named by the route, if the user who is
+// logged in can manage it. Otherwise it writes an error.
+func (s *webServer) managedPaste(w http.ResponseWriter, r *http.Request) (string, *backends.Metadata, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUnlockFormBytes)
+	key := chi.URLParam(r, "key")
+	apiKey := requestKey(r)
+	if apiKey == nil {
+		http.Error(w, "Log in to manage pastes", http.StatusUnauthorized)
+		return "", nil, false
+	}
+	meta, err := s.statPaste(key)
+	if err != nil {
+		writeLoadError(w, key, err)
+		return "", nil, false
+	}
+	if !s.canManage(apiKey, meta) {
+		metrics.AuthFailures.Add(1)
+		http.Error(w, "Not allowed to change this paste", http.StatusForbidden)
+		return "", nil, false
+	}
+	return key, meta, true
+}
+
+// redirectToMyPastes returns to the list a paste was managed from.
+func redirectToMyPastes(w http.ResponseWriter, r *http.Request) {
+	target := "/my"
+	if namespace := r.PostFormValue("namespace"); namespace != "" {
+		target += "?" + url.Values{"namespace": {namespace}}.Encode()
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// listedPaste is a paste in a list.
+type listedPaste struct {
+	key  string
+	meta *backends.Metadata
+}
+
+// listPastes returns the unexpired pastes that match filter, newest first.
+func (s *webServer) listPastes(filter backends.Filter) ([]listedPaste, error) {
+	pastes, err := s.backend.List(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	list := make([]listedPaste, 0, len(pastes))
+	for key, meta := range pastes {
+		if !meta.Expired(now) {
+			list = append(list, listedPaste{key, meta})
+		}
+	}
+	slices.SortFunc(list, func(a, b listedPaste) int {
+		return b.meta.CreatedAt.Compare(a.meta.CreatedAt)
+	})
+	return list, nil
+}
@@ -0,0 +1,178 @@
+package asciicast
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ContentType is the MIME type of an asciicast recording.
+const ContentType = "application/x-asciicast"
+
+// Event types.
+const (
+	EventOutput = "o"
+	EventInput  = "i"
+	EventResize = "r"
+	EventMarker = "m"
+)
+
+// Header is the first line of an asciicast v2 recording.
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Duration  float64           `json:"duration,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+
+	// IdleTimeLimit caps pauses between events during playback, in seconds.
+	IdleTimeLimit float64 `json:"idle_time_limit,omitempty"`
+}
+
+// Event is a single line of a recording after the header.
+type Event struct {
+	// Time is the number of seconds since the start of the recording.
+	Time float64
+
+	// Type is one of the Event constants.
+	Type string
+
+	// Data is the terminal output, input, resize ("80x24") or marker label.
+	Data string
+}
+
+// MarshalJSON encodes e as a [time, type, data] array.
+func (e Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]any{e.Time, e.Type, e.Data})
+}
+
+// UnmarshalJSON decodes a [time, type, data] array.
+func (e *Event) UnmarshalJSON(b []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if len(raw) != 3 {
+		return fmt.Errorf("event has %d fields, expected 3", len(raw))
+	}
+	if err := json.Unmarshal(raw[0], &e.Time); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw[1], &e.Type); err != nil {
+		return err
+	}
+	return json.Unmarshal(raw[2], &e.Data)
+}
+
+// Cast is a parsed recording.
+type Cast struct {
+	Header Header
+	Events []Event
+}
+
+// ErrNotCast is returned when the input is not an asciicast v2 recording.
+var ErrNotCast = errors.New("not an asciicast v2 recording")
+
+// Sniff reports whether sample starts with an asciicast v2 header. The
+// sample may be cut off after the header line.
+func Sniff(sample []byte) bool {
+	line, _, _ := bytes.Cut(sample, []byte("\n"))
+	var h Header
+	return json.Unmarshal(bytes.TrimSpace(line), &h) == nil && h.Version == 2 && h.Width > 0 && h.Height > 0
+}
+
+// Decode parses an asciicast v2 recording. Blank lines are skipped.
+func Decode(r io.Reader) (*Cast, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	if !sc.Scan() {
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+		return nil, ErrNotCast
+	}
+	var c Cast
+	if err := json.Unmarshal(sc.Bytes(), &c.Header); err != nil || c.Header.Version != 2 {
+		return nil, ErrNotCast
+	}
+	if c.Header.Width <= 0 || c.Header.Height <= 0 {
+		return nil, fmt.Errorf("%w: invalid terminal size %dx%d", ErrNotCast, c.Header.Width, c.Header.Height)
+	}
+
+	for n := 2; sc.Scan(); n++ {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		c.Events = append(c.Events, e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Duration returns the length of the recording in seconds.
+func (c *Cast) Duration() float64 {
+	if c.Header.Duration > 0 {
+		return c.Header.Duration
+	}
+	if len(c.Events) == 0 {
+		return 0
+	}
+	return c.Events[len(c.Events)-1].Time
+}
+
+// Writer writes a recording one event at a time. It is safe for concurrent use.
+type Writer struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewWriter writes the header to w and returns a Writer for the events.
+func NewWriter(w io.Writer, h Header) (*Writer, error) {
+	if h.Version == 0 {
+		h.Version = 2
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(h); err != nil {
+		return nil, err
+	}
+	return &Writer{enc: enc}, nil
+}
+
+// WriteEvent writes a single event.
+func (w *Writer) WriteEvent(e Event) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.enc.Encode(e)
+}
+
+// LimitIdle shortens pauses between events to at most limit seconds.
+func (c *Cast) LimitIdle(limit float64) {
+	if limit <= 0 {
+		return
+	}
+	prev, shift := 0.0, 0.0
+	for i := range c.Events {
+		t := c.Events[i].Time
+		if gap := t - prev; gap > limit {
+			shift += gap - limit
+		}
+		prev = t
+		c.Events[i].Time = t - shift
+	}
+	c.Header.Duration = 0
+}
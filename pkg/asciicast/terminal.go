@@ -0,0 +1,108 @@
+package asciicast
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Cell is a character on the screen. Colors are xterm-256 palette indexes or
+// -1 for the terminal default. A reversed cell with a default color uses 256
+// for the default background as foreground and 257 for the default
+// foreground as background.
+type Cell struct {
+	Char      rune
+	FG, BG    int
+	Bold      bool
+	Italic    bool
+	Underline bool
+}
+
+// Screen is a snapshot of the terminal, one slice of cells per row.
+type Screen [][]Cell
+
+// String returns the text on the screen with trailing spaces and blank rows removed.
+func (s Screen) String() string {
+	lines := make([]string, len(s))
+	for y, row := range s {
+		var b strings.Builder
+		for _, c := range row {
+			b.WriteRune(c.Char)
+		}
+		lines[y] = strings.TrimRight(b.String(), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// Replay plays the output and resize events of c through a terminal emulator.
+// fn is called with the screen after the events at each point in time, with
+// events less than interval seconds apart coalesced into one call.
+func Replay(c *Cast, interval float64, fn func(t float64, s Screen)) {
+	term := newEmulator(c.Header.Width, c.Header.Height)
+
+	// Output may split a UTF-8 sequence across events.
+	var pending []byte
+	last, dirty := 0.0, false
+	for _, e := range c.Events {
+		if dirty && e.Time-last >= interval {
+			fn(last, term.screen())
+			dirty = false
+		}
+		switch e.Type {
+		case EventOutput:
+			pending = append(pending, e.Data...)
+			n := len(pending)
+			if i := lastRuneStart(pending); !utf8.FullRune(pending[i:]) {
+				n = i
+			}
+			term.write(pending[:n])
+			pending = append(pending[:0], pending[n:]...)
+		case EventResize:
+			var cols, rows int
+			if _, err := fmt.Sscanf(e.Data, "%dx%d", &cols, &rows); err != nil || cols <= 0 || rows <= 0 {
+				continue
+			}
+			term.resize(cols, rows)
+		default:
+			continue
+		}
+		if !dirty {
+			last = e.Time
+		}
+		dirty = true
+	}
+	if dirty || len(c.Events) == 0 {
+		fn(last, term.screen())
+	}
+}
+
+// emulator is a virtual terminal that output is played through.
+type emulator interface {
+	write(p []byte)
+	resize(cols, rows int)
+	screen() Screen
+}
+
+// lastRuneStart returns the index of the start of the last rune in b, or
+// len(b) if b is empty or does not end in a rune start within UTFMax bytes.
+func lastRuneStart(b []byte) int {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			return i
+		}
+	}
+	return len(b)
+}
+
+// FinalFrame returns the screen at the end of the recording.
+func FinalFrame(c *Cast) Screen {
+	var final Screen
+	Replay(c, 0, func(_ float64, s Screen) { final = s })
+	return final
+}
@@ -0,0 +1,77 @@
+//go:build !(linux || darwin || dragonfly || solaris || openbsd || netbsd || freebsd)
+
+package asciicast
+
+import (
+	"regexp"
+	"strings"
+)
+
+// escapeSequence matches CSI, OSC and other escape sequences.
+var escapeSequence = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// lineEmulator approximates a terminal where no VT emulator is available.
+// Escape sequences are dropped and the screen shows the last lines of output.
+type lineEmulator struct {
+	cols, rows int
+	lines      []string
+
+	// returned is set by a carriage return; the next character overwrites the line.
+	returned bool
+}
+
+// newEmulator returns a line-based emulator; vt10x does not build on this platform.
+func newEmulator(cols, rows int) emulator {
+	return &lineEmulator{cols: cols, rows: rows, lines: []string{""}}
+}
+
+func (e *lineEmulator) write(p []byte) {
+	text := escapeSequence.ReplaceAllString(string(p), "")
+	for _, r := range text {
+		cur := len(e.lines) - 1
+		switch r {
+		case '\n':
+			e.lines = append(e.lines, "")
+			e.returned = false
+		case '\r':
+			e.returned = true
+		case '\b':
+			if line := []rune(e.lines[cur]); len(line) > 0 {
+				e.lines[cur] = string(line[:len(line)-1])
+			}
+		default:
+			if r < ' ' {
+				continue
+			}
+			if e.returned {
+				e.lines[cur], e.returned = "", false
+			}
+			e.lines[cur] += string(r)
+		}
+	}
+	if len(e.lines) > e.rows {
+		e.lines = e.lines[len(e.lines)-e.rows:]
+	}
+}
+
+func (e *lineEmulator) resize(cols, rows int) {
+	e.cols, e.rows = cols, rows
+}
+
+func (e *lineEmulator) screen() Screen {
+	s := make(Screen, e.rows)
+	for y := range s {
+		s[y] = make([]Cell, e.cols)
+		var line []rune
+		if y < len(e.lines) {
+			line = []rune(strings.TrimRight(e.lines[y], " "))
+		}
+		for x := range s[y] {
+			s[y][x] = Cell{Char: ' ', FG: -1, BG: -1}
+			if x < len(line) {
+				s[y][x].Char = line[x]
+			}
+		}
+	}
+	return s
+}
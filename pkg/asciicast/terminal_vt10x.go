@@ -0,0 +1,68 @@
+//go:build linux || darwin || dragonfly || solaris || openbsd || netbsd || freebsd
+
+package asciicast
+
+import "github.com/hinshun/vt10x"
+
+// Glyph attribute bits, as set by vt10x in Glyph.Mode.
+const (
+	modeUnderline = 1 << 1
+	modeBold      = 1 << 2
+	modeItalic    = 1 << 4
+)
+
+type vtEmulator struct {
+	term vt10x.Terminal
+}
+
+// newEmulator returns a VT100/xterm emulator.
+func newEmulator(cols, rows int) emulator {
+	return &vtEmulator{term: vt10x.New(vt10x.WithSize(cols, rows))}
+}
+
+func (e *vtEmulator) write(p []byte) {
+	e.term.Write(p)
+}
+
+func (e *vtEmulator) resize(cols, rows int) {
+	e.term.Resize(cols, rows)
+}
+
+func (e *vtEmulator) screen() Screen {
+	term := e.term
+	term.Lock()
+	defer term.Unlock()
+
+	cols, rows := term.Size()
+	s := make(Screen, rows)
+	for y := range s {
+		s[y] = make([]Cell, cols)
+		for x := range s[y] {
+			g := term.Cell(x, y)
+			if g.Char == 0 {
+				g.Char = ' '
+			}
+			s[y][x] = Cell{
+				Char:      g.Char,
+				FG:        cellColor(g.FG, vt10x.DefaultBG, 256),
+				BG:        cellColor(g.BG, vt10x.DefaultFG, 257),
+				Bold:      g.Mode&modeBold != 0,
+				Italic:    g.Mode&modeItalic != 0,
+				Underline: g.Mode&modeUnderline != 0,
+			}
+		}
+	}
+	return s
+}
+
+// cellColor converts a vt10x color. swapped is the default color of the other
+// layer, which appears here when the cell is reversed, and is mapped to reversed.
+func cellColor(c, swapped vt10x.Color, reversed int) int {
+	switch {
+	case c == swapped:
+		return reversed
+	case c > 255:
+		return -1
+	}
+	return int(c)
+}
@@ -0,0 +1,186 @@
+// Package auth authenticates clients with API keys, and users of the web
+// interface with OpenID Connect single sign-on. Keys are stored as hashes, in
+// the main configuration or in a keys file that the admin commands maintain.
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cbrnrd/pasted/pkg/util"
+)
+
+// Scope is an operation a key is allowed to perform.
+type Scope string
+
+const (
+	// ScopeRead allows reading pastes and listing the key's own pastes.
+	ScopeRead Scope = "read"
+
+	// ScopeWrite allows creating pastes.
+	ScopeWrite Scope = "write"
+
+	// ScopeAdmin allows everything, including deleting any paste.
+	ScopeAdmin Scope = "admin"
+)
+
+// ParseScope parses the name of a scope.
+func ParseScope(s string) (Scope, error) {
+	switch scope := Scope(strings.ToLower(strings.TrimSpace(s))); scope {
+	case ScopeRead, ScopeWrite, ScopeAdmin:
+		return scope, nil
+	default:
+		return "", fmt.Errorf("unknown scope %q", s)
+	}
+}
+
+// TokenPrefix starts every API key, so that keys can be recognized in a TCP
+// upload and by secret scanners.
+const TokenPrefix = "pasted_"
+
+var (
+	// ErrInvalidKey is returned for tokens that do not match an active key.
+	ErrInvalidKey = errors.New("invalid API key")
+
+	// ErrQuotaExceeded is returned when a key has used up its quota.
+	ErrQuotaExceeded = errors.New("API key quota exceeded")
+)
+
+// Key is an API key. Only the hash of its token is stored.
+type Key struct {
+	// ID names the key in logs and admin commands.
+	ID string `yaml:"id"`
+
+	// Hash is the hex SHA-256 hash of the token. Keys without one can only be
+	// used from the networks in IPs or with the certificates in CertSubjects.
+	Hash string `yaml:"hash,omitempty"`
+
+	// Owner is recorded on the pastes created with the key. Defaults to the ID.
+	Owner string `yaml:"owner,omitempty"`
+
+	// Scopes are the operations the key allows.
+	Scopes []Scope `yaml:"scopes"`
+
+	// IPs are networks, in CIDR notation or as single addresses, whose TCP
+	// uploads are authenticated as this key without a token.
+	IPs []string `yaml:"ips,omitempty"`
+
+	// CertSubjects are the subjects of client certificates, in RFC 2253 form
+	// (e.g. "CN=runner-1,O=CI"), that are authenticated as this key on TLS
+	// listeners.
+	CertSubjects []string `yaml:"cert_subjects,omitempty"`
+
+	// Namespace is the namespace that TCP uploads with the key are stored
+	// in, since they cannot choose one. The owner must be one of its members.
+	// Empty for the default keyspace.
+	Namespace string `yaml:"namespace,omitempty"`
+
+	// Quota limits what the key can upload.
+	Quota Quota `yaml:"quota,omitempty"`
+
+	CreatedAt time.Time  `yaml:"created_at"`
+	ExpiresAt *time.Time `yaml:"expires_at,omitempty"`
+	RevokedAt *time.Time `yaml:"revoked_at,omitempty"`
+}
+
+// Quota limits the uploads made with a key. Zero values are unlimited.
+type Quota struct {
+	// PastesPerHour is the number of pastes the key can create per hour.
+	PastesPerHour int `yaml:"pastes_per_hour,omitempty"`
+
+	// MaxPasteBytes is the largest paste the key can create.
+	MaxPasteBytes int64 `yaml:"max_paste_bytes,omitempty"`
+}
+
+// Has reports whether the key allows scope. Admin keys allow every scope.
+func (k *Key) Has(scope Scope) bool {
+	return slices.Contains(k.Scopes, scope) || slices.Contains(k.Scopes, ScopeAdmin)
+}
+
+// Active reports whether the key can be used at time now.
+func (k *Key) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// OwnerName returns the owner recorded on pastes created with the key.
+func (k *Key) OwnerName() string {
+	if k.Owner != "" {
+		return k.Owner
+	}
+	return k.ID
+}
+
+// matchesIP reports whether ip is in one of the key's networks.
+func (k *Key) matchesIP(ip net.IP) bool {
+	for _, s := range k.IPs {
+		if _, network, err := net.ParseCIDR(s); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if other := net.ParseIP(s); other != nil && other.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks the fields of a key loaded from a file.
+func (k *Key) validate() error {
+	if k.ID == "" {
+		return errors.New("key without an id")
+	}
+	if k.Hash == "" && len(k.IPs) == 0 && len(k.CertSubjects) == 0 {
+		return fmt.Errorf("key %s has no hash, ips or cert_subjects", k.ID)
+	}
+	for _, scope := range k.Scopes {
+		if _, err := ParseScope(string(scope)); err != nil {
+			return fmt.Errorf("key %s: %v", k.ID, err)
+		}
+	}
+	for _, s := range k.IPs {
+		if _, _, err := net.ParseCIDR(s); err != nil && net.ParseIP(s) == nil {
+			return fmt.Errorf("key %s: invalid network %q", k.ID, s)
+		}
+	}
+	return nil
+}
+
+// CertPolicy applies to verified client certificates whose subject no key
+// lists in CertSubjects.
+type CertPolicy struct {
+	// RequireKey rejects such certificates. By default they can upload.
+	RequireKey bool `yaml:"require_key"`
+
+	// Quota limits the uploads made with each certificate subject.
+	Quota Quota `yaml:"quota"`
+}
+
+// CertKey returns the key for a verified client certificate with subject that
+// no configured key claims. It can upload within quota, and its pastes are
+// owned by the subject.
+func CertKey(subject string, quota Quota) *Key {
+	return &Key{ID: "cert:" + subject, Owner: subject, Scopes: []Scope{ScopeWrite}, Quota: quota}
+}
+
+// GenerateToken returns a new random token and its hash.
+func GenerateToken() (token, hash string, err error) {
+	random, err := util.GenerateRandomString(40)
+	if err != nil {
+		return "", "", err
+	}
+	token = TokenPrefix + random
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the hex SHA-256 hash of a token. Tokens are long and
+// random, so a fast hash is enough.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
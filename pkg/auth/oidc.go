@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// ErrLoginDenied is returned when a user authenticated with the identity
+// provider but is not allowed to use pasted.
+var ErrLoginDenied = errors.New("login denied")
+
+// OIDCOptions configures single sign-on with an OpenID Connect provider.
+type OIDCOptions struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+
+	// Scopes are requested in addition to "openid".
+	Scopes []string
+
+	// AllowedDomains restricts login to users whose verified email is in one of these domains.
+	AllowedDomains []string
+
+	// AssumeEmailVerified trusts email addresses in ID tokens without an
+	// email_verified claim, for providers that only send verified addresses
+	// and omit the claim. Addresses the provider marks unverified are never
+	// trusted.
+	AssumeEmailVerified bool
+
+	// GroupsClaim is the ID token claim that lists the user's groups.
+	GroupsClaim string
+
+	// AllowedGroups restricts login to members of one of these groups.
+	AllowedGroups []string
+
+	// Roles maps groups to the scopes their members get.
+	Roles map[string][]Scope
+
+	// DefaultScopes are given to every user who can log in.
+	DefaultScopes []Scope
+}
+
+// OIDC logs users in with an OpenID Connect provider using the
+// authorization code flow with PKCE.
+type OIDC struct {
+	opts     OIDCOptions
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// Identity is a user who logged in.
+type Identity struct {
+	// Subject is the provider's stable identifier for the user.
+	Subject string `json:"sub"`
+
+	// Email is the user's verified email address, if the provider sent one.
+	Email string `json:"email,omitempty"`
+
+	// Name is the user's display name.
+	Name string `json:"name,omitempty"`
+
+	// Scopes are the operations the user is allowed.
+	Scopes []Scope `json:"scopes"`
+}
+
+// Key returns the key that represents the user. Pastes are owned by the
+// user's email address, or the subject if there is none.
+func (id *Identity) Key() *Key {
+	owner := id.Email
+	if owner == "" {
+		owner = id.Subject
+	}
+	return &Key{ID: "oidc:" + id.Subject, Owner: owner, Scopes: id.Scopes}
+}
+
+// DisplayName returns a name to show for the user.
+func (id *Identity) DisplayName() string {
+	switch {
+	case id.Name != "":
+		return id.Name
+	case id.Email != "":
+		return id.Email
+	default:
+		return id.Subject
+	}
+}
+
+// NewOIDC discovers the provider's endpoints from its issuer URL.
+func NewOIDC(ctx context.Context, opts OIDCOptions) (*OIDC, error) {
+	provider, err := oidc.NewProvider(ctx, opts.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("could not discover OIDC provider %s: %v", opts.Issuer, err)
+	}
+	scopes := []string{oidc.ScopeOpenID}
+	for _, s := range opts.Scopes {
+		if s != oidc.ScopeOpenID {
+			scopes = append(scopes, s)
+		}
+	}
+	return &OIDC{
+		opts: opts,
+		oauth: &oauth2.Config{
+			ClientID:     opts.ClientID,
+			ClientSecret: opts.ClientSecret,
+			RedirectURL:  opts.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       scopes,
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: opts.ClientID}),
+	}, nil
+}
+
+// AuthCodeURL returns the provider URL that starts a login. state, nonce and
+// verifier must be random and kept by the client until the callback.
+func (o *OIDC) AuthCodeURL(state, nonce, verifier string) string {
+	return o.oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+}
+
+// Exchange completes a login: it redeems the authorization code, verifies
+// the ID token and decides what the user may do. It returns ErrLoginDenied,
+// wrapped with the reason, for users who are not allowed in.
+func (o *OIDC) Exchange(ctx context.Context, code, nonce, verifier string) (*Identity, error) {
+	token, err := o.oauth.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("could not redeem authorization code: %v", err)
+	}
+	raw, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("token response has no id_token")
+	}
+	idToken, err := o.verifier.Verify(ctx, raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %v", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, errors.New("ID token nonce does not match")
+	}
+
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("invalid ID token claims: %v", err)
+	}
+	id := &Identity{Subject: idToken.Subject}
+	id.Name, _ = claims["name"].(string)
+	if email, _ := claims["email"].(string); email != "" {
+		verified, ok := claims["email_verified"].(bool)
+		if verified || (!ok && o.opts.AssumeEmailVerified) {
+			id.Email = strings.ToLower(email)
+		}
+	}
+
+	if len(o.opts.AllowedDomains) > 0 {
+		_, domain, _ := strings.Cut(id.Email, "@")
+		if id.Email == "" || !slices.Contains(o.opts.AllowedDomains, domain) {
+			return nil, fmt.Errorf("%w: email domain is not allowed", ErrLoginDenied)
+		}
+	}
+
+	groups := stringsClaim(claims[o.opts.GroupsClaim])
+	if len(o.opts.AllowedGroups) > 0 && !slices.ContainsFunc(groups, func(g string) bool {
+		return slices.Contains(o.opts.AllowedGroups, g)
+	}) {
+		return nil, fmt.Errorf("%w: not a member of an allowed group", ErrLoginDenied)
+	}
+
+	id.Scopes = append(id.Scopes, o.opts.DefaultScopes...)
+	for _, g := range groups {
+		id.Scopes = append(id.Scopes, o.opts.Roles[g]...)
+	}
+	slices.Sort(id.Scopes)
+	id.Scopes = slices.Compact(id.Scopes)
+	if len(id.Scopes) == 0 {
+		return nil, fmt.Errorf("%w: no roles", ErrLoginDenied)
+	}
+	return id, nil
+}
+
+// stringsClaim returns a claim that holds a list of strings or a single string.
+func stringsClaim(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		var s []string
+		for _, e := range v {
+			if str, ok := e.(string); ok {
+				s = append(s, str)
+			}
+		}
+		return s
+	default:
+		return nil
+	}
+}
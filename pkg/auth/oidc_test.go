@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/cbrnrd/pasted/pkg/auth/oidctest"
+	"golang.org/x/oauth2"
+)
+
+// newTestOIDC returns a client of a new mock provider, configured by opts.
+func newTestOIDC(t *testing.T, opts OIDCOptions) (*OIDC, *oidctest.Provider) {
+	t.Helper()
+	provider := oidctest.NewProvider(t, "pasted", "secret")
+	opts.Issuer = provider.URL
+	opts.ClientID = provider.ClientID
+	opts.ClientSecret = provider.ClientSecret
+	opts.RedirectURL = "http://pasted.test/auth/callback"
+	if opts.GroupsClaim == "" {
+		opts.GroupsClaim = "groups"
+	}
+	o, err := NewOIDC(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o, provider
+}
+
+// login logs in at the provider with nonce and verifier and returns the
+// authorization code.
+func login(t *testing.T, o *OIDC, provider *oidctest.Provider, nonce, verifier string) string {
+	t.Helper()
+	callback := provider.Authorize(t, o.AuthCodeURL("state", nonce, verifier))
+	if got := callback.Query().Get("state"); got != "state" {
+		t.Fatalf("callback state = %q, want %q", got, "state")
+	}
+	return callback.Query().Get("code")
+}
+
+func TestOIDCExchange(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   OIDCOptions
+		claims map[string]any
+
+		wantDenied bool
+		wantEmail  string
+		wantScopes []Scope
+	}{
+		{
+			name:       "default scopes",
+			opts:       OIDCOptions{DefaultScopes: []Scope{ScopeRead, ScopeWrite}},
+			claims:     map[string]any{"email": "Alice@Example.com", "email_verified": true},
+			wantEmail:  "alice@example.com",
+			wantScopes: []Scope{ScopeRead, ScopeWrite},
+		},
+		{
+			name:       "allowed domain",
+			opts:       OIDCOptions{AllowedDomains: []string{"example.com"}, DefaultScopes: []Scope{ScopeRead}},
+			claims:     map[string]any{"email": "alice@example.com", "email_verified": true},
+			wantEmail:  "alice@example.com",
+			wantScopes: []Scope{ScopeRead},
+		},
+		{
+			name:       "disallowed domain",
+			opts:       OIDCOptions{AllowedDomains: []string{"example.com"}, DefaultScopes: []Scope{ScopeRead}},
+			claims:     map[string]any{"email": "mallory@example.org", "email_verified": true},
+			wantDenied: true,
+		},
+		{
+			name:       "subdomain of allowed domain",
+			opts:       OIDCOptions{AllowedDomains: []string{"example.com"}, DefaultScopes: []Scope{ScopeRead}},
+			claims:     map[string]any{"email": "mallory@evil.example.com", "email_verified": true},
+			wantDenied: true,
+		},
+		{
+			name:       "unverified email",
+			opts:       OIDCOptions{AllowedDomains: []string{"example.com"}, DefaultScopes: []Scope{ScopeRead}},
+			claims:     map[string]any{"email": "alice@example.com", "email_verified": false},
+			wantDenied: true,
+		},
+		{
+			name:       "email_verified missing",
+			opts:       OIDCOptions{AllowedDomains: []string{"example.com"}, DefaultScopes: []Scope{ScopeRead}},
+			claims:     map[string]any{"email": "alice@example.com"},
+			wantDenied: true,
+		},
+		{
+			name:       "email_verified missing and assumed",
+			opts:       OIDCOptions{AllowedDomains: []string{"example.com"}, AssumeEmailVerified: true, DefaultScopes: []Scope{ScopeRead}},
+			claims:     map[string]any{"email": "alice@example.com"},
+			wantEmail:  "alice@example.com",
+			wantScopes: []Scope{ScopeRead},
+		},
+		{
+			name:       "unverified email with assumed verification",
+			opts:       OIDCOptions{AllowedDomains: []string{"example.com"}, AssumeEmailVerified: true, DefaultScopes: []Scope{ScopeRead}},
+			claims:     map[string]any{"email": "alice@example.com", "email_verified": false},
+			wantDenied: true,
+		},
+		{
+			name:       "unverified email without domain restriction",
+			opts:       OIDCOptions{DefaultScopes: []Scope{ScopeRead}},
+			claims:     map[string]any{"email": "alice@example.com"},
+			wantEmail:  "",
+			wantScopes: []Scope{ScopeRead},
+		},
+		{
+			name:       "allowed group",
+			opts:       OIDCOptions{AllowedGroups: []string{"eng"}, DefaultScopes: []Scope{ScopeRead}},
+			claims:     map[string]any{"groups": []string{"sales", "eng"}},
+			wantScopes: []Scope{ScopeRead},
+		},
+		{
+			name:       "allowed group as a single string",
+			opts:       OIDCOptions{AllowedGroups: []string{"eng"}, DefaultScopes: []Scope{ScopeRead}},
+			claims:     map[string]any{"groups": "eng"},
+			wantScopes: []Scope{ScopeRead},
+		},
+		{
+			name:       "not in an allowed group",
+			opts:       OIDCOptions{AllowedGroups: []string{"eng"}, DefaultScopes: []Scope{ScopeRead}},
+			claims:     map[string]any{"groups": []string{"sales"}},
+			wantDenied: true,
+		},
+		{
+			name:       "no groups claim",
+			opts:       OIDCOptions{AllowedGroups: []string{"eng"}, DefaultScopes: []Scope{ScopeRead}},
+			wantDenied: true,
+		},
+		{
+			name: "roles",
+			opts: OIDCOptions{
+				Roles:         map[string][]Scope{"ops": {ScopeAdmin}, "eng": {ScopeWrite, ScopeRead}},
+				DefaultScopes: []Scope{ScopeRead},
+			},
+			claims:     map[string]any{"groups": []string{"eng", "ops", "sales"}},
+			wantScopes: []Scope{ScopeAdmin, ScopeRead, ScopeWrite},
+		},
+		{
+			name: "custom groups claim",
+			opts: OIDCOptions{
+				GroupsClaim: "roles",
+				Roles:       map[string][]Scope{"writer": {ScopeWrite}},
+			},
+			claims:     map[string]any{"roles": []string{"writer"}, "groups": []string{"ignored"}},
+			wantScopes: []Scope{ScopeWrite},
+		},
+		{
+			name:       "no roles",
+			opts:       OIDCOptions{Roles: map[string][]Scope{"ops": {ScopeAdmin}}},
+			claims:     map[string]any{"groups": []string{"eng"}},
+			wantDenied: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, provider := newTestOIDC(t, tt.opts)
+			provider.SetClaims(tt.claims)
+			verifier := oauth2.GenerateVerifier()
+			code := login(t, o, provider, "nonce", verifier)
+
+			id, err := o.Exchange(context.Background(), code, "nonce", verifier)
+			if tt.wantDenied {
+				if !errors.Is(err, ErrLoginDenied) {
+					t.Fatalf("Exchange() error = %v, want %v", err, ErrLoginDenied)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exchange() error = %v", err)
+			}
+			if id.Subject != "user" {
+				t.Errorf("Subject = %q, want %q", id.Subject, "user")
+			}
+			if id.Email != tt.wantEmail {
+				t.Errorf("Email = %q, want %q", id.Email, tt.wantEmail)
+			}
+			if !slices.Equal(id.Scopes, tt.wantScopes) {
+				t.Errorf("Scopes = %v, want %v", id.Scopes, tt.wantScopes)
+			}
+		})
+	}
+}
+
+func TestOIDCExchangeNonceMismatch(t *testing.T) {
+	o, provider := newTestOIDC(t, OIDCOptions{DefaultScopes: []Scope{ScopeRead}})
+	verifier := oauth2.GenerateVerifier()
+	code := login(t, o, provider, "nonce", verifier)
+
+	_, err := o.Exchange(context.Background(), code, "other nonce", verifier)
+	if err == nil || errors.Is(err, ErrLoginDenied) {
+		t.Fatalf("Exchange() error = %v, want a nonce error", err)
+	}
+}
+
+func TestOIDCExchangeWrongVerifier(t *testing.T) {
+	o, provider := newTestOIDC(t, OIDCOptions{DefaultScopes: []Scope{ScopeRead}})
+	code := login(t, o, provider, "nonce", oauth2.GenerateVerifier())
+
+	if _, err := o.Exchange(context.Background(), code, "nonce", oauth2.GenerateVerifier()); err == nil {
+		t.Fatal("Exchange() succeeded with the wrong PKCE verifier")
+	}
+}
+
+func TestOIDCExchangeCodeReuse(t *testing.T) {
+	o, provider := newTestOIDC(t, OIDCOptions{DefaultScopes: []Scope{ScopeRead}})
+	verifier := oauth2.GenerateVerifier()
+	code := login(t, o, provider, "nonce", verifier)
+
+	if _, err := o.Exchange(context.Background(), code, "nonce", verifier); err != nil {
+		t.Fatalf("first Exchange() error = %v", err)
+	}
+	if _, err := o.Exchange(context.Background(), code, "nonce", verifier); err == nil {
+		t.Fatal("second Exchange() with the same code succeeded")
+	}
+}
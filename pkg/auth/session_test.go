@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSessionsPurpose(t *testing.T) {
+	s := NewSessions([]byte("secret"))
+	encoded, err := s.Encode("login", map[string]string{"sub": "user"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var id Identity
+	if err := s.Decode("session", encoded, &id); !errors.Is(err, ErrInvalidSession) {
+		t.Fatalf("Decode() with another purpose error = %v, want %v", err, ErrInvalidSession)
+	}
+	var v map[string]string
+	if err := s.Decode("login", encoded, &v); err != nil || v["sub"] != "user" {
+		t.Fatalf("Decode() = %v, %v", v, err)
+	}
+}
+
+func TestSessionsTampered(t *testing.T) {
+	s := NewSessions([]byte("secret"))
+	encoded, err := s.Encode("session", Identity{Subject: "user"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var id Identity
+	if err := NewSessions([]byte("other")).Decode("session", encoded, &id); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("Decode() with another secret error = %v, want %v", err, ErrInvalidSession)
+	}
+	tampered := []byte(encoded)
+	tampered[0] ^= 1
+	if err := s.Decode("session", string(tampered), &id); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("Decode() of a tampered value error = %v, want %v", err, ErrInvalidSession)
+	}
+}
+
+func TestSessionsExpired(t *testing.T) {
+	s := NewSessions([]byte("secret"))
+	encoded, err := s.Encode("session", Identity{Subject: "user"}, -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id Identity
+	if err := s.Decode("session", encoded, &id); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("Decode() of an expired value error = %v, want %v", err, ErrInvalidSession)
+	}
+}
@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// KeyFile is the format of the keys file.
+type KeyFile struct {
+	Keys []*Key `yaml:"keys"`
+}
+
+// LoadKeyFile reads a keys file. A missing file has no keys.
+func LoadKeyFile(path string) (*KeyFile, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &KeyFile{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f KeyFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for _, k := range f.Keys {
+		if err := k.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return &f, nil
+}
+
+// Save writes the keys file, replacing it atomically so that a running
+// server never reads a partial file.
+func (f *KeyFile) Save(path string) error {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(f); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".keys-*.yaml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Find returns the key with the given ID, or nil.
+func (f *KeyFile) Find(id string) *Key {
+	for _, k := range f.Keys {
+		if k.ID == id {
+			return k
+		}
+	}
+	return nil
+}
+
+// Store authenticates clients against the keys in the configuration and the
+// keys file. The keys file is reloaded when it changes, so keys issued or
+// revoked by the admin commands take effect without a restart.
+type Store struct {
+	path   string
+	static []*Key
+
+	mu      sync.Mutex
+	modTime time.Time
+	keys    []*Key
+
+	// usage counts the pastes created with each key in the current hour.
+	usage map[string]*usageWindow
+}
+
+type usageWindow struct {
+	start  time.Time
+	pastes int
+}
+
+// NewStore returns a store for the keys in static and in the keys file at
+// path, which may be empty.
+func NewStore(path string, static []*Key) (*Store, error) {
+	for _, k := range static {
+		if err := k.validate(); err != nil {
+			return nil, err
+		}
+	}
+	s := &Store{path: path, static: static, keys: static, usage: map[string]*usageWindow{}}
+	if path != "" {
+		if _, err := s.reload(true); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Enabled reports whether any keys are configured.
+func (s *Store) Enabled() bool {
+	return s.path != "" || len(s.static) > 0
+}
+
+// reload reads the keys file if it has changed since it was last read. The
+// caller must hold s.mu, except during NewStore. If the file cannot be read,
+// the keys from the last good read are kept.
+func (s *Store) reload(force bool) ([]*Key, error) {
+	info, err := os.Stat(s.path)
+	var modTime time.Time
+	if err == nil {
+		modTime = info.ModTime()
+	}
+	if !force && modTime.Equal(s.modTime) {
+		return s.keys, nil
+	}
+
+	f, err := LoadKeyFile(s.path)
+	if err != nil {
+		return s.keys, err
+	}
+	s.modTime = modTime
+	s.keys = append(append([]*Key(nil), s.static...), f.Keys...)
+	return s.keys, nil
+}
+
+// current returns the keys, reloading the keys file if it has changed.
+func (s *Store) current() []*Key {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.path == "" {
+		return s.keys
+	}
+	keys, err := s.reload(false)
+	if err != nil {
+		log.Printf("could not reload keys file, keeping the previous keys: %v", err)
+	}
+	return keys
+}
+
+// Authenticate returns the active key whose token is token, or ErrInvalidKey.
+func (s *Store) Authenticate(token string) (*Key, error) {
+	hash := []byte(HashToken(token))
+	now := time.Now()
+	for _, k := range s.current() {
+		if k.Hash != "" && subtle.ConstantTimeCompare(hash, []byte(k.Hash)) == 1 && k.Active(now) {
+			return k, nil
+		}
+	}
+	return nil, ErrInvalidKey
+}
+
+// AuthenticateIP returns the active key whose networks contain ip, or nil.
+func (s *Store) AuthenticateIP(ip net.IP) *Key {
+	if ip == nil {
+		return nil
+	}
+	now := time.Now()
+	for _, k := range s.current() {
+		if k.matchesIP(ip) && k.Active(now) {
+			return k
+		}
+	}
+	return nil
+}
+
+// AuthenticateCert returns the active key that claims client certificates
+// with subject, or nil.
+func (s *Store) AuthenticateCert(subject string) *Key {
+	now := time.Now()
+	for _, k := range s.current() {
+		if slices.Contains(k.CertSubjects, subject) && k.Active(now) {
+			return k
+		}
+	}
+	return nil
+}
+
+// Allow counts a new paste against the key's hourly quota, or returns
+// ErrQuotaExceeded if it has been used up. Usage is kept in memory, so it
+// starts again when the server restarts.
+func (s *Store) Allow(k *Key) error {
+	if k.Quota.PastesPerHour <= 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	w := s.usage[k.ID]
+	if w == nil || now.Sub(w.start) >= time.Hour {
+		w = &usageWindow{start: now}
+		s.usage[k.ID] = w
+	}
+	if w.pastes >= k.Quota.PastesPerHour {
+		return ErrQuotaExceeded
+	}
+	w.pastes++
+	return nil
+}
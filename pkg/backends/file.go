@@ -1,9 +1,11 @@
 package backends
 
 import (
+	"errors"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/cbrnrd/pasted/pkg/util"
 )
@@ -43,8 +45,12 @@ func DefaultFileBackend(root string) (*FileBackend, error) {
 	})
 }
 
-// Put stores the contents of r in a file and returns the generated path to the file
-func (f *FileBackend) Put(r io.Reader) (string, error) {
+// metaSuffix is appended to a paste's path to form the path of its metadata file
+const metaSuffix = ".meta.json"
+
+// Put stores the contents of r in a file and returns the generated path to the file.
+// The metadata is stored next to it in a JSON sidecar file.
+func (f *FileBackend) Put(r io.Reader, meta *Metadata) (string, error) {
 	path := f.pathGen()
 
 	outFile, err := os.Create(filepath.Join(f.Root, path))
@@ -54,13 +60,22 @@ func (f *FileBackend) Put(r io.Reader) (string, error) {
 	defer outFile.Close()
 
 	n, err := io.CopyN(outFile, r, f.MaxSize)
-	if err != io.EOF {
+	if err != nil && err != io.EOF {
 		return "", err
 	}
 	if n == f.MaxSize {
+		os.Remove(outFile.Name())
 		return "", ErrFileTooLarge
 	}
 
+	m, err := encodeMetadata(meta)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(f.Root, path+metaSuffix), m, 0o644); err != nil {
+		return "", err
+	}
+
 	return path, nil
 }
 
@@ -69,9 +84,13 @@ func (f *FileBackend) Get(path string, w io.Writer) error {
 	c := filepath.Clean(path)
 
 	inFile, err := os.Open(filepath.Join(f.Root, c))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
 	if err != nil {
 		return err
 	}
+	defer inFile.Close()
 
 	_, err = io.Copy(w, inFile)
 	if err != nil {
@@ -80,3 +99,92 @@ func (f *FileBackend) Get(path string, w io.Writer) error {
 
 	return nil
 }
+
+// Stat returns the metadata stored for path.
+// Pastes written before metadata was recorded report only their modification time.
+func (f *FileBackend) Stat(path string) (*Metadata, error) {
+	c := filepath.Join(f.Root, filepath.Clean(path))
+
+	data, err := os.ReadFile(c + metaSuffix)
+	if err == nil {
+		return decodeMetadata(data)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	info, err := os.Stat(c)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Metadata{CreatedAt: info.ModTime().UTC()}, nil
+}
+
+// Delete removes the file at path and its metadata file.
+func (f *FileBackend) Delete(path string) error {
+	c := filepath.Join(f.Root, filepath.Clean(path))
+
+	err := os.Remove(c)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(c + metaSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Update replaces the metadata file of the paste at path.
+func (f *FileBackend) Update(path string, meta *Metadata) error {
+	c := filepath.Join(f.Root, filepath.Clean(path))
+	if _, err := os.Stat(c); errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	m, err := encodeMetadata(meta)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c+metaSuffix, m, 0o644)
+}
+
+// List returns the metadata of the pastes that match filter.
+// It reads every metadata file, so it is slow for large directories.
+func (f *FileBackend) List(filter Filter) (map[string]*Metadata, error) {
+	if filter == (Filter{}) {
+		return nil, ErrEmptyFilter
+	}
+	entries, err := os.ReadDir(f.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	pastes := make(map[string]*Metadata)
+	for _, e := range entries {
+		key, ok := strings.CutSuffix(e.Name(), metaSuffix)
+		if !ok || e.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(f.Root, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		meta, err := decodeMetadata(data)
+		if err != nil {
+			return nil, err
+		}
+		if filter.Match(meta) {
+			pastes[key] = meta
+		}
+	}
+	return pastes, nil
+}
@@ -1,43 +1,117 @@
 package backends
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
-	"fmt"
 	"io"
+	"sync"
+
+	"github.com/cbrnrd/pasted/pkg/util"
 )
 
 // MemoryBackend is a backend that stores files in memory
 type MemoryBackend struct {
+	mu sync.RWMutex
+
 	// mapping is a map from keys to file contents
 	mapping map[string][]byte
+
+	// meta is a map from keys to paste metadata
+	meta map[string]*Metadata
 }
 
 var _ Backend = (*MemoryBackend)(nil)
 
 func NewMemoryBackend() *MemoryBackend {
-	return &MemoryBackend{mapping: make(map[string][]byte)}
+	return &MemoryBackend{mapping: make(map[string][]byte), meta: make(map[string]*Metadata)}
 }
 
 // Put stores the contents of r in memory and returns the key
-// The key is the first 4 bytes of the SHA256 hash of the contents
-func (m *MemoryBackend) Put(r io.Reader) (string, error) {
-	fmt.Println("writing contents")
+// The key is a random string, so identical contents are stored separately
+func (m *MemoryBackend) Put(r io.Reader, meta *Metadata) (string, error) {
 	contents, err := io.ReadAll(r)
 	if err != nil {
 		return "", err
 	}
 
-	hash := sha256.Sum256(contents)
-	path := hex.EncodeToString(hash[:4])
-	m.mapping[path] = contents
-	fmt.Println(path)
-	return path, nil
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
+	for {
+		path, err := util.GenerateRandomString(8)
+		if err != nil {
+			return "", err
+		}
+		if _, ok := m.mapping[path]; ok {
+			continue
+		}
+		m.mapping[path] = contents
+		m.meta[path] = prepareMetadata(meta)
+		return path, nil
+	}
 }
 
 // Get writes the contents of the file at key to w
 func (m *MemoryBackend) Get(key string, w io.Writer) error {
-	_, err := w.Write(m.mapping[key])
+	m.mu.RLock()
+	contents := m.mapping[key]
+	m.mu.RUnlock()
+
+	_, err := w.Write(contents)
 	return err
 }
+
+// Stat returns the metadata stored for key
+func (m *MemoryBackend) Stat(key string) (*Metadata, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	meta, ok := m.meta[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c := *meta
+	return &c, nil
+}
+
+// Delete removes the paste at key
+func (m *MemoryBackend) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.mapping[key]; !ok {
+		return ErrNotFound
+	}
+	delete(m.mapping, key)
+	delete(m.meta, key)
+	return nil
+}
+
+// Update replaces the metadata of the paste at key
+func (m *MemoryBackend) Update(key string, meta *Metadata) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.mapping[key]; !ok {
+		return ErrNotFound
+	}
+	m.meta[key] = prepareMetadata(meta)
+	return nil
+}
+
+// List returns the metadata of the pastes that match filter
+func (m *MemoryBackend) List(filter Filter) (map[string]*Metadata, error) {
+	if filter == (Filter{}) {
+		return nil, ErrEmptyFilter
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	pastes := make(map[string]*Metadata)
+	for key, meta := range m.meta {
+		if filter.Match(meta) {
+			c := *meta
+			pastes[key] = &c
+		}
+	}
+	return pastes, nil
+}
@@ -0,0 +1,40 @@
+package backends
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMemoryBackendIdenticalContents(t *testing.T) {
+	m := NewMemoryBackend()
+	alice := &Metadata{Owner: "alice", DeleteTokenHash: "alice-token", PasswordHash: "alice-password"}
+	bob := &Metadata{Owner: "bob", DeleteTokenHash: "bob-token", BurnAfterRead: true}
+
+	first, err := m.Put(strings.NewReader("same contents"), alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := m.Put(strings.NewReader("same contents"), bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Fatalf("identical contents stored under the same key %q", first)
+	}
+
+	for key, want := range map[string]*Metadata{first: alice, second: bob} {
+		meta, err := m.Stat(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if meta.Owner != want.Owner || meta.DeleteTokenHash != want.DeleteTokenHash ||
+			meta.PasswordHash != want.PasswordHash || meta.BurnAfterRead != want.BurnAfterRead {
+			t.Errorf("metadata of %s = %+v, want the metadata of %s", key, meta, want.Owner)
+		}
+		var buf bytes.Buffer
+		if err := m.Get(key, &buf); err != nil || buf.String() != "same contents" {
+			t.Errorf("Get(%s) = %q, %v", key, buf.String(), err)
+		}
+	}
+}
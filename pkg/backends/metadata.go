@@ -0,0 +1,69 @@
+package backends
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// prepareMetadata returns a copy of meta with defaults filled in.
+func prepareMetadata(meta *Metadata) *Metadata {
+	m := &Metadata{}
+	if meta != nil {
+		*m = *meta
+	}
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now().UTC()
+	}
+	return m
+}
+
+func encodeMetadata(meta *Metadata) ([]byte, error) {
+	return json.Marshal(prepareMetadata(meta))
+}
+
+func decodeMetadata(data []byte) (*Metadata, error) {
+	m := &Metadata{}
+	if len(data) == 0 {
+		return m, nil
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// metaColumns returns the values of the owner and namespace columns of the SQL
+// backends, which are NULL for pastes without one.
+func metaColumns(meta *Metadata) (owner, namespace sql.NullString) {
+	if meta == nil {
+		return owner, namespace
+	}
+	return sql.NullString{String: meta.Owner, Valid: meta.Owner != ""},
+		sql.NullString{String: meta.Namespace, Valid: meta.Namespace != ""}
+}
+
+// filterWhere returns the WHERE clause of the SQL backends that selects the
+// pastes matching filter, and its arguments. placeholder returns the
+// placeholder for the nth argument, counting from 1.
+func filterWhere(filter Filter, placeholder func(n int) string) (string, []any, error) {
+	if filter.All {
+		return "1 = 1", nil, nil
+	}
+	var conds []string
+	var args []any
+	if filter.Owner != "" {
+		args = append(args, filter.Owner)
+		conds = append(conds, fmt.Sprintf("owner = %s", placeholder(len(args))))
+	}
+	if filter.Namespace != "" {
+		args = append(args, filter.Namespace)
+		conds = append(conds, fmt.Sprintf("namespace = %s", placeholder(len(args))))
+	}
+	if len(conds) == 0 {
+		return "", nil, ErrEmptyFilter
+	}
+	return strings.Join(conds, " AND "), args, nil
+}
@@ -2,9 +2,11 @@ package backends
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -29,28 +31,50 @@ func NewPostgresBackend(ctx context.Context, connString string, pgf PathGenFunc,
 	if createTables {
 		_, err = pool.Exec(ctx, `CREATE TABLE IF NOT EXISTS pastes (
 			id TEXT PRIMARY KEY,
-			data BYTEA
+			data BYTEA,
+			meta JSONB,
+			owner TEXT,
+			namespace TEXT
 		)`)
 		if err != nil {
 			return nil, err
 		}
+
+		// Tables created by earlier versions lack the meta, owner and namespace
+		// columns. Owners were only recorded in meta, so they are copied over.
+		for _, stmt := range []string{
+			`ALTER TABLE pastes ADD COLUMN IF NOT EXISTS meta JSONB`,
+			`ALTER TABLE pastes ADD COLUMN IF NOT EXISTS owner TEXT`,
+			`ALTER TABLE pastes ADD COLUMN IF NOT EXISTS namespace TEXT`,
+			`UPDATE pastes SET owner = meta->>'owner' WHERE owner IS NULL AND meta->>'owner' IS NOT NULL`,
+			`CREATE INDEX IF NOT EXISTS pastes_owner ON pastes (owner)`,
+			`CREATE INDEX IF NOT EXISTS pastes_namespace ON pastes (namespace)`,
+		} {
+			if _, err := pool.Exec(ctx, stmt); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	return &PgxBackend{ctx: ctx, pool: pool, pathGenFunc: pgf}, nil
 }
 
-func (b *PgxBackend) Put(r io.Reader) (string, error) {
+func (b *PgxBackend) Put(r io.Reader, meta *Metadata) (string, error) {
 	data, err := io.ReadAll(r)
 	if err != nil {
 		return "", err
 	}
 
+	m, err := encodeMetadata(meta)
+	if err != nil {
+		return "", err
+	}
+
 	key := b.pathGenFunc()
-	fmt.Println(key)
-	fmt.Println(data)
-	// spew.Dump(b)
 
-	_, err = b.pool.Exec(b.ctx, "INSERT INTO pastes (id, data) VALUES ($1, $2) RETURNING id", key, data)
+	owner, namespace := metaColumns(meta)
+	_, err = b.pool.Exec(b.ctx, "INSERT INTO pastes (id, data, meta, owner, namespace) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		key, data, m, owner, namespace)
 	if err != nil {
 		return "", err
 	}
@@ -61,6 +85,9 @@ func (b *PgxBackend) Put(r io.Reader) (string, error) {
 func (b *PgxBackend) Get(key string, w io.Writer) error {
 	var data []byte
 	err := b.pool.QueryRow(b.ctx, "SELECT data FROM pastes WHERE id=$1", key).Scan(&data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
 	if err != nil {
 		return err
 	}
@@ -68,3 +95,71 @@ func (b *PgxBackend) Get(key string, w io.Writer) error {
 	_, err = w.Write(data)
 	return err
 }
+
+func (b *PgxBackend) Stat(key string) (*Metadata, error) {
+	var meta []byte
+	err := b.pool.QueryRow(b.ctx, "SELECT meta FROM pastes WHERE id=$1", key).Scan(&meta)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeMetadata(meta)
+}
+
+func (b *PgxBackend) Delete(key string) error {
+	tag, err := b.pool.Exec(b.ctx, "DELETE FROM pastes WHERE id=$1", key)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (b *PgxBackend) Update(key string, meta *Metadata) error {
+	m, err := encodeMetadata(meta)
+	if err != nil {
+		return err
+	}
+
+	owner, namespace := metaColumns(meta)
+	tag, err := b.pool.Exec(b.ctx, "UPDATE pastes SET meta=$1, owner=$2, namespace=$3 WHERE id=$4", m, owner, namespace, key)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (b *PgxBackend) List(filter Filter) (map[string]*Metadata, error) {
+	where, args, err := filterWhere(filter, func(n int) string { return fmt.Sprintf("$%d", n) })
+	if err != nil {
+		return nil, err
+	}
+	rows, err := b.pool.Query(b.ctx, "SELECT id, meta FROM pastes WHERE "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pastes := make(map[string]*Metadata)
+	for rows.Next() {
+		var key string
+		var meta []byte
+		if err := rows.Scan(&key, &meta); err != nil {
+			return nil, err
+		}
+		m, err := decodeMetadata(meta)
+		if err != nil {
+			return nil, err
+		}
+		pastes[key] = m
+	}
+	return pastes, rows.Err()
+}
@@ -3,6 +3,9 @@ package backends
 import (
 	"context"
 	"io"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 )
@@ -39,16 +42,206 @@ func (b *RedisBackend) Get(key string, w io.Writer) error {
 }
 
 // Put stores the contents of r in memory and returns the key.
+// The metadata is stored as JSON under a separate key.
 // Note that r will be read into memory before being stored.
-func (b *RedisBackend) Put(r io.Reader) (string, error) {
+func (b *RedisBackend) Put(r io.Reader, meta *Metadata) (string, error) {
 	value, err := io.ReadAll(r)
 	if err != nil {
 		return "", err
 	}
+	m, err := encodeMetadata(meta)
+	if err != nil {
+		return "", err
+	}
+	ttl := redisTTL(meta)
 	path := b.pathGenFunc()
-	status := b.client.Set(b.ctx, path, value, 0).Err()
-	if status != nil {
-		return "", status
+	_, err = b.client.TxPipelined(b.ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(b.ctx, path, value, ttl)
+		pipe.Set(b.ctx, redisMetaKey(path), m, ttl)
+		if meta != nil && meta.Owner != "" {
+			pipe.SAdd(b.ctx, redisOwnerKey(meta.Owner), path)
+		}
+		if meta != nil && meta.Namespace != "" {
+			pipe.SAdd(b.ctx, redisNamespaceKey(meta.Namespace), path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
 	}
 	return path, nil
 }
+
+// Stat returns the metadata stored for key.
+// Pastes written before metadata was recorded return empty metadata.
+func (b *RedisBackend) Stat(key string) (*Metadata, error) {
+	val, err := b.client.Get(b.ctx, redisMetaKey(key)).Bytes()
+	if err == redis.Nil {
+		exists, err := b.client.Exists(b.ctx, key).Result()
+		if err != nil {
+			return nil, err
+		}
+		if exists == 0 {
+			return nil, ErrNotFound
+		}
+		return &Metadata{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeMetadata(val)
+}
+
+// Update replaces the metadata of the paste at key, and changes when Redis
+// removes the paste to match its expiry.
+func (b *RedisBackend) Update(key string, meta *Metadata) error {
+	if _, err := b.Stat(key); err != nil {
+		return err
+	}
+	m, err := encodeMetadata(meta)
+	if err != nil {
+		return err
+	}
+	ttl := redisTTL(meta)
+	_, err = b.client.TxPipelined(b.ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(b.ctx, redisMetaKey(key), m, ttl)
+		if ttl > 0 {
+			pipe.Expire(b.ctx, key, ttl)
+		} else {
+			pipe.Persist(b.ctx, key)
+		}
+		return nil
+	})
+	return err
+}
+
+// Delete removes the paste at key, its metadata and its entries in the owner's and namespace's sets.
+// Of several concurrent deletions, only the one that removes the paste succeeds.
+func (b *RedisBackend) Delete(key string) error {
+	meta, err := b.Stat(key)
+	if err != nil {
+		return err
+	}
+	var deleted *redis.IntCmd
+	_, err = b.client.TxPipelined(b.ctx, func(pipe redis.Pipeliner) error {
+		deleted = pipe.Del(b.ctx, key)
+		pipe.Del(b.ctx, redisMetaKey(key))
+		if meta.Owner != "" {
+			pipe.SRem(b.ctx, redisOwnerKey(meta.Owner), key)
+		}
+		if meta.Namespace != "" {
+			pipe.SRem(b.ctx, redisNamespaceKey(meta.Namespace), key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if deleted.Val() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// List returns the metadata of the pastes that match filter, found through
+// the sets of each owner's and namespace's pastes. Keys of pastes that Redis
+// has expired are removed from the sets. Listing all pastes scans the whole
+// database for metadata keys.
+func (b *RedisBackend) List(filter Filter) (map[string]*Metadata, error) {
+	if filter.All {
+		var keys []string
+		iter := b.client.Scan(b.ctx, 0, "*"+redisMetaKey(""), redisListBatch).Iterator()
+		for iter.Next(b.ctx) {
+			keys = append(keys, strings.TrimSuffix(iter.Val(), redisMetaKey("")))
+		}
+		if err := iter.Err(); err != nil {
+			return nil, err
+		}
+		return b.listKeys(keys, nil)
+	}
+
+	var sets []string
+	if filter.Owner != "" {
+		sets = append(sets, redisOwnerKey(filter.Owner))
+	}
+	if filter.Namespace != "" {
+		sets = append(sets, redisNamespaceKey(filter.Namespace))
+	}
+	if len(sets) == 0 {
+		return nil, ErrEmptyFilter
+	}
+
+	keys, err := b.client.SInter(b.ctx, sets...).Result()
+	if err != nil {
+		return nil, err
+	}
+	return b.listKeys(keys, sets)
+}
+
+// redisListBatch is the number of keys List reads at once.
+const redisListBatch = 1000
+
+// listKeys returns the metadata of the pastes at keys, and removes the keys
+// of pastes that no longer exist from sets.
+func (b *RedisBackend) listKeys(keys []string, sets []string) (map[string]*Metadata, error) {
+	pastes := make(map[string]*Metadata)
+	var gone []any
+	for batch := range slices.Chunk(keys, redisListBatch) {
+		metaKeys := make([]string, len(batch))
+		for i, key := range batch {
+			metaKeys[i] = redisMetaKey(key)
+		}
+		vals, err := b.client.MGet(b.ctx, metaKeys...).Result()
+		if err != nil {
+			return nil, err
+		}
+		for i, val := range vals {
+			s, ok := val.(string)
+			if !ok {
+				gone = append(gone, batch[i])
+				continue
+			}
+			m, err := decodeMetadata([]byte(s))
+			if err != nil {
+				return nil, err
+			}
+			pastes[batch[i]] = m
+		}
+	}
+	if len(gone) > 0 {
+		for _, set := range sets {
+			b.client.SRem(b.ctx, set, gone...)
+		}
+	}
+	return pastes, nil
+}
+
+// redisOwnerKey returns the key of the set of pastes created by owner.
+func redisOwnerKey(owner string) string {
+	return "owner:" + owner
+}
+
+// redisNamespaceKey returns the key of the set of pastes in namespace.
+func redisNamespaceKey(namespace string) string {
+	return "namespace:" + namespace
+}
+
+// redisExpiryGrace is how long Redis keeps pastes after they expire. Expired
+// pastes are not served, and are normally deleted by the server first, so
+// that they stop counting against storage quotas; Redis only removes those
+// left behind while no server was running.
+const redisExpiryGrace = time.Hour
+
+// redisTTL returns the time until Redis removes a paste with meta. Zero keeps
+// it forever.
+func redisTTL(meta *Metadata) time.Duration {
+	if meta == nil || meta.ExpiresAt == nil {
+		return 0
+	}
+	return max(time.Until(*meta.ExpiresAt)+redisExpiryGrace, time.Second)
+}
+
+// redisMetaKey returns the key under which the metadata for key is stored.
+func redisMetaKey(key string) string {
+	return key + ":meta"
+}
@@ -2,11 +2,21 @@ package backends
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"io"
+	"net/url"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 )
 
+// s3MetaKey is the user-defined object metadata key holding the paste metadata.
+// The value is base64-encoded JSON, since S3 metadata values must be ASCII.
+const s3MetaKey = "pasted-meta"
+
 type S3Backend struct {
 	ctx context.Context
 
@@ -38,27 +48,197 @@ func (b *S3Backend) Get(key string, w io.Writer) error {
 
 	resp, err := b.client.GetObject(b.ctx, input)
 	if err != nil {
-		return err
+		return s3Error(err)
 	}
+	defer resp.Body.Close()
 
 	_, err = io.Copy(w, resp.Body)
 	return err
 }
 
 // Put stores the contents of r in memory and returns the key.
-func (b *S3Backend) Put(r io.Reader) (string, error) {
+// The metadata is stored in the object's user-defined metadata.
+func (b *S3Backend) Put(r io.Reader, meta *Metadata) (string, error) {
+	m, err := encodeMetadata(meta)
+	if err != nil {
+		return "", err
+	}
 
 	key := b.pathGenFunc()
 	input := &s3.PutObjectInput{
-		Bucket: &b.bucket,
-		Key:    &key,
-		Body:   r,
+		Bucket:   &b.bucket,
+		Key:      &key,
+		Body:     r,
+		Metadata: map[string]string{s3MetaKey: base64.StdEncoding.EncodeToString(m)},
 	}
 
-	_, err := b.client.PutObject(b.ctx, input)
+	_, err = b.client.PutObject(b.ctx, input)
 	if err != nil {
 		return "", err
 	}
 
+	if meta != nil {
+		for _, index := range s3IndexKeys(meta, key) {
+			_, err = b.client.PutObject(b.ctx, &s3.PutObjectInput{Bucket: &b.bucket, Key: &index, Body: strings.NewReader("")})
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+
 	return key, nil
 }
+
+// Update replaces the metadata of the object at key by copying it onto itself,
+// as S3 metadata cannot be changed in place.
+func (b *S3Backend) Update(key string, meta *Metadata) error {
+	m, err := encodeMetadata(meta)
+	if err != nil {
+		return err
+	}
+
+	source := b.bucket + "/" + url.PathEscape(key)
+	_, err = b.client.CopyObject(b.ctx, &s3.CopyObjectInput{
+		Bucket:            &b.bucket,
+		Key:               &key,
+		CopySource:        &source,
+		Metadata:          map[string]string{s3MetaKey: base64.StdEncoding.EncodeToString(m)},
+		MetadataDirective: types.MetadataDirectiveReplace,
+	})
+	return s3Error(err)
+}
+
+// Stat returns the metadata stored for key.
+func (b *S3Backend) Stat(key string) (*Metadata, error) {
+	resp, err := b.client.HeadObject(b.ctx, &s3.HeadObjectInput{
+		Bucket: &b.bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+
+	encoded, ok := resp.Metadata[s3MetaKey]
+	if !ok {
+		m := &Metadata{}
+		if resp.LastModified != nil {
+			m.CreatedAt = *resp.LastModified
+		}
+		return m, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return decodeMetadata(data)
+}
+
+// Delete removes the object at key and its entries in the owner and namespace indexes.
+func (b *S3Backend) Delete(key string) error {
+	meta, err := b.Stat(key)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.client.DeleteObject(b.ctx, &s3.DeleteObjectInput{Bucket: &b.bucket, Key: &key})
+	if err != nil {
+		return s3Error(err)
+	}
+	for _, index := range s3IndexKeys(meta, key) {
+		_, err = b.client.DeleteObject(b.ctx, &s3.DeleteObjectInput{Bucket: &b.bucket, Key: &index})
+		if err != nil {
+			return s3Error(err)
+		}
+	}
+	return nil
+}
+
+// List returns the metadata of the pastes that match filter, found through
+// the empty index objects stored under s3OwnerPrefix and s3NamespacePrefix.
+// Listing all pastes reads the metadata of every object in the bucket.
+func (b *S3Backend) List(filter Filter) (map[string]*Metadata, error) {
+	var prefix string
+	switch {
+	case filter.All:
+	case filter.Namespace != "":
+		prefix = s3NamespaceKey(filter.Namespace, "")
+	case filter.Owner != "":
+		prefix = s3OwnerKey(filter.Owner, "")
+	default:
+		return nil, ErrEmptyFilter
+	}
+	pages := s3.NewListObjectsV2Paginator(b.client, &s3.ListObjectsV2Input{Bucket: &b.bucket, Prefix: &prefix})
+
+	pastes := make(map[string]*Metadata)
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(b.ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Contents {
+			key := strings.TrimPrefix(*obj.Key, prefix)
+			if strings.Contains(key, "/") {
+				// An index object, when listing all pastes.
+				continue
+			}
+			meta, err := b.Stat(key)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if filter.Match(meta) {
+				pastes[key] = meta
+			}
+		}
+	}
+	return pastes, nil
+}
+
+// s3OwnerPrefix and s3NamespacePrefix are the prefixes of the owner and
+// namespace indexes. Paste keys never contain a slash, so index objects cannot
+// collide with pastes.
+const (
+	s3OwnerPrefix     = "owners/"
+	s3NamespacePrefix = "namespaces/"
+)
+
+// s3OwnerKey returns the key of the index object recording that owner created key.
+func s3OwnerKey(owner, key string) string {
+	return s3OwnerPrefix + owner + "/" + key
+}
+
+// s3NamespaceKey returns the key of the index object recording that key is in namespace.
+func s3NamespaceKey(namespace, key string) string {
+	return s3NamespacePrefix + namespace + "/" + key
+}
+
+// s3IndexKeys returns the keys of the index objects for the paste at key.
+func s3IndexKeys(meta *Metadata, key string) []string {
+	var keys []string
+	if meta.Owner != "" {
+		keys = append(keys, s3OwnerKey(meta.Owner, key))
+	}
+	if meta.Namespace != "" {
+		keys = append(keys, s3NamespaceKey(meta.Namespace, key))
+	}
+	return keys
+}
+
+// s3Error maps missing-object errors to ErrNotFound.
+func s3Error(err error) error {
+	var nsk *types.NoSuchKey
+	if errors.As(err, &nsk) {
+		return ErrNotFound
+	}
+	var nf *types.NotFound
+	if errors.As(err, &nf) {
+		return ErrNotFound
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NotFound" {
+		return ErrNotFound
+	}
+	return err
+}
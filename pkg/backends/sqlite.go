@@ -2,6 +2,7 @@ package backends
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"io"
 )
@@ -26,23 +27,82 @@ func NewSQLiteBackend(db *sql.DB, pgf PathGenFunc, createTables bool) (*SQLiteBa
 	if createTables {
 		_, err := db.Exec(`CREATE TABLE IF NOT EXISTS pastes (
 			id TEXT PRIMARY KEY,
-			data BLOB
+			data BLOB,
+			meta TEXT,
+			owner TEXT,
+			namespace TEXT
 		)`)
 		if err != nil {
 			return nil, err
 		}
+
+		// Tables created by earlier versions lack the meta, owner and namespace
+		// columns. Owners were only recorded in meta, so they are copied over.
+		for _, column := range []string{"meta", "owner", "namespace"} {
+			if err := sqliteAddColumn(db, "pastes", column, "TEXT"); err != nil {
+				return nil, err
+			}
+		}
+		for _, stmt := range []string{
+			`UPDATE pastes SET owner = json_extract(meta, '$.owner') WHERE owner IS NULL AND json_extract(meta, '$.owner') IS NOT NULL`,
+			`CREATE INDEX IF NOT EXISTS pastes_owner ON pastes (owner)`,
+			`CREATE INDEX IF NOT EXISTS pastes_namespace ON pastes (namespace)`,
+		} {
+			if _, err := db.Exec(stmt); err != nil {
+				return nil, err
+			}
+		}
 	}
 	return &SQLiteBackend{db: db, pathGenFunc: pgf}, nil
 }
 
-func (b *SQLiteBackend) Put(r io.Reader) (string, error) {
+// sqliteAddColumn adds a column to table if it does not already exist.
+func sqliteAddColumn(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			ctype     string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &ctype, &notNull, &dfltValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+func (b *SQLiteBackend) Put(r io.Reader, meta *Metadata) (string, error) {
 	data, err := io.ReadAll(r)
 	if err != nil {
 		return "", err
 	}
 
+	m, err := encodeMetadata(meta)
+	if err != nil {
+		return "", err
+	}
+
+	owner, namespace := metaColumns(meta)
 	key := b.pathGenFunc()
-	_, err = b.db.Exec("INSERT INTO pastes (id, data) VALUES (?, ?)", key, data)
+	_, err = b.db.Exec("INSERT INTO pastes (id, data, meta, owner, namespace) VALUES (?, ?, ?, ?, ?)",
+		key, data, string(m), owner, namespace)
 	if err != nil {
 		return "", err
 	}
@@ -53,10 +113,89 @@ func (b *SQLiteBackend) Put(r io.Reader) (string, error) {
 func (b *SQLiteBackend) Get(key string, w io.Writer) error {
 	var data []byte
 	err := b.db.QueryRow("SELECT data FROM pastes WHERE id=?", key).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
 	if err != nil {
 		return err
 	}
 
 	_, err = w.Write(data)
 	return err
-}
\ No newline at end of file
+}
+
+func (b *SQLiteBackend) Stat(key string) (*Metadata, error) {
+	var meta sql.NullString
+	err := b.db.QueryRow("SELECT meta FROM pastes WHERE id=?", key).Scan(&meta)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeMetadata([]byte(meta.String))
+}
+
+func (b *SQLiteBackend) Delete(key string) error {
+	res, err := b.db.Exec("DELETE FROM pastes WHERE id=?", key)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (b *SQLiteBackend) Update(key string, meta *Metadata) error {
+	m, err := encodeMetadata(meta)
+	if err != nil {
+		return err
+	}
+
+	owner, namespace := metaColumns(meta)
+	res, err := b.db.Exec("UPDATE pastes SET meta=?, owner=?, namespace=? WHERE id=?", string(m), owner, namespace, key)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (b *SQLiteBackend) List(filter Filter) (map[string]*Metadata, error) {
+	where, args, err := filterWhere(filter, func(int) string { return "?" })
+	if err != nil {
+		return nil, err
+	}
+	rows, err := b.db.Query("SELECT id, meta FROM pastes WHERE "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pastes := make(map[string]*Metadata)
+	for rows.Next() {
+		var key string
+		var meta sql.NullString
+		if err := rows.Scan(&key, &meta); err != nil {
+			return nil, err
+		}
+		m, err := decodeMetadata([]byte(meta.String))
+		if err != nil {
+			return nil, err
+		}
+		pastes[key] = m
+	}
+	return pastes, rows.Err()
+}
@@ -3,15 +3,111 @@ package backends
 import (
 	"errors"
 	"io"
+	"time"
 )
 
 type Backend interface {
-	Put(r io.Reader) (string, error)
+	// Put stores the contents of r along with meta and returns the generated key.
+	// meta may be nil.
+	Put(r io.Reader, meta *Metadata) (string, error)
+
+	// Get writes the contents of the paste at key to w.
 	Get(key string, w io.Writer) error
+
+	// Stat returns the metadata stored for key, or ErrNotFound.
+	Stat(key string) (*Metadata, error)
+
+	// Delete removes the paste at key and its metadata, or returns ErrNotFound.
+	Delete(key string) error
+
+	// Update replaces the metadata of the paste at key, or returns ErrNotFound.
+	Update(key string, meta *Metadata) error
+
+	// List returns the metadata of the pastes that match filter, by key.
+	List(filter Filter) (map[string]*Metadata, error)
+}
+
+// Filter selects the pastes returned by List. A paste matches if it has every
+// field that is set, and at least one must be set.
+type Filter struct {
+	Owner     string
+	Namespace string
+
+	// All selects every paste, and the other fields are ignored. It reads
+	// the metadata of the whole backend, so it is only used by background
+	// jobs such as the removal of expired pastes.
+	All bool
+}
+
+// Match reports whether meta matches the filter.
+func (f Filter) Match(meta *Metadata) bool {
+	return f.All || ((f.Owner == "" || meta.Owner == f.Owner) && (f.Namespace == "" || meta.Namespace == f.Namespace))
 }
 
 type PathGenFunc func() string
 
+// Metadata describes a stored paste.
+type Metadata struct {
+	// CreatedAt is the time the paste was stored.
+	CreatedAt time.Time `json:"created_at"`
+
+	// ContentType is the MIME type detected when the paste was uploaded.
+	ContentType string `json:"content_type,omitempty"`
+
+	// Language is an optional syntax highlighting hint given at upload.
+	Language string `json:"language,omitempty"`
+
+	// Flags are labels attached to the paste while it was processed, e.g. by the secrets scanner.
+	Flags []string `json:"flags,omitempty"`
+
+	// Owner identifies the client that created the paste, if it authenticated.
+	Owner string `json:"owner,omitempty"`
+
+	// KeyID is the ID of the API key, login or certificate the paste was
+	// created with, if the client authenticated.
+	KeyID string `json:"key_id,omitempty"`
+
+	// SourceIP is the address the paste was uploaded from.
+	SourceIP string `json:"source_ip,omitempty"`
+
+	// Size is the number of bytes stored, after transforms, as counted
+	// against storage quotas. It is not set on pastes stored before quotas
+	// were tracked.
+	Size *int64 `json:"size,omitempty"`
+
+	// Namespace is the team keyspace the paste belongs to, if any. Such pastes
+	// are only served under /{namespace}/.
+	Namespace string `json:"namespace,omitempty"`
+
+	// ExpiresAt is the time after which the paste is no longer served, if set.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// DeleteTokenHash is the SHA-256 hash of the token that allows the paste to be deleted.
+	DeleteTokenHash string `json:"delete_token_hash,omitempty"`
+
+	// BurnAfterRead deletes the paste once it has been read.
+	BurnAfterRead bool `json:"burn_after_read,omitempty"`
+
+	// Hidden stops the paste from being served, after a moderator hid it.
+	Hidden bool `json:"hidden,omitempty"`
+
+	// PasswordHash is the bcrypt hash of the password needed to read the paste, if any.
+	PasswordHash string `json:"password_hash,omitempty"`
+}
+
+// Expired reports whether the paste has expired at time now.
+func (m *Metadata) Expired(now time.Time) bool {
+	return m.ExpiresAt != nil && !now.Before(*m.ExpiresAt)
+}
+
+// Protected reports whether reading the paste needs more than its URL: it has
+// a password, or it is deleted once read.
+func (m *Metadata) Protected() bool {
+	return m.BurnAfterRead || m.PasswordHash != ""
+}
+
 var (
 	ErrFileTooLarge = errors.New("file too large")
+	ErrNotFound     = errors.New("paste not found")
+	ErrEmptyFilter  = errors.New("filter selects every paste")
 )
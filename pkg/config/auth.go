@@ -0,0 +1,114 @@
+package config
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/cbrnrd/pasted/pkg/auth"
+)
+
+// Requires reports whether scope needs an API key.
+func (c *AuthConfig) Requires(scope auth.Scope) bool {
+	return slices.ContainsFunc(c.Require, func(s string) bool {
+		required, err := auth.ParseScope(s)
+		return err == nil && required == scope
+	})
+}
+
+// GetKeyStore returns the store for the configured API keys.
+func (c *AuthConfig) GetKeyStore() (*auth.Store, error) {
+	for _, s := range c.Require {
+		if scope, err := auth.ParseScope(s); err != nil || scope == auth.ScopeAdmin {
+			return nil, fmt.Errorf("auth.require: %q is not \"read\" or \"write\"", s)
+		}
+	}
+	return auth.NewStore(c.KeysFile, c.Keys)
+}
+
+// DefaultSessionLifetime is how long a single sign-on login lasts by default.
+const DefaultSessionLifetime = 12 * time.Hour
+
+// GetOIDC returns the single sign-on provider, or nil if single sign-on is
+// not configured. domain is the public URL of the server.
+func (c *OIDCConfig) GetOIDC(ctx context.Context, domain string) (*auth.OIDC, error) {
+	if c.Issuer == "" {
+		return nil, nil
+	}
+
+	opts := auth.OIDCOptions{
+		Issuer:              c.Issuer,
+		ClientID:            c.ClientID,
+		ClientSecret:        c.ClientSecret,
+		RedirectURL:         c.RedirectURL,
+		Scopes:              c.Scopes,
+		AllowedDomains:      c.AllowedDomains,
+		AssumeEmailVerified: c.AssumeEmailVerified,
+		GroupsClaim:         c.GroupsClaim,
+		AllowedGroups:       c.AllowedGroups,
+		Roles:               map[string][]auth.Scope{},
+	}
+	if opts.RedirectURL == "" {
+		opts.RedirectURL = domain + "/auth/callback"
+	}
+	if opts.Scopes == nil {
+		opts.Scopes = []string{"email", "profile"}
+	}
+	if opts.GroupsClaim == "" {
+		opts.GroupsClaim = "groups"
+	}
+
+	parseScopes := func(names []string) ([]auth.Scope, error) {
+		var scopes []auth.Scope
+		for _, name := range names {
+			scope, err := auth.ParseScope(name)
+			if err != nil {
+				return nil, fmt.Errorf("auth.oidc: %v", err)
+			}
+			scopes = append(scopes, scope)
+		}
+		return scopes, nil
+	}
+	for group, names := range c.Roles {
+		scopes, err := parseScopes(names)
+		if err != nil {
+			return nil, err
+		}
+		opts.Roles[group] = scopes
+	}
+	defaults := c.DefaultRoles
+	if defaults == nil {
+		defaults = []string{"read", "write"}
+	}
+	scopes, err := parseScopes(defaults)
+	if err != nil {
+		return nil, err
+	}
+	opts.DefaultScopes = scopes
+
+	return auth.NewOIDC(ctx, opts)
+}
+
+// GetSessions returns the codec that signs session cookies.
+func (c *OIDCConfig) GetSessions() *auth.Sessions {
+	if c.SessionSecret != "" {
+		secret := sha256.Sum256([]byte(c.SessionSecret))
+		return auth.NewSessions(secret[:])
+	}
+	log.Printf("auth.oidc.session_secret is not set; users will be logged out when the server restarts")
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	return auth.NewSessions(secret)
+}
+
+// GetSessionLifetime returns how long a login lasts.
+func (c *OIDCConfig) GetSessionLifetime() time.Duration {
+	if c.SessionLifetime <= 0 {
+		return DefaultSessionLifetime
+	}
+	return c.SessionLifetime
+}
@@ -1,7 +1,13 @@
 package config
 
 import (
+	"time"
+
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/cbrnrd/pasted/pkg/auth"
+	"github.com/cbrnrd/pasted/pkg/ipfilter"
+	"github.com/cbrnrd/pasted/pkg/pow"
+	"github.com/cbrnrd/pasted/pkg/quota"
 	"github.com/go-redis/redis/v8"
 )
 
@@ -16,21 +22,130 @@ type CLIConfig struct {
 	// ListenAddr is the address to listen on for incoming connections
 	ListenAddr string `yaml:"listen_addr"`
 
+	// Listeners configures several TCP paste listeners. If empty, a single
+	// listener is started on ListenAddr.
+	Listeners []ListenerConfig `yaml:"listeners"`
+
+	// TrustedProxies are the networks of load balancers and reverse proxies
+	// that can pass on client addresses, with the PROXY protocol on paste
+	// listeners and with X-Forwarded-For or X-Real-IP over HTTP
+	TrustedProxies []string `yaml:"trusted_proxies"`
+
 	// HTTPListenAddr is the address to listen on for incoming HTTP connections
 	HttpListenAddr string `yaml:"http_listen_addr"`
 
+	// MetricsListenAddr is the address to serve metrics on. Metrics are disabled if empty.
+	MetricsListenAddr string `yaml:"metrics_listen_addr"`
+
 	// Domain is the domain to use for generating URLs
 	Domain string `yaml:"domain"`
 
 	// TLS is whether or not to use TLS
 	TLS TLSConfig `yaml:"tls"`
 
+	// ContentTypes restricts which detected content types can be pasted
+	ContentTypes ContentTypesConfig `yaml:"content_types"`
+
+	// Images configures the handling of image pastes
+	Images ImagesConfig `yaml:"images"`
+
+	// Expiry configures how long pastes are kept
+	Expiry ExpiryConfig `yaml:"expiry"`
+
+	// Namespaces are team keyspaces, served under /{name}/
+	Namespaces []NamespaceConfig `yaml:"namespaces"`
+
+	// Auth configures API keys
+	Auth AuthConfig `yaml:"auth"`
+
+	// Quotas limits the storage used by each owner, each anonymous client and the server
+	Quotas QuotasConfig `yaml:"quotas"`
+
+	// Moderation configures where abuse reports, bans and the audit trail are kept
+	Moderation ModerationConfig `yaml:"moderation"`
+
+	// ProofOfWork makes anonymous clients solve a challenge before uploading
+	ProofOfWork ProofOfWorkConfig `yaml:"proof_of_work"`
+
+	// IPFilter restricts which networks can connect to the paste and HTTP listeners
+	IPFilter IPFilterConfig `yaml:"ip_filter"`
+
 	Transformers []string `yaml:"transformers"`
 
 	AESTransform struct {
 		Key string `yaml:"key"`
 	} `yaml:"aes_transform"`
 
+	ChaChaTransform struct {
+		Key string `yaml:"key"`
+	} `yaml:"chacha_transform"`
+
+	AgeTransform struct {
+		// Recipients is a list of age ("age1...") or SSH public keys to encrypt to
+		Recipients []string `yaml:"recipients"`
+		// RecipientsFile is an optional file with one recipient per line
+		RecipientsFile string `yaml:"recipients_file"`
+		// IdentityFile is the private key used to decrypt pastes when serving them
+		IdentityFile string `yaml:"identity_file"`
+		// StoreOnly serves the armored ciphertext instead of decrypting it
+		StoreOnly bool `yaml:"store_only"`
+	} `yaml:"age_transform"`
+
+	HMACTransform struct {
+		Key string `yaml:"key"`
+	} `yaml:"hmac_transform"`
+
+	SecretsTransform struct {
+		// Action is one of "redact" (default), "reject" or "flag"
+		Action string `yaml:"action"`
+		// DisableBuiltinRules turns off the built-in credential patterns
+		DisableBuiltinRules bool `yaml:"disable_builtin_rules"`
+		// Rules are additional named regular expressions
+		Rules []struct {
+			Name    string `yaml:"name"`
+			Pattern string `yaml:"pattern"`
+		} `yaml:"rules"`
+		// EntropyThreshold flags tokens with at least this many bits of entropy per character. Zero disables it.
+		EntropyThreshold float64 `yaml:"entropy_threshold"`
+		// EntropyMinLength is the minimum token length considered by the entropy heuristic
+		EntropyMinLength int `yaml:"entropy_min_length"`
+	} `yaml:"secrets_transform"`
+
+	GZipTransform struct {
+		Level int `yaml:"level"`
+	} `yaml:"gzip_transform"`
+
+	ZstdTransform struct {
+		Level int `yaml:"level"`
+		// Dictionary is an optional path to a zstd dictionary file
+		Dictionary string `yaml:"dictionary"`
+	} `yaml:"zstd_transform"`
+
+	BrotliTransform struct {
+		Level int `yaml:"level"`
+	} `yaml:"brotli_transform"`
+
+	XZTransform struct {
+		Level int `yaml:"level"`
+	} `yaml:"xz_transform"`
+
+	LZ4Transform struct {
+		Level int `yaml:"level"`
+	} `yaml:"lz4_transform"`
+
+	AdaptiveTransform struct {
+		// Algorithm is the compression transform to apply when a gain is expected
+		Algorithm string `yaml:"algorithm"`
+		// EntropyThreshold is the entropy in bits per byte above which data is stored as-is
+		EntropyThreshold float64 `yaml:"entropy_threshold"`
+		// SampleSize is the number of leading bytes inspected
+		SampleSize int `yaml:"sample_size"`
+	} `yaml:"adaptive_transform"`
+
+	// ExternalTransforms are named transforms implemented by external programs or
+	// WASM modules, referenced in Transformers as "external:<name>"
+	ExternalTransforms map[string]ExternalTransformConfig `yaml:"external_transforms"`
+
 	PgxConfig struct {
 		ConnString   string `yaml:"conn_string"`
 		CreateTables bool   `yaml:"create_tables"`
@@ -49,6 +164,200 @@ type CLIConfig struct {
 	RedisConfig redis.Options `yaml:"redis"`
 }
 
+type ListenerConfig struct {
+	// Addr is the address to listen on for incoming connections
+	Addr string `yaml:"addr"`
+
+	// Normalize configures the one-way normalization of pastes received on this listener
+	Normalize NormalizeConfig `yaml:"normalize"`
+
+	// TLS serves the listener over TLS, optionally requiring client certificates
+	TLS ListenerTLSConfig `yaml:"tls"`
+
+	// ProxyProtocol reads a PROXY protocol header from connections from
+	// TrustedProxies
+	ProxyProtocol bool `yaml:"proxy_protocol"`
+}
+
+type ListenerTLSConfig struct {
+	TLSConfig `yaml:",inline"`
+
+	// ClientCAFile is a PEM bundle of the CAs that sign client certificates.
+	// If set, clients must present a certificate signed by one of them.
+	ClientCAFile string `yaml:"client_ca_file"`
+
+	// ClientCertOptional also accepts clients without a certificate
+	ClientCertOptional bool `yaml:"client_cert_optional"`
+}
+
+type NormalizeConfig struct {
+	// Enabled turns on normalization
+	Enabled bool `yaml:"enabled"`
+
+	// StripANSI removes ANSI escape sequences such as colors
+	StripANSI bool `yaml:"strip_ansi"`
+
+	// CollapseCarriageReturns keeps only the final state of lines redrawn with '\r'
+	CollapseCarriageReturns bool `yaml:"collapse_carriage_returns"`
+
+	// TrimTrailingWhitespace removes trailing spaces and tabs from each line
+	TrimTrailingWhitespace bool `yaml:"trim_trailing_whitespace"`
+
+	// LineEndings is "lf", "crlf", or empty to keep line endings as they are
+	LineEndings string `yaml:"line_endings"`
+}
+
+type ExternalTransformConfig struct {
+	// Type is "exec" to run a program or "wasm" to run a WASI module
+	Type string `yaml:"type"`
+
+	// Module is the path to the WASI module, for the "wasm" type
+	Module string `yaml:"module"`
+
+	// Transform is the command (exec) or argument list (wasm) for the forward direction
+	Transform []string `yaml:"transform"`
+
+	// Reverse is the command or argument list for the reverse direction.
+	// If empty, the transform is one-way.
+	Reverse []string `yaml:"reverse"`
+
+	// Timeout is the maximum run time of each invocation
+	Timeout time.Duration `yaml:"timeout"`
+
+	// MemoryLimitMB is the maximum memory available to each invocation
+	MemoryLimitMB int64 `yaml:"memory_limit_mb"`
+
+	// MaxOutputBytes is the maximum output size of each invocation
+	MaxOutputBytes int64 `yaml:"max_output_bytes"`
+}
+
+type ContentTypesConfig struct {
+	// Allow lists the MIME types that can be pasted, such as "text/*" or
+	// "image/png". If empty, every type not denied is allowed.
+	Allow []string `yaml:"allow"`
+
+	// Deny lists MIME types that are rejected, checked before Allow
+	Deny []string `yaml:"deny"`
+}
+
+type ImagesConfig struct {
+	// KeepMetadata stores images as uploaded instead of removing EXIF, XMP and text metadata
+	KeepMetadata bool `yaml:"keep_metadata"`
+
+	// ThumbnailSize is the maximum width and height of thumbnails in pixels. Defaults to 320.
+	ThumbnailSize int `yaml:"thumbnail_size"`
+}
+
+type ExpiryConfig struct {
+	// Default is the lifetime of pastes that do not ask for one. Zero keeps them forever.
+	Default time.Duration `yaml:"default"`
+
+	// Max is the longest lifetime a paste can ask for. Zero means no limit.
+	Max time.Duration `yaml:"max"`
+}
+
+type NamespaceConfig struct {
+	// Name is the first segment of the namespace's URLs
+	Name string `yaml:"name"`
+
+	// Members are the owners, as recorded for API keys and single sign-on
+	// users, who can create, list and manage the namespace's pastes
+	Members []string `yaml:"members"`
+
+	// Expiry replaces the global expiry rules for the namespace's pastes
+	Expiry *ExpiryConfig `yaml:"expiry"`
+}
+
+type QuotasConfig struct {
+	quota.Limits `yaml:",inline"`
+}
+
+type ModerationConfig struct {
+	// File keeps abuse reports and bans. If empty, they are only kept in memory.
+	File string `yaml:"file"`
+
+	// AuditLog is the file moderation actions are appended to, one JSON
+	// object per line. If empty, the audit trail is only kept in memory.
+	AuditLog string `yaml:"audit_log"`
+}
+
+type ProofOfWorkConfig struct {
+	// Enabled requires a proof of work from clients without an API key or login
+	Enabled bool `yaml:"enabled"`
+
+	pow.Options `yaml:",inline"`
+}
+
+type IPFilterConfig struct {
+	ipfilter.Rules `yaml:",inline"`
+
+	// File lists more networks to allow and deny, in the same format. It is
+	// reloaded when it changes.
+	File string `yaml:"file"`
+
+	// AutoBan temporarily bans clients that repeatedly break the rate limits
+	// or whose pastes moderators remove
+	AutoBan ipfilter.AutoBan `yaml:"auto_ban"`
+}
+
+type AuthConfig struct {
+	// Require lists the operations that need an API key: "write" for uploads
+	// and "read" for reading pastes. Empty allows anonymous use.
+	Require []string `yaml:"require"`
+
+	// KeysFile is the file maintained by the `pasted keys` commands
+	KeysFile string `yaml:"keys_file"`
+
+	// Keys are additional keys defined in the configuration
+	Keys []*auth.Key `yaml:"keys"`
+
+	// Certificates applies to verified client certificates that no key claims
+	Certificates auth.CertPolicy `yaml:"certificates"`
+
+	// OIDC configures single sign-on for the web interface
+	OIDC OIDCConfig `yaml:"oidc"`
+}
+
+type OIDCConfig struct {
+	// Issuer is the URL of the OpenID Connect provider. Single sign-on is disabled if empty.
+	Issuer string `yaml:"issuer"`
+
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+
+	// RedirectURL is the callback URL registered with the provider. Defaults to Domain + "/auth/callback".
+	RedirectURL string `yaml:"redirect_url"`
+
+	// Scopes are requested from the provider in addition to "openid". Defaults to "email" and "profile".
+	Scopes []string `yaml:"scopes"`
+
+	// AllowedDomains restricts login to users with a verified email in one of these domains
+	AllowedDomains []string `yaml:"allowed_domains"`
+
+	// AssumeEmailVerified trusts email addresses from providers that do not
+	// send the email_verified claim. Addresses are unverified without it.
+	AssumeEmailVerified bool `yaml:"assume_email_verified"`
+
+	// GroupsClaim is the ID token claim that lists the user's groups. Defaults to "groups".
+	GroupsClaim string `yaml:"groups_claim"`
+
+	// AllowedGroups restricts login to members of one of these groups
+	AllowedGroups []string `yaml:"allowed_groups"`
+
+	// Roles maps groups to the scopes ("read", "write", "admin") their members get
+	Roles map[string][]string `yaml:"roles"`
+
+	// DefaultRoles are the scopes every user who can log in gets. Defaults to "read" and "write".
+	DefaultRoles []string `yaml:"default_roles"`
+
+	// SessionSecret signs session cookies. If empty, a random secret is used
+	// and users are logged out when the server restarts.
+	SessionSecret string `yaml:"session_secret"`
+
+	// SessionLifetime is how long a login lasts. Defaults to 12 hours.
+	SessionLifetime time.Duration `yaml:"session_lifetime"`
+}
+
 type TLSConfig struct {
 	// CertFile is the path to the certificate file
 	CertFile string `yaml:"cert_file"`
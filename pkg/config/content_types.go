@@ -0,0 +1,52 @@
+package config
+
+import (
+	"mime"
+	"strings"
+)
+
+// DefaultThumbnailSize is used when images.thumbnail_size is not set.
+const DefaultThumbnailSize = 320
+
+// Allowed reports whether pastes of contentType are accepted.
+func (c *ContentTypesConfig) Allowed(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+	for _, pattern := range c.Deny {
+		if matchMediaType(pattern, mediaType) {
+			return false
+		}
+	}
+	if len(c.Allow) == 0 {
+		return true
+	}
+	for _, pattern := range c.Allow {
+		if matchMediaType(pattern, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchMediaType matches a media type against a pattern such as "image/png",
+// "image/*" or "*/*".
+func matchMediaType(pattern, mediaType string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if pattern == "*/*" || pattern == "*" || pattern == mediaType {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(mediaType, prefix+"/")
+	}
+	return false
+}
+
+// GetThumbnailSize returns the configured thumbnail size or the default.
+func (c *ImagesConfig) GetThumbnailSize() int {
+	if c.ThumbnailSize > 0 {
+		return c.ThumbnailSize
+	}
+	return DefaultThumbnailSize
+}
@@ -0,0 +1,25 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Lifetime returns the lifetime of a paste that asked for requested, which
+// is zero if it did not ask. A zero result means the paste never expires.
+func (c *ExpiryConfig) Lifetime(requested time.Duration) (time.Duration, error) {
+	if requested < 0 {
+		return 0, fmt.Errorf("expiry must not be negative")
+	}
+	if requested == 0 {
+		requested = c.Default
+		if c.Max > 0 && (requested == 0 || requested > c.Max) {
+			requested = c.Max
+		}
+		return requested, nil
+	}
+	if c.Max > 0 && requested > c.Max {
+		return 0, fmt.Errorf("expiry must be at most %s", c.Max)
+	}
+	return requested, nil
+}
@@ -0,0 +1,20 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/cbrnrd/pasted/pkg/ipfilter"
+)
+
+// GetIPFilter returns the filter for the configured allow and deny lists.
+func (c *IPFilterConfig) GetIPFilter() (*ipfilter.Filter, error) {
+	a := c.AutoBan
+	if a.RateLimitViolations < 0 || a.ModeratedPastes < 0 || a.Window < 0 || a.Duration < 0 {
+		return nil, fmt.Errorf("ip_filter.auto_ban: values cannot be negative")
+	}
+	filter, err := ipfilter.New(c.Rules, c.File, c.AutoBan)
+	if err != nil {
+		return nil, fmt.Errorf("ip_filter: %v", err)
+	}
+	return filter, nil
+}
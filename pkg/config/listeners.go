@@ -0,0 +1,73 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/cbrnrd/pasted/pkg/transforms"
+)
+
+// GetListeners returns the configured TCP paste listeners.
+func (config *CLIConfig) GetListeners() []ListenerConfig {
+	if len(config.Listeners) > 0 {
+		return config.Listeners
+	}
+	return []ListenerConfig{{Addr: config.ListenAddr}}
+}
+
+// GetTransforms returns the transformers that run on this listener only, ahead of the global chain.
+func (l *ListenerConfig) GetTransforms() ([]transforms.Transformer, error) {
+	var t []transforms.Transformer
+	if l.Normalize.Enabled {
+		n, err := transforms.NewNormalizeTransformer(transforms.NormalizeOptions{
+			StripANSI:               l.Normalize.StripANSI,
+			CollapseCarriageReturns: l.Normalize.CollapseCarriageReturns,
+			TrimTrailingWhitespace:  l.Normalize.TrimTrailingWhitespace,
+			LineEndings:             l.Normalize.LineEndings,
+		})
+		if err != nil {
+			return nil, err
+		}
+		t = append(t, n)
+	}
+	return t, nil
+}
+
+// GetTLSConfig returns the TLS configuration of the listener, or nil if it
+// does not use TLS.
+func (l *ListenerConfig) GetTLSConfig() (*tls.Config, error) {
+	if l.TLS.CertFile == "" && l.TLS.KeyFile == "" {
+		if l.TLS.ClientCAFile != "" {
+			return nil, fmt.Errorf("listener %s: client_ca_file needs cert_file and key_file", l.Addr)
+		}
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(l.TLS.CertFile, l.TLS.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("listener %s: %v", l.Addr, err)
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if l.TLS.ClientCAFile != "" {
+		pem, err := os.ReadFile(l.TLS.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("listener %s: %v", l.Addr, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("listener %s: no certificates in %s", l.Addr, l.TLS.ClientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		if l.TLS.ClientCertOptional {
+			cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,8 @@
+package config
+
+import "github.com/cbrnrd/pasted/pkg/moderation"
+
+// GetModerationStore returns the store for abuse reports, bans and the audit trail.
+func (c *ModerationConfig) GetModerationStore() (*moderation.Store, error) {
+	return moderation.NewStore(c.File, c.AuditLog)
+}
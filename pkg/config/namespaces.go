@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+
+	"github.com/cbrnrd/pasted/pkg/auth"
+)
+
+// validNamespace matches namespace names, which appear in URLs.
+var validNamespace = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// reservedNamespaces are the first path segments of the web server's own routes.
+var reservedNamespaces = []string{"admin", "api", "auth", "my", "raw", "report", "static", "thumb"}
+
+// CheckNamespaces reports the first invalid namespace.
+func (c *CLIConfig) CheckNamespaces() error {
+	seen := map[string]bool{}
+	for _, ns := range c.Namespaces {
+		switch {
+		case !validNamespace.MatchString(ns.Name):
+			return fmt.Errorf("namespaces: %q must be lowercase letters, digits and dashes", ns.Name)
+		case slices.Contains(reservedNamespaces, ns.Name):
+			return fmt.Errorf("namespaces: %q is reserved", ns.Name)
+		case seen[ns.Name]:
+			return fmt.Errorf("namespaces: %q is defined twice", ns.Name)
+		}
+		seen[ns.Name] = true
+	}
+	return nil
+}
+
+// Namespace returns the namespace called name, or nil.
+func (c *CLIConfig) Namespace(name string) *NamespaceConfig {
+	for i := range c.Namespaces {
+		if c.Namespaces[i].Name == name {
+			return &c.Namespaces[i]
+		}
+	}
+	return nil
+}
+
+// ExpiryFor returns the expiry rules for pastes in namespace, which may be empty.
+func (c *CLIConfig) ExpiryFor(namespace string) *ExpiryConfig {
+	if ns := c.Namespace(namespace); ns != nil && ns.Expiry != nil {
+		return ns.Expiry
+	}
+	return &c.Expiry
+}
+
+// IsMember reports whether key can create and manage the namespace's pastes.
+// Admin keys can manage every namespace.
+func (n *NamespaceConfig) IsMember(key *auth.Key) bool {
+	return key != nil && (key.Has(auth.ScopeAdmin) || slices.Contains(n.Members, key.OwnerName()))
+}
+
+// MemberOf returns the names of the namespaces key is a member of.
+func (c *CLIConfig) MemberOf(key *auth.Key) []string {
+	var names []string
+	for i := range c.Namespaces {
+		if c.Namespaces[i].IsMember(key) {
+			names = append(names, c.Namespaces[i].Name)
+		}
+	}
+	return names
+}
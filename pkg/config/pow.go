@@ -0,0 +1,20 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/cbrnrd/pasted/pkg/pow"
+)
+
+// GetProofOfWork returns the verifier for proofs of work, or nil if they are
+// not required.
+func (c *ProofOfWorkConfig) GetProofOfWork() (*pow.Verifier, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+	v, err := pow.New(c.Options)
+	if err != nil {
+		return nil, fmt.Errorf("proof_of_work: %v", err)
+	}
+	return v, nil
+}
@@ -0,0 +1,27 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/cbrnrd/pasted/pkg/ipfilter"
+)
+
+// GetTrustedProxies returns the networks of the trusted proxies. It fails if
+// a listener uses the PROXY protocol without any.
+func (config *CLIConfig) GetTrustedProxies() ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, s := range config.TrustedProxies {
+		p, err := ipfilter.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("trusted_proxies: %v", err)
+		}
+		proxies = append(proxies, p)
+	}
+	for _, lc := range config.GetListeners() {
+		if lc.ProxyProtocol && len(proxies) == 0 {
+			return nil, fmt.Errorf("listener %s: proxy_protocol needs trusted_proxies", lc.Addr)
+		}
+	}
+	return proxies, nil
+}
@@ -0,0 +1,17 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/cbrnrd/pasted/pkg/quota"
+)
+
+// GetQuotaTracker returns the tracker for the configured storage quotas.
+func (c *QuotasConfig) GetQuotaTracker() (*quota.Tracker, error) {
+	for name, l := range map[string]quota.Limit{"per_owner": c.PerOwner, "per_ip": c.PerIP, "global": c.Global} {
+		if l.Bytes < 0 || l.Pastes < 0 {
+			return nil, fmt.Errorf("quotas.%s: limits cannot be negative", name)
+		}
+	}
+	return quota.NewTracker(c.Limits), nil
+}
@@ -3,28 +3,147 @@ package config
 import (
 	"crypto/sha256"
 	"fmt"
+	"os"
+	"regexp"
+	"strings"
 
+	"filippo.io/age"
 	"github.com/cbrnrd/pasted/pkg/transforms"
 )
 
 func (config *CLIConfig) GetTransforms() ([]transforms.Transformer, error) {
 	var t []transforms.Transformer
 	for _, tc := range config.Transformers {
-		switch tc {
-		case "aes":
-			hash := sha256.Sum256([]byte(config.AESTransform.Key))
-			aesTransformer, err := transforms.NewAESTransformer(hash[:])
+		transformer, err := config.getTransform(tc)
+		if err != nil {
+			return nil, err
+		}
+		t = append(t, transformer)
+	}
+	return t, nil
+}
+
+// getTransform creates the transformer with the given name from the configuration.
+func (config *CLIConfig) getTransform(name string) (transforms.Transformer, error) {
+	if ext, ok := strings.CutPrefix(name, "external:"); ok {
+		return config.getExternalTransform(ext)
+	}
+
+	switch name {
+	case "aes":
+		hash := sha256.Sum256([]byte(config.AESTransform.Key))
+		return transforms.NewAESTransformer(hash[:])
+	case "chacha20", "xchacha20":
+		hash := sha256.Sum256([]byte(config.ChaChaTransform.Key))
+		return transforms.NewChaChaTransformer(hash[:], name == "xchacha20")
+	case "age":
+		var recipients []age.Recipient
+		for _, rs := range config.AgeTransform.Recipients {
+			r, err := transforms.ParseAgeRecipient(rs)
+			if err != nil {
+				return nil, fmt.Errorf("invalid age recipient: %v", err)
+			}
+			recipients = append(recipients, r)
+		}
+		if config.AgeTransform.RecipientsFile != "" {
+			rs, err := transforms.ParseAgeRecipientsFile(config.AgeTransform.RecipientsFile)
+			if err != nil {
+				return nil, fmt.Errorf("could not read age recipients file: %v", err)
+			}
+			recipients = append(recipients, rs...)
+		}
+		var identities []age.Identity
+		if config.AgeTransform.IdentityFile != "" {
+			ids, err := transforms.ParseAgeIdentityFile(config.AgeTransform.IdentityFile)
+			if err != nil {
+				return nil, fmt.Errorf("could not read age identity file: %v", err)
+			}
+			identities = ids
+		}
+		return transforms.NewAgeTransformer(recipients, identities, config.AgeTransform.StoreOnly)
+	case "hmac":
+		return transforms.NewHMACTransformer([]byte(config.HMACTransform.Key))
+	case "secrets":
+		var rules []transforms.SecretRule
+		if !config.SecretsTransform.DisableBuiltinRules {
+			rules = append(rules, transforms.BuiltinSecretRules...)
+		}
+		for _, r := range config.SecretsTransform.Rules {
+			re, err := regexp.Compile(r.Pattern)
 			if err != nil {
-				return nil, err
+				return nil, fmt.Errorf("invalid secrets rule %s: %v", r.Name, err)
 			}
-			t = append(t, aesTransformer)
-		case "gzip":
-			t = append(t, &transforms.GZipTransformer{})
-		case "base64":
-			t = append(t, &transforms.Base64Transformer{})
+			rules = append(rules, transforms.SecretRule{Name: r.Name, Pattern: re})
+		}
+		return transforms.NewSecretsTransformer(rules, transforms.SecretAction(config.SecretsTransform.Action),
+			config.SecretsTransform.EntropyThreshold, config.SecretsTransform.EntropyMinLength)
+	case "gzip":
+		return transforms.NewGZipTransformer(config.GZipTransform.Level), nil
+	case "zstd":
+		var dict []byte
+		if config.ZstdTransform.Dictionary != "" {
+			d, err := os.ReadFile(config.ZstdTransform.Dictionary)
+			if err != nil {
+				return nil, fmt.Errorf("could not read zstd dictionary: %v", err)
+			}
+			dict = d
+		}
+		return transforms.NewZstdTransformer(config.ZstdTransform.Level, dict), nil
+	case "brotli":
+		return transforms.NewBrotliTransformer(config.BrotliTransform.Level), nil
+	case "xz":
+		return transforms.NewXZTransformer(config.XZTransform.Level)
+	case "lz4":
+		return transforms.NewLZ4Transformer(config.LZ4Transform.Level)
+	case "adaptive":
+		algorithm := config.AdaptiveTransform.Algorithm
+		if algorithm == "" {
+			algorithm = "gzip"
+		}
+		switch algorithm {
+		case "gzip", "zstd", "brotli", "xz", "lz4":
 		default:
-			return nil, fmt.Errorf("unknown transform %s", tc)
+			return nil, fmt.Errorf("adaptive transform requires a compression algorithm, got %s", algorithm)
+		}
+		inner, err := config.getTransform(algorithm)
+		if err != nil {
+			return nil, err
 		}
+		return transforms.NewAdaptiveTransformer(inner, config.AdaptiveTransform.EntropyThreshold, config.AdaptiveTransform.SampleSize)
+	case "base64":
+		return &transforms.Base64Transformer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown transform %s", name)
+	}
+}
+
+// getExternalTransform creates the external transformer with the given name.
+func (config *CLIConfig) getExternalTransform(name string) (transforms.Transformer, error) {
+	ec, ok := config.ExternalTransforms[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown external transform %s", name)
+	}
+
+	limits := transforms.ExternalLimits{
+		Timeout:     ec.Timeout,
+		MemoryLimit: ec.MemoryLimitMB * 1024 * 1024,
+		MaxOutput:   ec.MaxOutputBytes,
+	}
+
+	switch ec.Type {
+	case "exec", "":
+		return transforms.NewExecTransformer(ec.Transform, ec.Reverse, limits)
+	case "wasm":
+		wasm, err := os.ReadFile(ec.Module)
+		if err != nil {
+			return nil, fmt.Errorf("could not read wasm module: %v", err)
+		}
+		var reverse []string
+		if len(ec.Reverse) > 0 {
+			reverse = ec.Reverse
+		}
+		return transforms.NewWASMTransformer(wasm, ec.Transform, reverse, limits)
+	default:
+		return nil, fmt.Errorf("unknown external transform type %s", ec.Type)
 	}
-	return t, nil
 }
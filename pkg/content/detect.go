@@ -0,0 +1,131 @@
+package content
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cbrnrd/pasted/pkg/asciicast"
+)
+
+// SampleSize is the number of leading bytes Detect needs to classify a paste.
+const SampleSize = 8192
+
+// Fallback content types.
+const (
+	TypeText   = "text/plain; charset=utf-8"
+	TypeBinary = "application/octet-stream"
+)
+
+// magic lists signatures not recognized by http.DetectContentType.
+var magic = []struct {
+	offset      int
+	sig         []byte
+	contentType string
+}{
+	{0, []byte{0x28, 0xb5, 0x2f, 0xfd}, "application/zstd"},
+	{0, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, "application/x-xz"},
+	{0, []byte("BZh"), "application/x-bzip2"},
+	{0, []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c}, "application/x-7z-compressed"},
+	{0, []byte{0x04, 0x22, 0x4d, 0x18}, "application/x-lz4"},
+	{257, []byte("ustar"), "application/x-tar"},
+	{0, []byte{0x7f, 'E', 'L', 'F'}, "application/x-elf"},
+	{0, []byte("SQLite format 3\x00"), "application/vnd.sqlite3"},
+}
+
+// Detect returns the MIME type of a paste from its leading bytes.
+//
+// Binary formats are identified by their magic numbers. Text is reported as
+// text/plain (or the more specific type found by http.DetectContentType) with
+// a charset of utf-8, utf-16 or windows-1252.
+func Detect(sample []byte) string {
+	if len(sample) > SampleSize {
+		sample = sample[:SampleSize]
+	}
+	for _, m := range magic {
+		if len(sample) >= m.offset+len(m.sig) && bytes.Equal(sample[m.offset:m.offset+len(m.sig)], m.sig) {
+			return m.contentType
+		}
+	}
+
+	ct := http.DetectContentType(sample)
+	mediaType, params, err := mime.ParseMediaType(ct)
+	if err != nil || params["charset"] != "utf-8" {
+		return ct
+	}
+
+	// http.DetectContentType assumes utf-8 for any text without a BOM.
+	if !validUTF8Prefix(sample) {
+		return mime.FormatMediaType(mediaType, map[string]string{"charset": "windows-1252"})
+	}
+
+	if mediaType == "text/plain" {
+		switch {
+		case asciicast.Sniff(sample):
+			return asciicast.ContentType
+		case looksLikeJSON(sample):
+			return "application/json"
+		case ansiSGR.Match(sample):
+			return "text/x-ansi; charset=utf-8"
+		}
+	}
+	return ct
+}
+
+// ansiSGR matches an ANSI color or style escape sequence.
+var ansiSGR = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// looksLikeJSON reports whether sample is a JSON object or array, allowing it
+// to be cut off at the end of the sample.
+func looksLikeJSON(sample []byte) bool {
+	trimmed := bytes.TrimSpace(sample)
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return false
+	}
+	if len(sample) < SampleSize {
+		return json.Valid(trimmed)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(trimmed))
+	for {
+		_, err := dec.Token()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return true
+		}
+		if err != nil {
+			return false
+		}
+	}
+}
+
+// validUTF8Prefix reports whether sample is valid UTF-8, allowing a rune
+// truncated at the end of the sample.
+func validUTF8Prefix(sample []byte) bool {
+	if utf8.Valid(sample) {
+		return true
+	}
+	for i := 1; i < utf8.UTFMax && i <= len(sample); i++ {
+		if utf8.RuneStart(sample[len(sample)-i]) {
+			return utf8.Valid(sample[:len(sample)-i])
+		}
+	}
+	return false
+}
+
+// IsText reports whether contentType is a textual type.
+func IsText(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") ||
+		mediaType == "application/json" ||
+		mediaType == asciicast.ContentType ||
+		mediaType == "application/xml" ||
+		mediaType == "application/javascript"
+}
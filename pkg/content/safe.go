@@ -0,0 +1,74 @@
+package content
+
+import (
+	"mime"
+	"strings"
+
+	"github.com/cbrnrd/pasted/pkg/asciicast"
+)
+
+// inlineTypes are served with their own type because browsers cannot run scripts from them.
+var inlineTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+	"image/bmp":  ".bmp",
+	"audio/mpeg": ".mp3",
+	"audio/ogg":  ".ogg",
+	"audio/wave": ".wav",
+	"video/mp4":  ".mp4",
+	"video/webm": ".webm",
+}
+
+// textExtensions are filename extensions for text types that are not plain text.
+var textExtensions = map[string]string{
+	asciicast.ContentType: ".cast",
+}
+
+// Response describes how a paste should be served.
+type Response struct {
+	// ContentType is the Content-Type header to send.
+	ContentType string
+
+	// Inline is false if the paste should be downloaded rather than displayed.
+	Inline bool
+
+	// Extension is a file extension for the Content-Disposition filename.
+	Extension string
+}
+
+// Safe maps a detected content type to one that is safe to serve.
+//
+// Text of any kind, including HTML, SVG and JavaScript, is served as
+// text/plain so that it cannot run scripts in the browser. Images, audio and
+// video are served inline with their own type. Everything else is served as
+// application/octet-stream for download.
+func Safe(contentType string) Response {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || contentType == "" {
+		return Response{ContentType: TypeBinary, Extension: ".bin"}
+	}
+
+	if ext, ok := inlineTypes[mediaType]; ok {
+		return Response{ContentType: mediaType, Inline: true, Extension: ext}
+	}
+
+	if IsText(contentType) || strings.HasSuffix(mediaType, "+xml") {
+		charset := params["charset"]
+		if charset == "" {
+			charset = "utf-8"
+		}
+		ext, ok := textExtensions[mediaType]
+		if !ok {
+			ext = ".txt"
+		}
+		return Response{
+			ContentType: mime.FormatMediaType("text/plain", map[string]string{"charset": charset}),
+			Inline:      true,
+			Extension:   ext,
+		}
+	}
+
+	return Response{ContentType: TypeBinary, Extension: ".bin"}
+}
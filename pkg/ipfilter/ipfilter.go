@@ -0,0 +1,371 @@
+// Package ipfilter decides which clients may connect, from lists of allowed
+// and denied networks and from temporary bans placed on clients that
+// repeatedly misbehave.
+package ipfilter
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cbrnrd/pasted/pkg/metrics"
+	"gopkg.in/yaml.v3"
+)
+
+// Rules are the networks that may and may not connect, as addresses or in
+// CIDR notation.
+type Rules struct {
+	// Allow lists the only networks that may connect. If empty, every
+	// network that is not denied may.
+	Allow []string `yaml:"allow"`
+
+	// Deny lists networks that may not connect, even if they are allowed.
+	Deny []string `yaml:"deny"`
+}
+
+// AutoBan configures temporary bans of clients that repeatedly misbehave.
+// A zero threshold disables banning for that reason.
+type AutoBan struct {
+	// RateLimitViolations is the number of requests over the HTTP rate limits
+	// within Window after which a client is banned.
+	RateLimitViolations int `yaml:"rate_limit_violations"`
+
+	// ModeratedPastes is the number of a client's pastes moderators can hide
+	// or delete within Window before it is banned.
+	ModeratedPastes int `yaml:"moderated_pastes"`
+
+	// Window is the period violations are counted over. Defaults to an hour.
+	Window time.Duration `yaml:"window"`
+
+	// Duration is how long bans last. Defaults to an hour.
+	Duration time.Duration `yaml:"duration"`
+}
+
+// Strike is a reason to count towards an automatic ban.
+type Strike int
+
+const (
+	// StrikeRateLimit is a request over a rate limit.
+	StrikeRateLimit Strike = iota
+	// StrikeModerated is a paste hidden or deleted by a moderator.
+	StrikeModerated
+)
+
+func (s Strike) String() string {
+	if s == StrikeModerated {
+		return "pastes removed by moderators"
+	}
+	return "rate limit violations"
+}
+
+// Ban is a temporary ban placed automatically.
+type Ban struct {
+	// Network is the banned network: the client's address, or its /64 for
+	// IPv6 clients, which usually have all of one.
+	Network netip.Prefix
+
+	Reason    string
+	ExpiresAt time.Time
+}
+
+// reloadInterval is how often the rules file is checked for changes.
+const reloadInterval = time.Second
+
+// networks are parsed rules.
+type networks struct {
+	allow, deny []netip.Prefix
+}
+
+// strikes counts a client's strikes in the current window.
+type strikes struct {
+	start  time.Time
+	counts [2]int
+}
+
+// Filter checks clients against the configured rules, the rules file and
+// temporary bans. The rules file is reloaded when it changes, so networks
+// can be blocked without a restart.
+type Filter struct {
+	path    string
+	static  networks
+	autoBan AutoBan
+
+	mu       sync.Mutex
+	checked  time.Time
+	modTime  time.Time
+	networks networks
+	bans     map[netip.Prefix]*Ban
+	strikes  map[netip.Prefix]*strikes
+	swept    time.Time
+}
+
+// New returns a filter for the rules in static and in the rules file at
+// path, which may be empty. The file has the same format as Rules and may
+// not exist yet.
+func New(static Rules, path string, autoBan AutoBan) (*Filter, error) {
+	nets, err := static.parse()
+	if err != nil {
+		return nil, err
+	}
+	if autoBan.Window <= 0 {
+		autoBan.Window = time.Hour
+	}
+	if autoBan.Duration <= 0 {
+		autoBan.Duration = time.Hour
+	}
+	f := &Filter{
+		path:     path,
+		static:   nets,
+		autoBan:  autoBan,
+		networks: nets,
+		bans:     map[netip.Prefix]*Ban{},
+		strikes:  map[netip.Prefix]*strikes{},
+	}
+	if path != "" {
+		if err := f.reload(true); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// parse parses the networks in r.
+func (r Rules) parse() (networks, error) {
+	var nets networks
+	for _, list := range []struct {
+		name  string
+		rules []string
+		dst   *[]netip.Prefix
+	}{{"allow", r.Allow, &nets.allow}, {"deny", r.Deny, &nets.deny}} {
+		for _, rule := range list.rules {
+			prefix, err := ParsePrefix(rule)
+			if err != nil {
+				return networks{}, fmt.Errorf("%s: %v", list.name, err)
+			}
+			*list.dst = append(*list.dst, prefix)
+		}
+	}
+	return nets, nil
+}
+
+// ParsePrefix parses a network in CIDR notation or a single address.
+func ParsePrefix(s string) (netip.Prefix, error) {
+	if prefix, err := netip.ParsePrefix(s); err == nil {
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid network %q", s)
+	}
+	return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+}
+
+// reload reads the rules file if it has changed since it was last read. The
+// caller must hold f.mu, except during New. If the file cannot be read, the
+// rules from the last good read are kept.
+func (f *Filter) reload(force bool) error {
+	now := time.Now()
+	if !force && now.Sub(f.checked) < reloadInterval {
+		return nil
+	}
+	f.checked = now
+
+	info, err := os.Stat(f.path)
+	var modTime time.Time
+	if err == nil {
+		modTime = info.ModTime()
+	}
+	if !force && modTime.Equal(f.modTime) {
+		return nil
+	}
+
+	var rules Rules
+	data, err := os.ReadFile(f.path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		if err := yaml.Unmarshal(data, &rules); err != nil {
+			return fmt.Errorf("could not parse %s: %v", f.path, err)
+		}
+	}
+	nets, err := rules.parse()
+	if err != nil {
+		return fmt.Errorf("%s: %v", f.path, err)
+	}
+	f.modTime = modTime
+	f.networks = networks{
+		allow: append(append([]netip.Prefix(nil), f.static.allow...), nets.allow...),
+		deny:  append(append([]netip.Prefix(nil), f.static.deny...), nets.deny...),
+	}
+	return nil
+}
+
+// Allowed reports whether the client at addr may connect. Clients whose
+// address is unknown are only allowed if no allow list is configured.
+// Refusals are counted in metrics.
+func (f *Filter) Allowed(addr netip.Addr) bool {
+	if !f.allowed(addr.Unmap(), time.Now()) {
+		metrics.IPFilterRejections.Add(1)
+		return false
+	}
+	return true
+}
+
+func (f *Filter) allowed(addr netip.Addr, now time.Time) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.path != "" {
+		if err := f.reload(false); err != nil {
+			log.Printf("could not reload IP filter file, keeping the previous rules: %v", err)
+		}
+	}
+	if !addr.IsValid() {
+		return len(f.networks.allow) == 0
+	}
+	if contains(f.networks.deny, addr) {
+		return false
+	}
+	if len(f.networks.allow) > 0 && !contains(f.networks.allow, addr) {
+		return false
+	}
+	network := banNetwork(addr)
+	if ban, ok := f.bans[network]; ok {
+		if now.Before(ban.ExpiresAt) {
+			return false
+		}
+		delete(f.bans, network)
+	}
+	return true
+}
+
+func contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// banNetwork returns the network banned for misbehaviour from addr.
+func banNetwork(addr netip.Addr) netip.Prefix {
+	bits := 32
+	if addr.Is6() {
+		bits = 64
+	}
+	prefix, _ := addr.Prefix(bits)
+	return prefix
+}
+
+// Strike counts a strike of kind against the client at addr. Once the
+// client reaches the configured number of strikes within the window, it is
+// banned and the ban is returned.
+func (f *Filter) Strike(addr netip.Addr, kind Strike) *Ban {
+	threshold := f.autoBan.RateLimitViolations
+	if kind == StrikeModerated {
+		threshold = f.autoBan.ModeratedPastes
+	}
+	addr = addr.Unmap()
+	if threshold <= 0 || !addr.IsValid() {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	f.sweep(now)
+	network := banNetwork(addr)
+	if ban, ok := f.bans[network]; ok && now.Before(ban.ExpiresAt) {
+		return nil
+	}
+	s, ok := f.strikes[network]
+	if !ok || now.Sub(s.start) > f.autoBan.Window {
+		s = &strikes{start: now}
+		f.strikes[network] = s
+	}
+	s.counts[kind]++
+	if s.counts[kind] < threshold {
+		return nil
+	}
+
+	delete(f.strikes, network)
+	ban := &Ban{
+		Network:   network,
+		Reason:    fmt.Sprintf("%d %s within %s", s.counts[kind], kind, f.autoBan.Window),
+		ExpiresAt: now.Add(f.autoBan.Duration).UTC(),
+	}
+	f.bans[network] = ban
+	metrics.AutoBans.Add(1)
+	log.Printf("banned %s until %s for %s", network, ban.ExpiresAt.Format(time.RFC3339), ban.Reason)
+	copied := *ban
+	return &copied
+}
+
+// sweep forgets strikes and bans that no longer matter, at most once per
+// window. The caller must hold f.mu.
+func (f *Filter) sweep(now time.Time) {
+	if now.Sub(f.swept) < f.autoBan.Window {
+		return
+	}
+	f.swept = now
+	for network, s := range f.strikes {
+		if now.Sub(s.start) > f.autoBan.Window {
+			delete(f.strikes, network)
+		}
+	}
+	for network, ban := range f.bans {
+		if !now.Before(ban.ExpiresAt) {
+			delete(f.bans, network)
+		}
+	}
+}
+
+// Listener returns a listener that closes connections from clients the
+// filter does not allow as soon as they are accepted.
+func (f *Filter) Listener(l net.Listener) net.Listener {
+	return &listener{Listener: l, filter: f}
+}
+
+type listener struct {
+	net.Listener
+	filter *Filter
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if l.filter.Allowed(AddrOf(conn.RemoteAddr())) {
+			return conn, nil
+		}
+		conn.Close()
+	}
+}
+
+// AddrOf returns the IP address of addr, or the zero Addr if it has none.
+func AddrOf(addr net.Addr) netip.Addr {
+	if addr == nil {
+		return netip.Addr{}
+	}
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		ip, _ := netip.AddrFromSlice(tcp.IP)
+		return ip.Unmap()
+	}
+	addrPort, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addrPort.Addr().Unmap()
+}
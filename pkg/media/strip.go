@@ -0,0 +1,167 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"mime"
+)
+
+// ErrMalformed is returned when an image cannot be parsed well enough to strip it.
+var ErrMalformed = errors.New("malformed image")
+
+// strippers remove metadata from images of each type.
+var strippers = map[string]func([]byte) ([]byte, error){
+	"image/jpeg": stripJPEG,
+	"image/png":  stripPNG,
+	"image/webp": stripWebP,
+}
+
+// CanStrip reports whether StripMetadata supports contentType.
+func CanStrip(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	_, ok := strippers[mediaType]
+	return ok
+}
+
+// StripMetadata removes EXIF, XMP and text metadata, such as camera details
+// and GPS coordinates, from a JPEG, PNG or WebP image. The image data itself
+// is not re-encoded. Other types are returned unchanged.
+//
+// EXIF orientation is removed along with the rest, so photos that rely on it
+// are shown as stored by the camera.
+func StripMetadata(contentType string, data []byte) ([]byte, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	strip, ok := strippers[mediaType]
+	if !ok {
+		return data, nil
+	}
+	return strip(data)
+}
+
+// stripJPEG drops APP1 (EXIF and XMP), APP13 (IPTC) and comment segments.
+func stripJPEG(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil, ErrMalformed
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+
+	pos := 2
+	for {
+		if pos+4 > len(data) || data[pos] != 0xff {
+			return nil, ErrMalformed
+		}
+		marker := data[pos+1]
+		if marker == 0xff {
+			// Fill byte before a marker.
+			pos++
+			continue
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, ErrMalformed
+		}
+
+		switch marker {
+		case 0xe1, 0xed, 0xfe:
+			// APP1, APP13, COM
+		default:
+			out.Write(data[pos:end])
+		}
+		pos = end
+
+		// Start of scan: the entropy-coded data and everything after it is kept.
+		if marker == 0xda {
+			out.Write(data[pos:])
+			return out.Bytes(), nil
+		}
+	}
+}
+
+// pngSignature starts every PNG file.
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngMetadataChunks are ancillary chunks that carry metadata rather than image data.
+var pngMetadataChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+// stripPNG drops EXIF, text and timestamp chunks. Each chunk has its own CRC,
+// so the remaining chunks are copied unchanged.
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, ErrMalformed
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(pngSignature)
+
+	pos := len(pngSignature)
+	for pos < len(data) {
+		if pos+12 > len(data) {
+			return nil, ErrMalformed
+		}
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		end := pos + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, ErrMalformed
+		}
+		if !pngMetadataChunks[string(data[pos+4:pos+8])] {
+			out.Write(data[pos:end])
+		}
+		pos = end
+	}
+	return out.Bytes(), nil
+}
+
+// WebP VP8X feature flags for metadata chunks.
+const (
+	webpFlagXMP  = 1 << 2
+	webpFlagEXIF = 1 << 3
+)
+
+// stripWebP drops EXIF and XMP chunks, clears their flags in the VP8X header
+// and fixes the RIFF size.
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrMalformed
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:12])
+
+	pos := 12
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return nil, ErrMalformed
+		}
+		fourCC := string(data[pos : pos+4])
+		length := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		// Chunks are padded to an even length.
+		end := pos + 8 + length + length&1
+		if length < 0 || end > len(data) {
+			return nil, ErrMalformed
+		}
+
+		switch fourCC {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := bytes.Clone(data[pos:end])
+			if len(chunk) > 8 {
+				chunk[8] &^= webpFlagEXIF | webpFlagXMP
+			}
+			out.Write(chunk)
+		default:
+			out.Write(data[pos:end])
+		}
+		pos = end
+	}
+
+	stripped := out.Bytes()
+	binary.LittleEndian.PutUint32(stripped[4:], uint32(len(stripped)-8))
+	return stripped, nil
+}
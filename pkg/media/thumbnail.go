@@ -0,0 +1,63 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+
+	// Decoders for the image types that pastes can be previewed as.
+	_ "image/gif"
+	_ "image/jpeg"
+
+	_ "golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// MaxPixels is the largest image, in pixels, that will be decoded. It guards
+// against small files that decompress to huge images.
+const MaxPixels = 50_000_000
+
+// Config returns the format and dimensions of an image without decoding it.
+func Config(data []byte) (format string, width, height int, err error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", 0, 0, err
+	}
+	return format, cfg.Width, cfg.Height, nil
+}
+
+// Thumbnail scales an image to fit within size×size pixels and encodes it as
+// PNG. Images that already fit are re-encoded at their own size.
+func Thumbnail(data []byte, size int) ([]byte, error) {
+	_, width, height, err := Config(data)
+	if err != nil {
+		return nil, err
+	}
+	if width*height > MaxPixels {
+		return nil, fmt.Errorf("image is too large to preview (%dx%d)", width, height)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	w, h := width, height
+	if w > size || h > size {
+		if w >= h {
+			w, h = size, max(1, height*size/width)
+		} else {
+			w, h = max(1, width*size/height), size
+		}
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, dst); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"expvar"
+	"net/http"
+)
+
+// Counters exported under /debug/vars on the metrics listener.
+var (
+	// PastesCreated counts pastes stored successfully.
+	PastesCreated = expvar.NewInt("pastes_created")
+
+	// PastesRejected counts uploads refused by a transformer, e.g. for containing secrets.
+	PastesRejected = expvar.NewInt("pastes_rejected")
+
+	// PastesServed counts pastes returned successfully.
+	PastesServed = expvar.NewInt("pastes_served")
+
+	// PastesExpired counts expired pastes deleted in the background.
+	PastesExpired = expvar.NewInt("pastes_expired")
+
+	// TransformErrors counts failed forward or reverse transformations,
+	// excluding integrity failures.
+	TransformErrors = expvar.NewInt("transform_errors")
+
+	// IntegrityFailures counts pastes that failed an integrity check on read.
+	IntegrityFailures = expvar.NewInt("integrity_failures")
+
+	// BackendErrors counts failed backend reads and writes.
+	BackendErrors = expvar.NewInt("backend_errors")
+
+	// AuthFailures counts requests and uploads refused for a missing or
+	// invalid API key, or one without the needed scope.
+	AuthFailures = expvar.NewInt("auth_failures")
+
+	// QuotaRejections counts uploads refused for exceeding a storage quota.
+	QuotaRejections = expvar.NewInt("quota_rejections")
+
+	// IPFilterRejections counts connections and requests refused by the IP
+	// allow and deny lists or a temporary ban.
+	IPFilterRejections = expvar.NewInt("ip_filter_rejections")
+
+	// AutoBans counts clients banned automatically for repeated violations.
+	AutoBans = expvar.NewInt("auto_bans")
+
+	// ProofOfWorkChallenges counts proof of work challenges issued.
+	ProofOfWorkChallenges = expvar.NewInt("pow_challenges")
+
+	// ProofOfWorkSolutions counts proof of work solutions accepted.
+	ProofOfWorkSolutions = expvar.NewInt("pow_solutions")
+
+	// ProofOfWorkDifficulty is the difficulty, in bits, of the last challenge issued.
+	ProofOfWorkDifficulty = expvar.NewInt("pow_difficulty")
+
+	// AbuseReports counts reports about pastes sent to moderators.
+	AbuseReports = expvar.NewInt("abuse_reports")
+
+	// StoredBytes is the size of the stored pastes, as counted for storage quotas.
+	StoredBytes = expvar.NewInt("stored_bytes")
+
+	// StoredPastes is the number of stored pastes, as counted for storage quotas.
+	StoredPastes = expvar.NewInt("stored_pastes")
+)
+
+// Handler returns an HTTP handler serving all exported metrics as JSON.
+func Handler() http.Handler {
+	return expvar.Handler()
+}
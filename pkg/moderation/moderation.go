@@ -0,0 +1,456 @@
+// Package moderation records abuse reports about pastes, the bans placed by
+// moderators, and an audit trail of moderation actions.
+//
+// Reports and bans are kept in a JSON file that is rewritten atomically on
+// every change. The audit trail is appended to a separate file, one JSON
+// object per line, so that it is never rewritten.
+package moderation
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cbrnrd/pasted/pkg/util"
+)
+
+var (
+	// ErrNotFound is returned for a ban that does not exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrTooManyReports is returned when a paste has as many open reports as are kept.
+	ErrTooManyReports = errors.New("too many open reports for the paste")
+)
+
+// MaxOpenReports is the number of open reports kept for one paste.
+const MaxOpenReports = 50
+
+// MaxReasonLength is the longest reason kept for a report, action or ban, in bytes.
+const MaxReasonLength = 2000
+
+// Report is an abuse report about a paste.
+type Report struct {
+	ID  string `json:"id"`
+	Key string `json:"key"`
+
+	// Reason is the reporter's description of the problem.
+	Reason string `json:"reason"`
+
+	// Reporter is the owner of the reporter's API key or login, if any.
+	Reporter string `json:"reporter,omitempty"`
+
+	// ReporterIP is the address the report came from.
+	ReporterIP string `json:"reporter_ip,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+
+	// ResolvedAt is when a moderator acted on the paste, if one has.
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+
+	// Resolution is the action that resolved the report, e.g. "hide" or "dismiss".
+	Resolution string `json:"resolution,omitempty"`
+}
+
+// Open reports whether no moderator has acted on the report yet.
+func (r *Report) Open() bool {
+	return r.ResolvedAt == nil
+}
+
+// BanKind is what a ban applies to.
+type BanKind string
+
+const (
+	// BanIP bans an address or a network in CIDR notation.
+	BanIP BanKind = "ip"
+
+	// BanKey bans an API key, login or client certificate by its key ID.
+	BanKey BanKind = "key"
+)
+
+// ParseBanKind parses the name of a ban kind.
+func ParseBanKind(s string) (BanKind, error) {
+	switch k := BanKind(s); k {
+	case BanIP, BanKey:
+		return k, nil
+	}
+	return "", fmt.Errorf("unknown ban kind %q, want \"ip\" or \"key\"", s)
+}
+
+// Ban stops a client from uploading pastes.
+type Ban struct {
+	ID   string  `json:"id"`
+	Kind BanKind `json:"kind"`
+
+	// Value is the address or network for IP bans, and the key ID for key bans.
+	Value string `json:"value"`
+
+	Reason string `json:"reason,omitempty"`
+
+	// By is the moderator who placed the ban.
+	By string `json:"by"`
+
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Active reports whether the ban applies at time now.
+func (b *Ban) Active(now time.Time) bool {
+	return b.ExpiresAt == nil || now.Before(*b.ExpiresAt)
+}
+
+// Matches reports whether the ban applies to a client with keyID, which is
+// empty for anonymous clients, uploading from ip.
+func (b *Ban) Matches(keyID, ip string) bool {
+	switch b.Kind {
+	case BanKey:
+		return keyID != "" && b.Value == keyID
+	case BanIP:
+		addr := net.ParseIP(ip)
+		if addr == nil {
+			return false
+		}
+		if _, network, err := net.ParseCIDR(b.Value); err == nil {
+			return network.Contains(addr)
+		}
+		other := net.ParseIP(b.Value)
+		return other != nil && other.Equal(addr)
+	}
+	return false
+}
+
+// validate checks that the ban's value suits its kind.
+func (b *Ban) validate() error {
+	switch b.Kind {
+	case BanIP:
+		if _, _, err := net.ParseCIDR(b.Value); err != nil && net.ParseIP(b.Value) == nil {
+			return fmt.Errorf("%q is not an address or network", b.Value)
+		}
+	case BanKey:
+		if b.Value == "" {
+			return errors.New("a key ID is required")
+		}
+	default:
+		return fmt.Errorf("unknown ban kind %q", b.Kind)
+	}
+	return nil
+}
+
+// AuditEntry records a moderation action.
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+
+	// Actor is the moderator who took the action.
+	Actor string `json:"actor"`
+
+	// Action is e.g. "hide", "delete", "ban" or "unban".
+	Action string `json:"action"`
+
+	// Target is the paste key or the ban the action applies to.
+	Target string `json:"target"`
+
+	Reason string `json:"reason,omitempty"`
+}
+
+// stateFile is the format of the moderation file.
+type stateFile struct {
+	Reports []*Report `json:"reports"`
+	Bans    []*Ban    `json:"bans"`
+}
+
+// Store keeps reports, bans and the audit trail.
+type Store struct {
+	path      string
+	auditPath string
+
+	mu    sync.Mutex
+	state stateFile
+
+	// audit holds the audit trail when there is no audit file.
+	audit []AuditEntry
+}
+
+// NewStore returns a store that keeps reports and bans in the file at path
+// and appends the audit trail to the file at auditPath. If either is empty,
+// that part is only kept in memory and lost when the server restarts.
+func NewStore(path, auditPath string) (*Store, error) {
+	s := &Store{path: path, auditPath: auditPath}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.state); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return s, nil
+}
+
+// truncate shortens a reason to MaxReasonLength.
+func truncate(reason string) string {
+	if len(reason) > MaxReasonLength {
+		return reason[:MaxReasonLength]
+	}
+	return reason
+}
+
+// AddReport records a report about the paste at r.Key and returns it. A
+// second open report from the same reporter replaces the first.
+func (s *Store) AddReport(r Report) (*Report, error) {
+	id, err := util.GenerateRandomString(12)
+	if err != nil {
+		return nil, err
+	}
+	r.ID = id
+	r.Reason = truncate(r.Reason)
+	r.CreatedAt = time.Now().UTC()
+	r.ResolvedAt, r.Resolution = nil, ""
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	open := 0
+	for i, other := range s.state.Reports {
+		if other.Key != r.Key || !other.Open() {
+			continue
+		}
+		if other.ReporterIP == r.ReporterIP && other.Reporter == r.Reporter {
+			s.state.Reports[i] = &r
+			return &r, s.save()
+		}
+		open++
+	}
+	if open >= MaxOpenReports {
+		return nil, ErrTooManyReports
+	}
+	s.state.Reports = append(s.state.Reports, &r)
+	return &r, s.save()
+}
+
+// Reports returns the reports about the paste at key, oldest first.
+func (s *Store) Reports(key string) []Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var reports []Report
+	for _, r := range s.state.Reports {
+		if r.Key == key {
+			reports = append(reports, *r)
+		}
+	}
+	return reports
+}
+
+// Reported returns the keys of reported pastes, most recently reported
+// first. Unless all is set, only pastes with open reports are returned.
+func (s *Store) Reported(all bool) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	latest := map[string]time.Time{}
+	for _, r := range s.state.Reports {
+		if (all || r.Open()) && r.CreatedAt.After(latest[r.Key]) {
+			latest[r.Key] = r.CreatedAt
+		}
+	}
+	keys := make([]string, 0, len(latest))
+	for key := range latest {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		return latest[b].Compare(latest[a])
+	})
+	return keys
+}
+
+// Resolve closes the open reports about the paste at key with resolution.
+func (s *Store) Resolve(key, resolution string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	changed := false
+	for _, r := range s.state.Reports {
+		if r.Key == key && r.Open() {
+			r.ResolvedAt, r.Resolution = &now, resolution
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return s.save()
+}
+
+// AddBan places a ban and returns it. By and Kind must be set.
+func (s *Store) AddBan(b Ban) (*Ban, error) {
+	if err := b.validate(); err != nil {
+		return nil, err
+	}
+	id, err := util.GenerateRandomString(12)
+	if err != nil {
+		return nil, err
+	}
+	b.ID = id
+	b.Reason = truncate(b.Reason)
+	b.CreatedAt = time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.Bans = append(s.state.Bans, &b)
+	return &b, s.save()
+}
+
+// RemoveBan lifts the ban with id and returns it, or returns ErrNotFound.
+func (s *Store) RemoveBan(id string) (*Ban, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.state.Bans, func(b *Ban) bool { return b.ID == id })
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	b := s.state.Bans[i]
+	s.state.Bans = slices.Delete(s.state.Bans, i, i+1)
+	return b, s.save()
+}
+
+// Bans returns the bans that have not expired, oldest first.
+func (s *Store) Bans() []Ban {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var bans []Ban
+	for _, b := range s.state.Bans {
+		if b.Active(now) {
+			bans = append(bans, *b)
+		}
+	}
+	return bans
+}
+
+// Banned returns the active ban that applies to a client with keyID, which
+// is empty for anonymous clients, uploading from ip, or nil.
+func (s *Store) Banned(keyID, ip string) *Ban {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, b := range s.state.Bans {
+		if b.Active(now) && b.Matches(keyID, ip) {
+			ban := *b
+			return &ban
+		}
+	}
+	return nil
+}
+
+// Record appends an entry to the audit trail. Its time is set to now.
+func (s *Store) Record(e AuditEntry) error {
+	e.Time = time.Now().UTC()
+	e.Reason = truncate(e.Reason)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.auditPath == "" {
+		s.audit = append(s.audit, e)
+		return nil
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.auditPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Audit returns the last limit entries of the audit trail, newest first. A
+// limit of zero returns every entry.
+func (s *Store) Audit(limit int) ([]AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := slices.Clone(s.audit)
+	if s.auditPath != "" {
+		var err error
+		if entries, err = readAudit(s.auditPath); err != nil {
+			return nil, err
+		}
+	}
+	slices.Reverse(entries)
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+// readAudit reads the audit file. A missing file has no entries.
+func readAudit(path string) ([]AuditEntry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var e AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// save writes the moderation file, replacing it atomically. The caller must
+// hold s.mu.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".moderation-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,259 @@
+// Package pow implements a hashcash-style proof of work that anonymous
+// clients solve before uploading, which makes spamming from many addresses
+// expensive. The difficulty rises with the rate at which challenges are
+// solved, so that requesting challenges without answering them cannot raise
+// it for everyone.
+package pow
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cbrnrd/pasted/pkg/metrics"
+)
+
+// Errors returned by Verify.
+var (
+	// ErrRequired is returned when an anonymous client sent no proof.
+	ErrRequired = errors.New("proof of work required")
+
+	// ErrInvalid is returned for proofs that do not solve a valid challenge.
+	ErrInvalid = errors.New("invalid proof of work")
+)
+
+// maxSolutionLength bounds the solutions clients can send.
+const maxSolutionLength = 64
+
+// Options configures the proof of work.
+type Options struct {
+	// MinBits is the difficulty, in leading zero bits of the hash, when the
+	// server is quiet. Defaults to 16, which takes a fraction of a second.
+	MinBits int `yaml:"min_bits"`
+
+	// MaxBits caps the difficulty. Defaults to 24.
+	MaxBits int `yaml:"max_bits"`
+
+	// TargetRate is the number of solved challenges per minute above which
+	// the difficulty rises by a bit each time the rate doubles. Defaults to 60.
+	TargetRate int `yaml:"target_rate"`
+
+	// Lifetime is how long a challenge can be answered. Defaults to 5 minutes.
+	Lifetime time.Duration `yaml:"lifetime"`
+
+	// Secret signs challenges. Servers behind the same load balancer need the
+	// same secret. If empty, a random one is used and challenges issued
+	// before a restart cannot be answered.
+	Secret string `yaml:"secret"`
+}
+
+// Challenge is a challenge for a client.
+type Challenge struct {
+	// Token is the string the client hashes. It records the difficulty and
+	// expiry, and is signed so that clients cannot change them.
+	Token string
+
+	// Bits is the number of leading zero bits the hash must have.
+	Bits int
+
+	ExpiresAt time.Time
+}
+
+// Verifier issues challenges and checks their solutions.
+type Verifier struct {
+	opts   Options
+	secret []byte
+
+	mu sync.Mutex
+	// solved counts the solutions accepted in each of the last 60 seconds.
+	solved    [60]int
+	solvedAt  int64
+	used      map[string]time.Time
+	lastSweep time.Time
+}
+
+// New returns a verifier for opts.
+func New(opts Options) (*Verifier, error) {
+	if opts.MinBits == 0 {
+		opts.MinBits = 16
+	}
+	if opts.MaxBits == 0 {
+		opts.MaxBits = max(24, opts.MinBits)
+	}
+	if opts.TargetRate == 0 {
+		opts.TargetRate = 60
+	}
+	if opts.Lifetime == 0 {
+		opts.Lifetime = 5 * time.Minute
+	}
+	if opts.MinBits < 0 || opts.MaxBits > 64 || opts.MinBits > opts.MaxBits {
+		return nil, fmt.Errorf("difficulty must be between 0 and 64 bits, with min_bits at most max_bits")
+	}
+	if opts.TargetRate < 0 || opts.Lifetime < 0 {
+		return nil, fmt.Errorf("target_rate and lifetime cannot be negative")
+	}
+
+	secret := []byte(opts.Secret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+	}
+	return &Verifier{opts: opts, secret: secret, used: map[string]time.Time{}}, nil
+}
+
+// advance moves the window of solution counts to now, clearing the seconds
+// that passed since it was last moved. The caller must hold v.mu.
+func (v *Verifier) advance(now time.Time) {
+	sec := now.Unix()
+	if elapsed := sec - v.solvedAt; elapsed >= int64(len(v.solved)) {
+		v.solved = [60]int{}
+	} else {
+		for s := v.solvedAt + 1; s <= sec; s++ {
+			v.solved[s%int64(len(v.solved))] = 0
+		}
+	}
+	v.solvedAt = sec
+}
+
+// rate returns the number of solutions accepted in the last minute. The
+// caller must hold v.mu.
+func (v *Verifier) rate(now time.Time) int {
+	v.advance(now)
+	total := 0
+	for _, n := range v.solved {
+		total += n
+	}
+	return total
+}
+
+// Issue returns a new challenge, whose difficulty depends on the number of
+// challenges solved in the last minute.
+func (v *Verifier) Issue() Challenge {
+	now := time.Now()
+	v.mu.Lock()
+	rate := v.rate(now)
+	difficulty := v.opts.MinBits
+	for threshold := v.opts.TargetRate; rate > threshold && difficulty < v.opts.MaxBits; threshold *= 2 {
+		difficulty++
+	}
+	v.mu.Unlock()
+
+	metrics.ProofOfWorkChallenges.Add(1)
+	metrics.ProofOfWorkDifficulty.Set(int64(difficulty))
+
+	nonce := make([]byte, 9)
+	rand.Read(nonce)
+	expires := now.Add(v.opts.Lifetime).Truncate(time.Second)
+	payload := fmt.Sprintf("%d.%d.%s", difficulty, expires.Unix(), base64.RawURLEncoding.EncodeToString(nonce))
+	return Challenge{
+		Token:     payload + "." + v.sign(payload),
+		Bits:      difficulty,
+		ExpiresAt: expires.UTC(),
+	}
+}
+
+func (v *Verifier) sign(payload string) string {
+	mac := hmac.New(sha256.New, v.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:12])
+}
+
+// Verify checks that solution solves the challenge token, which must have
+// been issued by v, not have expired and not have been used before.
+func (v *Verifier) Verify(token, solution string) error {
+	if token == "" && solution == "" {
+		return ErrRequired
+	}
+	if len(solution) == 0 || len(solution) > maxSolutionLength {
+		return fmt.Errorf("%w: the solution must be 1 to %d characters", ErrInvalid, maxSolutionLength)
+	}
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 || !hmac.Equal([]byte(token[i+1:]), []byte(v.sign(token[:i]))) {
+		return fmt.Errorf("%w: unknown challenge", ErrInvalid)
+	}
+	difficulty, expires, err := parseToken(token)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if !now.Before(expires) {
+		return fmt.Errorf("%w: the challenge expired", ErrInvalid)
+	}
+	if !Solves(token, solution, difficulty) {
+		return fmt.Errorf("%w: the hash does not have %d leading zero bits", ErrInvalid, difficulty)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if now.Sub(v.lastSweep) > v.opts.Lifetime {
+		v.lastSweep = now
+		for t, exp := range v.used {
+			if !now.Before(exp) {
+				delete(v.used, t)
+			}
+		}
+	}
+	if _, ok := v.used[token]; ok {
+		return fmt.Errorf("%w: the challenge was already used", ErrInvalid)
+	}
+	v.used[token] = expires
+	v.advance(now)
+	v.solved[now.Unix()%int64(len(v.solved))]++
+	metrics.ProofOfWorkSolutions.Add(1)
+	return nil
+}
+
+// parseToken returns the difficulty and expiry recorded in token.
+func parseToken(token string) (int, time.Time, error) {
+	fields := strings.Split(token, ".")
+	if len(fields) != 4 {
+		return 0, time.Time{}, fmt.Errorf("%w: malformed challenge", ErrInvalid)
+	}
+	difficulty, err := strconv.Atoi(fields[0])
+	if err != nil || difficulty < 0 || difficulty > 64 {
+		return 0, time.Time{}, fmt.Errorf("%w: malformed challenge", ErrInvalid)
+	}
+	expires, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("%w: malformed challenge", ErrInvalid)
+	}
+	return difficulty, time.Unix(expires, 0), nil
+}
+
+// Solves reports whether the SHA-256 hash of token, a colon and solution
+// starts with at least difficulty zero bits.
+func Solves(token, solution string, difficulty int) bool {
+	sum := sha256.Sum256([]byte(token + ":" + solution))
+	zeros := 0
+	for _, b := range sum {
+		zeros += bits.LeadingZeros8(b)
+		if b != 0 || zeros >= difficulty {
+			break
+		}
+	}
+	return zeros >= difficulty
+}
+
+// Solve finds a solution to the challenge token by counting up from zero.
+func Solve(token string) (string, error) {
+	difficulty, _, err := parseToken(token)
+	if err != nil {
+		return "", err
+	}
+	for n := uint64(0); ; n++ {
+		solution := strconv.FormatUint(n, 10)
+		if Solves(token, solution, difficulty) {
+			return solution, nil
+		}
+	}
+}
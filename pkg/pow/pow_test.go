@@ -0,0 +1,49 @@
+package pow
+
+import "testing"
+
+func TestDifficultyFollowsSolutions(t *testing.T) {
+	v, err := New(Options{MinBits: 1, MaxBits: 4, TargetRate: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Challenges that are never answered do not raise the difficulty.
+	for i := 0; i < 100; i++ {
+		if c := v.Issue(); c.Bits != 1 {
+			t.Fatalf("difficulty after %d unanswered challenges = %d, want 1", i, c.Bits)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		c := v.Issue()
+		solution, err := Solve(c.Token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := v.Verify(c.Token, solution); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c := v.Issue(); c.Bits != 2 {
+		t.Fatalf("difficulty after 2 solutions = %d, want 2", c.Bits)
+	}
+}
+
+func TestVerifyRejectsReuse(t *testing.T) {
+	v, err := New(Options{MinBits: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := v.Issue()
+	solution, err := Solve(c.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Verify(c.Token, solution); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Verify(c.Token, solution); err == nil {
+		t.Fatal("a challenge was accepted twice")
+	}
+}
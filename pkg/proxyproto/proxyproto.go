@@ -0,0 +1,249 @@
+// Package proxyproto reads the PROXY protocol headers that load balancers
+// such as HAProxy send ahead of a connection to pass on the address of the
+// client.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidHeader is returned for connections that do not start with a
+// valid PROXY protocol header.
+var ErrInvalidHeader = errors.New("invalid PROXY protocol header")
+
+// headerTimeout bounds the time a trusted peer has to send the header.
+const headerTimeout = 5 * time.Second
+
+// maxV1Length is the longest version 1 header, including the CRLF.
+const maxV1Length = 107
+
+// v2Signature starts every version 2 header.
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// Conn is a connection whose remote address was read from a PROXY protocol
+// header.
+type Conn struct {
+	net.Conn
+	r      *bufio.Reader
+	remote net.Addr
+}
+
+// Read reads the data that followed the header.
+func (c *Conn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// RemoteAddr returns the address of the client, as sent by the proxy.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// Listener returns a listener that reads a version 1 or 2 PROXY protocol
+// header from connections from the trusted networks, and reports the client
+// address in it as their remote address. Connections from trusted peers
+// without a valid header are closed, and connections from other networks
+// are accepted as they are. Headers are read in the background, so that
+// peers that are slow to send them do not hold up other connections.
+func Listener(l net.Listener, trusted []netip.Prefix) net.Listener {
+	pl := &listener{
+		Listener: l,
+		trusted:  trusted,
+		conns:    make(chan net.Conn),
+		errs:     make(chan error),
+		done:     make(chan struct{}),
+	}
+	go pl.acceptLoop()
+	return pl
+}
+
+type listener struct {
+	net.Listener
+	trusted []netip.Prefix
+
+	conns     chan net.Conn
+	errs      chan error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *listener) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			select {
+			case l.errs <- err:
+			case <-l.done:
+			}
+			return
+		}
+		go l.handshake(conn)
+	}
+}
+
+// handshake reads the header of conn if it comes from a trusted peer, and
+// hands the connection to Accept.
+func (l *listener) handshake(conn net.Conn) {
+	if !l.trusts(conn.RemoteAddr()) {
+		l.deliver(conn)
+		return
+	}
+
+	conn.SetReadDeadline(time.Now().Add(headerTimeout))
+	r := bufio.NewReader(conn)
+	remote, err := ReadHeader(r)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		// Health checks connect and close without sending anything.
+		if !errors.Is(err, io.EOF) {
+			log.Printf("closing connection from %s: %v", conn.RemoteAddr(), err)
+		}
+		conn.Close()
+		return
+	}
+	if remote == nil {
+		remote = conn.RemoteAddr()
+	}
+	l.deliver(&Conn{Conn: conn, r: r, remote: remote})
+}
+
+func (l *listener) deliver(conn net.Conn) {
+	select {
+	case l.conns <- conn:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+// trusts reports whether addr is in one of the trusted networks.
+func (l *listener) trusts(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	ip, ok := netip.AddrFromSlice(tcp.IP)
+	if !ok {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, p := range l.trusted {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *listener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// ReadHeader reads a version 1 or 2 PROXY protocol header from r and returns
+// the client address in it. The address is nil for headers that do not carry
+// one, such as those of the proxy's own health checks.
+func ReadHeader(r *bufio.Reader) (net.Addr, error) {
+	start, err := r.Peek(len(v2Signature))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case bytes.Equal(start, v2Signature):
+		return readV2(r)
+	case bytes.HasPrefix(start, []byte("PROXY ")):
+		return readV1(r)
+	default:
+		return nil, fmt.Errorf("%w: missing", ErrInvalidHeader)
+	}
+}
+
+// readV1 reads a header such as "PROXY TCP4 192.0.2.1 192.0.2.2 51000 9999\r\n".
+func readV1(r *bufio.Reader) (net.Addr, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil && !errors.Is(err, bufio.ErrBufferFull) {
+		return nil, err
+	}
+	if err != nil || len(line) > maxV1Length || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("%w: line too long or not terminated by CRLF", ErrInvalidHeader)
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidHeader, line)
+	}
+	src, err := netip.ParseAddr(fields[2])
+	if err != nil || src.Is4() != (fields[1] == "TCP4") {
+		return nil, fmt.Errorf("%w: invalid source address %q", ErrInvalidHeader, fields[2])
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid source port %q", ErrInvalidHeader, fields[4])
+	}
+	return &net.TCPAddr{IP: src.AsSlice(), Port: int(port)}, nil
+}
+
+// readV2 reads a binary header. TLVs after the addresses are skipped.
+func readV2(r *bufio.Reader) (net.Addr, error) {
+	var hdr [16]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	if hdr[12]>>4 != 2 {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidHeader, hdr[12]>>4)
+	}
+	body := make([]byte, binary.BigEndian.Uint16(hdr[14:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	switch command := hdr[12] & 0x0f; command {
+	case 0x0:
+		// LOCAL: the proxy's own connection, e.g. a health check.
+		return nil, nil
+	case 0x1:
+	default:
+		return nil, fmt.Errorf("%w: unsupported command %d", ErrInvalidHeader, command)
+	}
+
+	var ipLen int
+	switch family := hdr[13] >> 4; family {
+	case 0x1:
+		ipLen = 4
+	case 0x2:
+		ipLen = 16
+	default:
+		// AF_UNSPEC and AF_UNIX carry no IP address.
+		return nil, nil
+	}
+	if len(body) < 2*ipLen+4 {
+		return nil, fmt.Errorf("%w: address block too short", ErrInvalidHeader)
+	}
+	src, _ := netip.AddrFromSlice(body[:ipLen])
+	port := binary.BigEndian.Uint16(body[2*ipLen:])
+	return &net.TCPAddr{IP: src.Unmap().AsSlice(), Port: int(port)}, nil
+}
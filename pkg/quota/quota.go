@@ -0,0 +1,281 @@
+// Package quota tracks the storage used by each owner, each anonymous client
+// address and the whole server, and enforces limits on it.
+//
+// Pastes created by authenticated clients count against their owner, and
+// anonymous pastes against the address they were uploaded from. Every paste
+// also counts against the server. Usage is the size of pastes as stored,
+// after transforms, and lasts until they are deleted.
+//
+// A Tracker only sees the pastes stored and deleted by its own process. The
+// server counts the pastes already in the backend when it starts.
+package quota
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/cbrnrd/pasted/pkg/metrics"
+)
+
+// ErrExceeded is matched by the errors returned when a paste would exceed a quota.
+var ErrExceeded = errors.New("storage quota exceeded")
+
+// Usage is the storage used by a subject.
+type Usage struct {
+	Bytes  int64 `json:"bytes"`
+	Pastes int64 `json:"pastes"`
+}
+
+// Limit bounds the storage used by a subject. Zero values are unlimited.
+type Limit struct {
+	// Bytes is the total size of the stored pastes.
+	Bytes int64 `yaml:"bytes" json:"bytes,omitempty"`
+
+	// Pastes is the number of stored pastes.
+	Pastes int64 `yaml:"pastes" json:"pastes,omitempty"`
+}
+
+// Limits are the quotas a Tracker enforces.
+type Limits struct {
+	// PerOwner applies to each owner of pastes created by authenticated clients.
+	PerOwner Limit `yaml:"per_owner" json:"per_owner"`
+
+	// PerIP applies to each address anonymous pastes are uploaded from.
+	PerIP Limit `yaml:"per_ip" json:"per_ip"`
+
+	// Global applies to all pastes together.
+	Global Limit `yaml:"global" json:"global"`
+}
+
+// ExceededError describes the quota a paste would exceed. It matches ErrExceeded.
+type ExceededError struct {
+	// Subject is the owner or address, or empty for the server.
+	Subject string
+
+	// Usage is the subject's usage before the paste.
+	Usage Usage
+
+	// Limit is the quota the paste would exceed.
+	Limit Limit
+
+	// Size is the size of the paste, or zero if it was not read yet. Pastes
+	// are only read up to the space left, so it may be smaller.
+	Size int64
+}
+
+func (e *ExceededError) Error() string {
+	return ErrExceeded.Error() + ": " + e.Reason()
+}
+
+// Reason describes the usage and limit that were exceeded.
+func (e *ExceededError) Reason() string {
+	who := "the server"
+	if e.Subject != "" {
+		who = e.Subject
+	}
+	if e.Limit.Pastes > 0 && e.Usage.Pastes >= e.Limit.Pastes {
+		return fmt.Sprintf("%s already stores %d of %d pastes", who, e.Usage.Pastes, e.Limit.Pastes)
+	}
+	if e.Size > 0 {
+		return fmt.Sprintf("%s stores %d of %d bytes, which leaves no room for this paste", who, e.Usage.Bytes, e.Limit.Bytes)
+	}
+	return fmt.Sprintf("%s already stores %d of %d bytes", who, e.Usage.Bytes, e.Limit.Bytes)
+}
+
+func (e *ExceededError) Is(target error) bool {
+	return target == ErrExceeded
+}
+
+// Report is a snapshot of the usage kept by a Tracker, with its limits.
+type Report struct {
+	Limits Limits           `json:"limits"`
+	Global Usage            `json:"global"`
+	Owners map[string]Usage `json:"owners"`
+	IPs    map[string]Usage `json:"ips"`
+}
+
+// usage is the storage used by every subject.
+type usage struct {
+	Global Usage
+	Owners map[string]*Usage
+	IPs    map[string]*Usage
+}
+
+// Tracker counts the storage used by pastes and enforces Limits on it.
+type Tracker struct {
+	limits Limits
+
+	mu    sync.Mutex
+	usage usage
+}
+
+// NewTracker returns a tracker that enforces limits, with no usage counted.
+func NewTracker(limits Limits) *Tracker {
+	t := &Tracker{
+		limits: limits,
+		usage:  usage{Owners: map[string]*Usage{}, IPs: map[string]*Usage{}},
+	}
+	t.publish()
+	return t
+}
+
+// subject returns the usage a paste by owner, or by ip if owner is empty,
+// counts against and its limit. It creates the usage if create is set, and
+// otherwise returns nil if there is none.
+func (t *Tracker) subject(owner, ip string, create bool) (string, *Usage, Limit) {
+	usage, name, limit := t.usage.Owners, owner, t.limits.PerOwner
+	if owner == "" {
+		usage, name, limit = t.usage.IPs, ip, t.limits.PerIP
+	}
+	u := usage[name]
+	if u == nil && create {
+		u = &Usage{}
+		usage[name] = u
+	}
+	return name, u, limit
+}
+
+// check returns an *ExceededError if adding size bytes in one paste to u
+// would exceed limit.
+func check(name string, u Usage, limit Limit, size int64) error {
+	if (limit.Pastes > 0 && u.Pastes+1 > limit.Pastes) || (limit.Bytes > 0 && u.Bytes+size > limit.Bytes) {
+		return &ExceededError{Subject: name, Usage: u, Limit: limit, Size: size}
+	}
+	return nil
+}
+
+// Check returns an *ExceededError if a paste by owner, or by ip if owner is
+// empty, would exceed a quota regardless of its size.
+func (t *Tracker) Check(owner, ip string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	name, u, limit := t.subject(owner, ip, false)
+	if u == nil {
+		u = &Usage{}
+	}
+	if err := check(name, *u, limit, 0); err != nil {
+		return err
+	}
+	return check("", t.usage.Global, t.limits.Global, 0)
+}
+
+// Remaining returns the largest paste owner, or ip if owner is empty, can
+// store, or -1 if there is no limit on bytes.
+func (t *Tracker) Remaining(owner, ip string) int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	remaining := int64(-1)
+	bound := func(u *Usage, limit Limit) {
+		if limit.Bytes <= 0 {
+			return
+		}
+		left := limit.Bytes
+		if u != nil {
+			left -= u.Bytes
+		}
+		if remaining < 0 || left < remaining {
+			remaining = max(left, 0)
+		}
+	}
+	_, u, limit := t.subject(owner, ip, false)
+	bound(u, limit)
+	bound(&t.usage.Global, t.limits.Global)
+	return remaining
+}
+
+// Reserve counts a paste of size bytes by owner, or by ip if owner is empty,
+// or returns an *ExceededError if it would exceed a quota. A paste that is
+// reserved but then not stored must be released.
+func (t *Tracker) Reserve(owner, ip string, size int64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	name, u, limit := t.subject(owner, ip, true)
+	if err := check(name, *u, limit, size); err != nil {
+		t.prune(owner, ip)
+		return err
+	}
+	if err := check("", t.usage.Global, t.limits.Global, size); err != nil {
+		t.prune(owner, ip)
+		return err
+	}
+	t.add(u, size)
+	return nil
+}
+
+// Count counts a stored paste of size bytes by owner, or by ip if owner is
+// empty, without checking limits. It is used for the pastes that were
+// already stored when the server started.
+func (t *Tracker) Count(owner, ip string, size int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	_, u, _ := t.subject(owner, ip, true)
+	t.add(u, size)
+}
+
+// add counts a paste of size bytes against u and the server. It is called
+// with mu held.
+func (t *Tracker) add(u *Usage, size int64) {
+	u.Bytes += size
+	u.Pastes++
+	t.usage.Global.Bytes += size
+	t.usage.Global.Pastes++
+	t.publish()
+}
+
+// Release stops counting a paste of size bytes by owner, or by ip if owner
+// is empty, when it is deleted or could not be stored.
+func (t *Tracker) Release(owner, ip string, size int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, u, _ := t.subject(owner, ip, false); u != nil {
+		u.Bytes = max(u.Bytes-size, 0)
+		u.Pastes = max(u.Pastes-1, 0)
+		t.prune(owner, ip)
+	}
+	t.usage.Global.Bytes = max(t.usage.Global.Bytes-size, 0)
+	t.usage.Global.Pastes = max(t.usage.Global.Pastes-1, 0)
+	t.publish()
+}
+
+// publish updates the storage metrics. It is called with mu held.
+func (t *Tracker) publish() {
+	metrics.StoredBytes.Set(t.usage.Global.Bytes)
+	metrics.StoredPastes.Set(t.usage.Global.Pastes)
+}
+
+// prune forgets the usage of a subject that stores nothing.
+func (t *Tracker) prune(owner, ip string) {
+	if _, u, _ := t.subject(owner, ip, false); u != nil && *u == (Usage{}) {
+		if owner != "" {
+			delete(t.usage.Owners, owner)
+		} else {
+			delete(t.usage.IPs, ip)
+		}
+	}
+}
+
+// Report returns a copy of the current usage.
+func (t *Tracker) Report() Report {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r := Report{
+		Limits: t.limits,
+		Global: t.usage.Global,
+		Owners: make(map[string]Usage, len(t.usage.Owners)),
+		IPs:    make(map[string]Usage, len(t.usage.IPs)),
+	}
+	for name, u := range t.usage.Owners {
+		r.Owners[name] = *u
+	}
+	for ip, u := range t.usage.IPs {
+		r.IPs[ip] = *u
+	}
+	return r
+}
@@ -0,0 +1,237 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ansiSequence matches escape sequences; only SGR (ending in 'm') affects the output.
+var ansiSequence = regexp.MustCompile(`\x1b\[([0-?]*)[ -/]*([@-~])|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// ansiState is the current text style. Colors are xterm-256 palette indexes, or -1 for the default.
+type ansiState struct {
+	fg, bg                                int
+	bold, dim, italic, underline, inverse bool
+}
+
+var defaultANSIState = ansiState{fg: -1, bg: -1}
+
+// classes returns the CSS classes for s. Colors use the classes generated by ansiCSS,
+// so no inline styles are needed.
+func (s ansiState) classes() string {
+	fg, bg := s.fg, s.bg
+	if s.inverse {
+		fg, bg = bg, fg
+		if fg == -1 {
+			fg = 256
+		}
+		if bg == -1 {
+			bg = 257
+		}
+	}
+	if s.bold && fg >= 0 && fg < 8 {
+		fg += 8
+	}
+
+	var c []string
+	if fg >= 0 {
+		c = append(c, fmt.Sprintf("f%d", fg))
+	}
+	if bg >= 0 {
+		c = append(c, fmt.Sprintf("b%d", bg))
+	}
+	if s.bold {
+		c = append(c, "ab")
+	}
+	if s.dim {
+		c = append(c, "ad")
+	}
+	if s.italic {
+		c = append(c, "ai")
+	}
+	if s.underline {
+		c = append(c, "au")
+	}
+	return strings.Join(c, " ")
+}
+
+// ANSI renders terminal output, converting SGR color and style sequences to HTML.
+// Other escape sequences, such as cursor movement, are dropped.
+func ANSI(body []byte) (template.HTML, error) {
+	var buf strings.Builder
+	buf.WriteString(`<pre class="ansi">`)
+
+	state := defaultANSIState
+	write := func(text []byte) {
+		if len(text) == 0 {
+			return
+		}
+		if cls := state.classes(); cls != "" {
+			buf.WriteString(`<span class="` + cls + `">` + html.EscapeString(string(text)) + `</span>`)
+		} else {
+			buf.WriteString(html.EscapeString(string(text)))
+		}
+	}
+
+	pos := 0
+	for _, loc := range ansiSequence.FindAllSubmatchIndex(body, -1) {
+		write(body[pos:loc[0]])
+		pos = loc[1]
+		if loc[4] >= 0 && body[loc[4]] == 'm' {
+			state = applySGR(state, string(body[loc[2]:loc[3]]))
+		}
+	}
+	write(body[pos:])
+
+	buf.WriteString(`</pre>`)
+	return template.HTML(buf.String()), nil
+}
+
+// applySGR applies the parameters of a Select Graphic Rendition sequence to s.
+func applySGR(s ansiState, params string) ansiState {
+	if params == "" {
+		return defaultANSIState
+	}
+	codes := strings.Split(params, ";")
+	for i := 0; i < len(codes); i++ {
+		n, err := strconv.Atoi(codes[i])
+		if err != nil {
+			continue
+		}
+		switch {
+		case n == 0:
+			s = defaultANSIState
+		case n == 1:
+			s.bold = true
+		case n == 2:
+			s.dim = true
+		case n == 3:
+			s.italic = true
+		case n == 4:
+			s.underline = true
+		case n == 7:
+			s.inverse = true
+		case n == 22:
+			s.bold, s.dim = false, false
+		case n == 23:
+			s.italic = false
+		case n == 24:
+			s.underline = false
+		case n == 27:
+			s.inverse = false
+		case n >= 30 && n <= 37:
+			s.fg = n - 30
+		case n == 39:
+			s.fg = -1
+		case n >= 40 && n <= 47:
+			s.bg = n - 40
+		case n == 49:
+			s.bg = -1
+		case n >= 90 && n <= 97:
+			s.fg = n - 90 + 8
+		case n >= 100 && n <= 107:
+			s.bg = n - 100 + 8
+		case n == 38 || n == 48:
+			color, consumed := extendedColor(codes[i+1:])
+			i += consumed
+			if color >= 0 {
+				if n == 38 {
+					s.fg = color
+				} else {
+					s.bg = color
+				}
+			}
+		}
+	}
+	return s
+}
+
+// extendedColor parses the arguments of a 38 or 48 code: "5;n" for the
+// 256-color palette or "2;r;g;b" for true color, which is mapped to the
+// nearest palette entry. It returns the color and the number of codes used.
+func extendedColor(args []string) (int, int) {
+	if len(args) == 0 {
+		return -1, 0
+	}
+	switch args[0] {
+	case "5":
+		if len(args) < 2 {
+			return -1, len(args)
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 || n > 255 {
+			return -1, 2
+		}
+		return n, 2
+	case "2":
+		if len(args) < 4 {
+			return -1, len(args)
+		}
+		var rgb [3]int
+		for i := range rgb {
+			v, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return -1, 4
+			}
+			rgb[i] = min(max(v, 0), 255)
+		}
+		return nearestPaletteColor(rgb[0], rgb[1], rgb[2]), 4
+	}
+	return -1, 1
+}
+
+// ansiPalette returns the RGB value of an xterm-256 color.
+func ansiPalette(n int) (r, g, b int) {
+	base := [16][3]int{
+		{0, 0, 0}, {205, 49, 49}, {13, 188, 121}, {229, 229, 16},
+		{36, 114, 200}, {188, 63, 188}, {17, 168, 205}, {229, 229, 229},
+		{102, 102, 102}, {241, 76, 76}, {35, 209, 139}, {245, 245, 67},
+		{59, 142, 234}, {214, 112, 214}, {41, 184, 219}, {255, 255, 255},
+	}
+	switch {
+	case n < 16:
+		return base[n][0], base[n][1], base[n][2]
+	case n < 232:
+		n -= 16
+		level := func(v int) int {
+			if v == 0 {
+				return 0
+			}
+			return 55 + v*40
+		}
+		return level(n / 36), level(n / 6 % 6), level(n % 6)
+	default:
+		v := 8 + (n-232)*10
+		return v, v, v
+	}
+}
+
+func nearestPaletteColor(r, g, b int) int {
+	best, bestDist := 0, 1<<31-1
+	for n := 16; n < 256; n++ {
+		pr, pg, pb := ansiPalette(n)
+		d := (pr-r)*(pr-r) + (pg-g)*(pg-g) + (pb-b)*(pb-b)
+		if d < bestDist {
+			best, bestDist = n, d
+		}
+	}
+	return best
+}
+
+// ansiCSS returns the stylesheet for the classes emitted by ANSI.
+// Classes f256 and b257 swap the default colors of the terminal for inverse text.
+func ansiCSS() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(".ansi .ab{font-weight:bold}.ansi .ad{opacity:.7}.ansi .ai{font-style:italic}.ansi .au{text-decoration:underline}\n")
+	buf.WriteString(".ansi .f256{color:#1e1e1e}.ansi .b257{background-color:#e5e5e5}\n")
+	for n := 0; n < 256; n++ {
+		r, g, b := ansiPalette(n)
+		fmt.Fprintf(&buf, ".ansi .f%d{color:#%02x%02x%02x}.ansi .b%d{background-color:#%02x%02x%02x}\n", n, r, g, b, n, r, g, b)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,147 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"html"
+	"html/template"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/cbrnrd/pasted/pkg/asciicast"
+)
+
+// Playback frames are at most castFrameRate per second, and fewer for long
+// recordings so that no more than maxCastFrames are embedded in the page.
+const (
+	castFrameRate = 30
+	maxCastFrames = 10000
+)
+
+// castRun is a span of text with the same style, encoded as [text, classes].
+type castRun [2]string
+
+// castFrame is the rows that changed at a point in time, encoded as
+// [time, height, [[row, runs], ...]].
+type castFrame struct {
+	Time   float64
+	Height int
+	Rows   map[int][]castRun
+}
+
+func (f castFrame) MarshalJSON() ([]byte, error) {
+	rows := make([][2]any, 0, len(f.Rows))
+	for _, y := range slices.Sorted(maps.Keys(f.Rows)) {
+		rows = append(rows, [2]any{y, f.Rows[y]})
+	}
+	return json.Marshal([3]any{f.Time, f.Height, rows})
+}
+
+// castPlayback is the data read by cast.js.
+type castPlayback struct {
+	Cols     int         `json:"cols"`
+	Rows     int         `json:"rows"`
+	Duration float64     `json:"duration"`
+	Frames   []castFrame `json:"frames"`
+}
+
+// Cast renders an asciicast v2 recording as a player. The page shows the
+// final frame, and cast.js replays the embedded frames when scripts run.
+func Cast(body []byte) (template.HTML, error) {
+	c, err := asciicast.Decode(bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	c.LimitIdle(c.Header.IdleTimeLimit)
+
+	playback := castPlayback{Cols: c.Header.Width, Rows: c.Header.Height, Duration: c.Duration()}
+	interval := max(1.0/castFrameRate, playback.Duration/maxCastFrames)
+
+	var prev [][]castRun
+	var final asciicast.Screen
+	asciicast.Replay(c, interval, func(t float64, s asciicast.Screen) {
+		frame := castFrame{Time: t, Height: len(s), Rows: map[int][]castRun{}}
+		rows := make([][]castRun, len(s))
+		for y, row := range s {
+			rows[y] = castRuns(row)
+			if len(prev) != len(s) || !slices.Equal(prev[y], rows[y]) {
+				frame.Rows[y] = rows[y]
+			}
+		}
+		if len(frame.Rows) > 0 || len(playback.Frames) == 0 {
+			playback.Frames = append(playback.Frames, frame)
+		}
+		prev, final = rows, s
+	})
+
+	data, err := json.Marshal(playback)
+	if err != nil {
+		return "", err
+	}
+
+	var buf strings.Builder
+	buf.WriteString(`<div class="cast">`)
+	if c.Header.Title != "" {
+		buf.WriteString(`<h1 class="cast-title">` + html.EscapeString(c.Header.Title) + `</h1>`)
+	}
+	buf.WriteString(`<pre class="ansi cast-screen">`)
+	for y := range final {
+		writeCastRow(&buf, castRuns(final[y]))
+		buf.WriteByte('\n')
+	}
+	buf.WriteString(`</pre>`)
+	buf.WriteString(`<div class="cast-controls" hidden>` +
+		`<button type="button" class="cast-play">play</button>` +
+		`<input type="range" class="cast-seek" min="0" step="any" aria-label="position">` +
+		`<span class="cast-time"></span>` +
+		`<select class="cast-speed" aria-label="speed"><option value="0.5">0.5&times;</option><option value="1" selected>1&times;</option><option value="2">2&times;</option><option value="4">4&times;</option></select>` +
+		`</div>`)
+	// json.Marshal escapes <, > and &, so the data cannot close the element.
+	buf.WriteString(`<script type="application/json" class="cast-data">`)
+	buf.Write(data)
+	buf.WriteString(`</script></div>`)
+	return template.HTML(buf.String()), nil
+}
+
+// castRuns groups a row of cells into runs of the same style. Trailing
+// unstyled spaces are dropped.
+func castRuns(row []asciicast.Cell) []castRun {
+	var runs []castRun
+	var text strings.Builder
+	class := ""
+	flush := func() {
+		if text.Len() > 0 {
+			runs = append(runs, castRun{text.String(), class})
+			text.Reset()
+		}
+	}
+	for _, c := range row {
+		cls := ansiState{fg: c.FG, bg: c.BG, bold: c.Bold, italic: c.Italic, underline: c.Underline}.classes()
+		if cls != class {
+			flush()
+			class = cls
+		}
+		text.WriteRune(c.Char)
+	}
+	flush()
+
+	if n := len(runs); n > 0 && runs[n-1][1] == "" {
+		if trimmed := strings.TrimRight(runs[n-1][0], " "); trimmed == "" {
+			runs = runs[:n-1]
+		} else {
+			runs[n-1][0] = trimmed
+		}
+	}
+	return runs
+}
+
+func writeCastRow(buf *strings.Builder, runs []castRun) {
+	for _, r := range runs {
+		if r[1] == "" {
+			buf.WriteString(html.EscapeString(r[0]))
+			continue
+		}
+		buf.WriteString(`<span class="` + r[1] + `">` + html.EscapeString(r[0]) + `</span>`)
+	}
+}
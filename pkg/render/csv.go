@@ -0,0 +1,61 @@
+package render
+
+import (
+	"bytes"
+	"encoding/csv"
+	"html"
+	"html/template"
+	"strings"
+)
+
+// maxTableRows limits the rows rendered by CSVTable; the raw paste has the rest.
+const maxTableRows = 5000
+
+// CSVTable returns a renderer for delimiter-separated values.
+// The first row is used as the header, and columns can be sorted by clicking it.
+func CSVTable(comma rune) Renderer {
+	return func(body []byte) (template.HTML, error) {
+		r := csv.NewReader(bytes.NewReader(body))
+		r.Comma = comma
+		r.FieldsPerRecord = -1
+		r.LazyQuotes = true
+
+		records, err := r.ReadAll()
+		if err != nil {
+			return "", err
+		}
+
+		truncated := len(records) > maxTableRows+1
+		if truncated {
+			records = records[:maxTableRows+1]
+		}
+
+		var buf strings.Builder
+		buf.WriteString(`<table class="csv">`)
+		for i, record := range records {
+			cell := "td"
+			if i == 0 {
+				buf.WriteString(`<thead>`)
+				cell = "th"
+			} else if i == 1 {
+				buf.WriteString(`<tbody>`)
+			}
+			buf.WriteString(`<tr>`)
+			for _, field := range record {
+				buf.WriteString(`<` + cell + `>` + html.EscapeString(field) + `</` + cell + `>`)
+			}
+			buf.WriteString(`</tr>`)
+			if i == 0 {
+				buf.WriteString(`</thead>`)
+			}
+		}
+		if len(records) > 1 {
+			buf.WriteString(`</tbody>`)
+		}
+		if truncated {
+			buf.WriteString(`<tfoot><tr><td colspan="100">Truncated, see the raw paste for all rows.</td></tr></tfoot>`)
+		}
+		buf.WriteString(`</table>`)
+		return template.HTML(buf.String()), nil
+	}
+}
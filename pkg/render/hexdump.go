@@ -0,0 +1,48 @@
+package render
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"strings"
+)
+
+// maxHexdumpBytes is the number of leading bytes shown in a hexdump.
+const maxHexdumpBytes = 64 * 1024
+
+// Hexdump renders binary data in the format of `hexdump -C`: offset, sixteen
+// bytes in hex and the printable ASCII characters. Only the first 64 KiB are shown.
+func Hexdump(body []byte) template.HTML {
+	shown := body[:min(len(body), maxHexdumpBytes)]
+
+	var buf strings.Builder
+	buf.WriteString(`<pre class="hexdump">`)
+	for off := 0; off < len(shown); off += 16 {
+		line := shown[off:min(off+16, len(shown))]
+		fmt.Fprintf(&buf, `<span class="hex-off">%08x</span>  `, off)
+		for i := 0; i < 16; i++ {
+			switch {
+			case i < len(line):
+				fmt.Fprintf(&buf, "%02x ", line[i])
+			default:
+				buf.WriteString("   ")
+			}
+			if i == 7 {
+				buf.WriteByte(' ')
+			}
+		}
+		ascii := make([]byte, len(line))
+		for i, b := range line {
+			if b < 0x20 || b > 0x7e {
+				b = '.'
+			}
+			ascii[i] = b
+		}
+		buf.WriteString(` <span class="hex-ascii">|` + html.EscapeString(string(ascii)) + `|</span>` + "\n")
+	}
+	if len(shown) < len(body) {
+		fmt.Fprintf(&buf, `<span class="hex-more">… %d more bytes; download the paste to see all of it</span>`+"\n", len(body)-len(shown))
+	}
+	buf.WriteString(`</pre>`)
+	return template.HTML(buf.String())
+}
@@ -0,0 +1,101 @@
+package render
+
+import (
+	"bytes"
+	"html/template"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// styleName is the chroma style used for highlighted pastes.
+const styleName = "github"
+
+var formatter = html.New(
+	html.WithClasses(true),
+	html.WithLineNumbers(true),
+	html.WithLinkableLineNumbers(true, "L"),
+	html.TabWidth(4),
+)
+
+// heuristics detect languages that chroma's analysers tend to misclassify.
+var heuristics = []struct {
+	pattern *regexp.Regexp
+	lexer   string
+}{
+	{regexp.MustCompile(`(?m)^package [A-Za-z_]\w*\s*$`), "go"},
+}
+
+// Lexer picks the lexer for a paste. The file extension from the URL takes
+// precedence over the language hint given at upload; if neither matches, the
+// language is detected from the body.
+func Lexer(ext, hint string, body []byte) chroma.Lexer {
+	if ext != "" {
+		if l := lexers.Match("paste." + ext); l != nil {
+			return l
+		}
+		if l := lexers.Get(ext); l != nil {
+			return l
+		}
+	}
+	if hint != "" {
+		if l := lexers.Get(hint); l != nil {
+			return l
+		}
+	}
+	sample := body[:min(len(body), 4096)]
+	for _, h := range heuristics {
+		if h.pattern.Match(sample) {
+			return lexers.Get(h.lexer)
+		}
+	}
+	if l := lexers.Analyse(string(body)); l != nil {
+		return l
+	}
+	return lexers.Fallback
+}
+
+// Highlight returns body as syntax-highlighted HTML with linkable line numbers.
+func Highlight(lexer chroma.Lexer, body []byte) (template.HTML, error) {
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, string(body))
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := formatter.Format(&buf, styles.Get(styleName), iterator); err != nil {
+		return "", err
+	}
+	return template.HTML(buf.String()), nil
+}
+
+// highlightCSS returns the stylesheet for the classes emitted by Highlight.
+func highlightCSS() []byte {
+	var buf strings.Builder
+	formatter.WriteCSS(&buf, styles.Get(styleName))
+	return []byte(buf.String())
+}
+
+// Languages returns the languages that can be given as a hint at upload,
+// sorted by name. Each value is a name that Lexer accepts.
+var Languages = sync.OnceValue(func() []Option {
+	var langs []Option
+	for _, l := range lexers.GlobalLexerRegistry.Lexers {
+		cfg := l.Config()
+		value := strings.ToLower(cfg.Name)
+		if len(cfg.Aliases) > 0 {
+			value = cfg.Aliases[0]
+		}
+		langs = append(langs, Option{Value: value, Label: cfg.Name})
+	}
+	slices.SortFunc(langs, func(a, b Option) int {
+		return strings.Compare(strings.ToLower(a.Label), strings.ToLower(b.Label))
+	})
+	return langs
+})
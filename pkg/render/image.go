@@ -0,0 +1,13 @@
+package render
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+)
+
+// Image renders an image paste. src is the URL of the full image.
+func Image(src string, width, height int) template.HTML {
+	return template.HTML(fmt.Sprintf(`<figure class="image"><a href="%[1]s"><img src="%[1]s" width="%[2]d" height="%[3]d" alt=""></a></figure>`,
+		html.EscapeString(src), width, height))
+}
@@ -0,0 +1,121 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"strings"
+)
+
+// JSONTree renders a JSON document as a collapsible tree of <details> elements.
+// Object keys keep the order they have in the paste.
+func JSONTree(body []byte) (template.HTML, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var buf strings.Builder
+	buf.WriteString(`<div class="json">`)
+	for {
+		err := writeJSONValue(&buf, dec, "", 0)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	buf.WriteString(`</div>`)
+	return template.HTML(buf.String()), nil
+}
+
+// writeJSONValue writes the next value from dec, labelled with label if it is not empty.
+func writeJSONValue(buf *strings.Builder, dec *json.Decoder, label string, depth int) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	prefix := ""
+	if label != "" {
+		prefix = `<span class="json-key">` + html.EscapeString(label) + `</span>: `
+	}
+
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		buf.WriteString(`<div class="json-leaf">` + prefix + jsonScalar(tok) + `</div>`)
+		return nil
+	}
+
+	open, close := "{", "}"
+	if delim == '[' {
+		open, close = "[", "]"
+	}
+
+	// Expand the first levels, collapse deeper ones.
+	attr := ""
+	if depth < 2 {
+		attr = " open"
+	}
+
+	var children strings.Builder
+	n := 0
+	for dec.More() {
+		childLabel := ""
+		if delim == '{' {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			key, _ := keyTok.(string)
+			childLabel = jsonQuote(key)
+		} else {
+			childLabel = fmt.Sprint(n)
+		}
+		if err := writeJSONValue(&children, dec, childLabel, depth+1); err != nil {
+			return err
+		}
+		n++
+	}
+	// Consume the closing delimiter.
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+
+	if n == 0 {
+		buf.WriteString(`<div class="json-leaf">` + prefix + open + close + `</div>`)
+		return nil
+	}
+
+	fmt.Fprintf(buf, `<details%s><summary>%s%s <span class="json-count">%d</span></summary>%s</details>`,
+		attr, prefix, open, n, children.String())
+	fmt.Fprintf(buf, `<div class="json-close">%s</div>`, close)
+	return nil
+}
+
+func jsonScalar(tok json.Token) string {
+	switch v := tok.(type) {
+	case string:
+		return `<span class="json-string">` + html.EscapeString(jsonQuote(v)) + `</span>`
+	case json.Number:
+		return `<span class="json-number">` + html.EscapeString(v.String()) + `</span>`
+	case bool:
+		return fmt.Sprintf(`<span class="json-bool">%t</span>`, v)
+	case nil:
+		return `<span class="json-null">null</span>`
+	default:
+		return html.EscapeString(fmt.Sprint(v))
+	}
+}
+
+// jsonQuote returns s as a JSON string literal without escaping HTML characters,
+// since the result is HTML-escaped by the caller.
+func jsonQuote(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
@@ -0,0 +1,29 @@
+package render
+
+import (
+	"bytes"
+	"html/template"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+var markdownPolicy = func() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("type", "checked", "disabled").OnElements("input")
+	p.RequireNoReferrerOnLinks(true)
+	return p
+}()
+
+// Markdown renders GitHub flavored Markdown as sanitized HTML.
+// Raw HTML in the paste is dropped and links are stripped of unsafe schemes.
+func Markdown(body []byte) (template.HTML, error) {
+	var buf bytes.Buffer
+	if err := markdown.Convert(body, &buf); err != nil {
+		return "", err
+	}
+	return template.HTML(`<article class="markdown">` + markdownPolicy.Sanitize(buf.String()) + `</article>`), nil
+}
@@ -0,0 +1,269 @@
+package render
+
+import (
+	"embed"
+	"html/template"
+	"io"
+	"time"
+
+	"github.com/cbrnrd/pasted/pkg/moderation"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"timestamp": func(t time.Time) string { return t.UTC().Format(time.RFC3339) },
+}).ParseFS(templateFS, "templates/*.html"))
+
+// CSP is the Content-Security-Policy for rendered pages. Scripts and styles
+// are only loaded from the static handler, and scripts can only fetch from
+// the server itself.
+const CSP = "default-src 'none'; script-src 'self'; style-src 'self'; img-src 'self' data:; connect-src 'self'; base-uri 'none'; form-action 'self'; frame-ancestors 'none'"
+
+// Page describes a rendered paste.
+type Page struct {
+	// Key is the paste key.
+	Key string
+
+	// Language is the display name of the detected language or format.
+	Language string
+
+	// RawURL is the URL of the raw paste.
+	RawURL string
+
+	// Thumbnail is the absolute URL of a preview image for link unfurling, if any.
+	Thumbnail string
+
+	// CreatedAt is the time the paste was stored.
+	CreatedAt time.Time
+
+	// ReportURL is the URL of the form for reporting the paste.
+	ReportURL string
+
+	// Content is the rendered paste.
+	Content template.HTML
+}
+
+// WritePage writes p as a complete HTML page.
+func WritePage(w io.Writer, p *Page) error {
+	return templates.ExecuteTemplate(w, "page.html", p)
+}
+
+// Account describes the signed-in user, shown in the header of pages that
+// are not derived from a paste.
+type Account struct {
+	// SSO shows a login link when no user is signed in.
+	SSO bool
+
+	// User is the display name of the signed-in user, if any.
+	User string
+}
+
+// Option is a choice in a select menu.
+type Option struct {
+	Value string
+	Label string
+}
+
+// NewPasteForm describes the form for creating a paste. The fields after
+// Expiries hold the values of a submission that was rejected.
+type NewPasteForm struct {
+	Account Account
+
+	// Languages are the syntax highlighting languages that can be chosen.
+	Languages []Option
+
+	// Expiries are the lifetimes that can be chosen.
+	Expiries []Option
+
+	// KeyField shows a field for an API key, which KeyRequired makes mandatory.
+	KeyField    bool
+	KeyRequired bool
+
+	// ProofOfWork makes the form solve a proof of work challenge before it is
+	// sent, unless an API key is entered.
+	ProofOfWork bool
+
+	// Namespaces are the namespaces the user can create pastes in, besides the default.
+	Namespaces []string
+
+	// Error explains why the previous submission was rejected.
+	Error string
+
+	Content       string
+	Language      string
+	ExpiresIn     string
+	Namespace     string
+	BurnAfterRead bool
+}
+
+// WriteNewPasteForm writes the form for creating a paste.
+func WriteNewPasteForm(w io.Writer, f *NewPasteForm) error {
+	return templates.ExecuteTemplate(w, "new.html", f)
+}
+
+// CreatedPaste describes a paste that was just created from the form.
+type CreatedPaste struct {
+	Account Account
+
+	Key           string
+	URL           string
+	ExpiresAt     *time.Time
+	BurnAfterRead bool
+	Password      bool
+
+	// DeleteToken allows the paste to be deleted through the API. It is only shown once.
+	DeleteToken string
+}
+
+// WriteCreatedPaste writes the page shown after a paste is created.
+func WriteCreatedPaste(w io.Writer, c *CreatedPaste) error {
+	return templates.ExecuteTemplate(w, "created.html", c)
+}
+
+// UnlockForm describes the page shown before a protected paste is displayed.
+type UnlockForm struct {
+	Key string
+
+	// Action is the URL the form is posted to.
+	Action string
+
+	Password      bool
+	BurnAfterRead bool
+
+	// Error explains why the previous attempt was rejected.
+	Error string
+}
+
+// WriteUnlockForm writes the page that asks for a paste's password, or for
+// confirmation before a burn-after-read paste is shown and deleted.
+func WriteUnlockForm(w io.Writer, f *UnlockForm) error {
+	return templates.ExecuteTemplate(w, "unlock.html", f)
+}
+
+// MyPastes describes the list of the signed-in user's pastes, or of the
+// pastes in one of the user's namespaces.
+type MyPastes struct {
+	Account Account
+
+	// Owner is the owner recorded on the user's pastes.
+	Owner string
+
+	// Namespace is the namespace whose pastes are listed, if any.
+	Namespace string
+
+	// Namespaces are the namespaces the user is a member of.
+	Namespaces []string
+
+	// Expiries are the lifetimes a paste can be extended by.
+	Expiries []Option
+
+	// Pastes are listed newest first.
+	Pastes []ListedPaste
+}
+
+// ListedPaste is a paste in a list.
+type ListedPaste struct {
+	Key           string
+	URL           string
+	Owner         string
+	Namespace     string
+	Language      string
+	CreatedAt     time.Time
+	ExpiresAt     *time.Time
+	BurnAfterRead bool
+	Password      bool
+}
+
+// WriteMyPastes writes the list of the signed-in user's pastes.
+func WriteMyPastes(w io.Writer, m *MyPastes) error {
+	return templates.ExecuteTemplate(w, "my.html", m)
+}
+
+// ReportForm describes the form for reporting a paste to moderators.
+type ReportForm struct {
+	Key string
+
+	// Action is the URL the form is posted to.
+	Action string
+
+	// MaxLength is the longest reason that is kept.
+	MaxLength int
+
+	// Done thanks the user for a report that was recorded.
+	Done bool
+
+	// Error explains why the previous submission was rejected.
+	Error string
+
+	Reason string
+}
+
+// WriteReportForm writes the form for reporting a paste.
+func WriteReportForm(w io.Writer, f *ReportForm) error {
+	return templates.ExecuteTemplate(w, "report.html", f)
+}
+
+// ReportedPaste describes a paste and the reports about it, for moderators.
+type ReportedPaste struct {
+	Account Account
+
+	Key string
+
+	// Missing is set if the paste no longer exists. Only Key and Reports are set.
+	Missing bool
+
+	URL         string
+	ContentType string
+	Owner       string
+	KeyID       string
+	SourceIP    string
+	Namespace   string
+	Flags       []string
+	CreatedAt   time.Time
+	ExpiresAt   *time.Time
+	Hidden      bool
+
+	// Reports are listed oldest first.
+	Reports []moderation.Report
+
+	// Error explains why the previous action failed.
+	Error string
+}
+
+// Latest returns the most recent report, or nil.
+func (p *ReportedPaste) Latest() *moderation.Report {
+	if len(p.Reports) == 0 {
+		return nil
+	}
+	return &p.Reports[len(p.Reports)-1]
+}
+
+// WriteReportedPaste writes the moderation page of a paste.
+func WriteReportedPaste(w io.Writer, p *ReportedPaste) error {
+	return templates.ExecuteTemplate(w, "moderated.html", p)
+}
+
+// ModerationQueue describes the list of reported pastes, the bans and the
+// latest moderation actions.
+type ModerationQueue struct {
+	Account Account
+
+	// All lists pastes whose reports were resolved as well.
+	All bool
+
+	// Pastes are listed most recently reported first.
+	Pastes []*ReportedPaste
+
+	Bans  []moderation.Ban
+	Audit []moderation.AuditEntry
+
+	// Error explains why the previous action failed.
+	Error string
+}
+
+// WriteModerationQueue writes the moderation page.
+func WriteModerationQueue(w io.Writer, q *ModerationQueue) error {
+	return templates.ExecuteTemplate(w, "moderation.html", q)
+}
@@ -0,0 +1,79 @@
+package render
+
+import (
+	"html/template"
+	"mime"
+	"strings"
+
+	"github.com/cbrnrd/pasted/pkg/asciicast"
+)
+
+// Renderer renders a paste as an HTML fragment.
+type Renderer func(body []byte) (template.HTML, error)
+
+// Format is a rendering of a paste other than plain highlighting.
+type Format struct {
+	// Name is shown in the page header and used as a CSS class.
+	Name string
+
+	// Render produces the HTML fragment.
+	Render Renderer
+}
+
+var formats = map[string]Format{
+	"markdown": {"Markdown", Markdown},
+	"json":     {"JSON", JSONTree},
+	"csv":      {"CSV", CSVTable(',')},
+	"tsv":      {"TSV", CSVTable('\t')},
+	"ansi":     {"Terminal", ANSI},
+	"cast":     {"Terminal recording", Cast},
+}
+
+// aliases maps URL extensions and language hints to format names.
+var aliases = map[string]string{
+	"md":       "markdown",
+	"markdown": "markdown",
+	"json":     "json",
+	"csv":      "csv",
+	"tsv":      "tsv",
+	"tab":      "tsv",
+	"ansi":     "ansi",
+	"log":      "ansi",
+	"term":     "ansi",
+	"cast":     "cast",
+}
+
+// contentTypes maps detected content types to format names.
+var contentTypes = map[string]string{
+	"text/markdown":             "markdown",
+	"application/json":          "json",
+	"text/csv":                  "csv",
+	"text/tab-separated-values": "tsv",
+	"text/x-ansi":               "ansi",
+	asciicast.ContentType:       "cast",
+}
+
+// SelectFormat returns the format for a paste, chosen by the URL extension,
+// then the language hint given at upload, then the detected content type.
+// It returns false if the paste should be syntax highlighted instead.
+func SelectFormat(ext, hint, contentType string) (Format, bool) {
+	for _, name := range []string{ext, hint} {
+		if name == "" {
+			continue
+		}
+		if f, ok := aliases[strings.ToLower(name)]; ok {
+			return formats[f], true
+		}
+		// Any other extension or hint selects a highlighting language.
+		return Format{}, false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return Format{}, false
+	}
+	if f, ok := contentTypes[mediaType]; ok {
+		return formats[f], true
+	}
+	return Format{}, false
+}
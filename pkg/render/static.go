@@ -0,0 +1,42 @@
+package render
+
+import (
+	"bytes"
+	"embed"
+	"io/fs"
+	"net/http"
+	"time"
+)
+
+//go:embed static
+var staticFS embed.FS
+
+// StaticHandler serves the stylesheets and scripts used by rendered pages.
+// It should be mounted with http.StripPrefix at StaticPrefix.
+func StaticHandler() http.Handler {
+	sub, err := fs.Sub(staticFS, "static")
+	if err != nil {
+		panic(err)
+	}
+	files := http.FileServer(http.FS(sub))
+
+	generated := map[string][]byte{
+		"/highlight.css": highlightCSS(),
+		"/ansi.css":      ansiCSS(),
+	}
+	modTime := time.Now()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		if css, ok := generated[r.URL.Path]; ok {
+			w.Header().Set("Content-Type", "text/css; charset=utf-8")
+			http.ServeContent(w, r, r.URL.Path, modTime, bytes.NewReader(css))
+			return
+		}
+		files.ServeHTTP(w, r)
+	})
+}
+
+// StaticPrefix is the URL path under which StaticHandler is mounted.
+const StaticPrefix = "/static"
@@ -0,0 +1,138 @@
+// Player for terminal recordings. The page shows the final frame; this replays
+// the frames embedded by the server as [time, height, [[row, runs], ...]].
+(function () {
+  "use strict";
+
+  function formatTime(t) {
+    var s = Math.floor(t);
+    var m = Math.floor(s / 60);
+    s = s % 60;
+    return m + ":" + (s < 10 ? "0" : "") + s;
+  }
+
+  function fillRow(row, runs) {
+    row.textContent = "";
+    runs.forEach(function (run) {
+      if (!run[1]) {
+        row.appendChild(document.createTextNode(run[0]));
+        return;
+      }
+      var span = document.createElement("span");
+      span.className = run[1];
+      span.textContent = run[0];
+      row.appendChild(span);
+    });
+  }
+
+  function init(root) {
+    var dataEl = root.querySelector(".cast-data");
+    var screen = root.querySelector(".cast-screen");
+    var controls = root.querySelector(".cast-controls");
+    if (!dataEl || !screen || !controls) {
+      return;
+    }
+    var data = JSON.parse(dataEl.textContent);
+    var frames = data.frames;
+    var duration = data.duration;
+
+    var play = controls.querySelector(".cast-play");
+    var seek = controls.querySelector(".cast-seek");
+    var time = controls.querySelector(".cast-time");
+    var speed = controls.querySelector(".cast-speed");
+
+    var rows = [];
+    var height = 0;
+    var index = 0;
+    var current = 0;
+    var playing = false;
+    var last = 0;
+
+    function setHeight(n) {
+      while (rows.length < n) {
+        var row = document.createElement("div");
+        row.className = "cast-row";
+        screen.appendChild(row);
+        rows.push(row);
+      }
+      rows.forEach(function (row, y) {
+        row.hidden = y >= n;
+      });
+      height = n;
+    }
+
+    function reset() {
+      rows.forEach(function (row) {
+        row.textContent = "";
+      });
+      index = 0;
+    }
+
+    function seekTo(t) {
+      if (t < current || index === 0) {
+        reset();
+      }
+      while (index < frames.length && frames[index][0] <= t) {
+        var frame = frames[index++];
+        if (frame[1] !== height) {
+          setHeight(frame[1]);
+        }
+        frame[2].forEach(function (change) {
+          fillRow(rows[change[0]], change[1]);
+        });
+      }
+      current = t;
+      seek.value = t;
+      time.textContent = formatTime(t) + " / " + formatTime(duration);
+    }
+
+    function tick(now) {
+      if (!playing) {
+        return;
+      }
+      var t = current + ((now - last) / 1000) * parseFloat(speed.value);
+      last = now;
+      if (t >= duration) {
+        seekTo(duration);
+        stop();
+        return;
+      }
+      seekTo(t);
+      window.requestAnimationFrame(tick);
+    }
+
+    function start() {
+      if (current >= duration) {
+        current = 0;
+        reset();
+      }
+      playing = true;
+      play.textContent = "pause";
+      last = performance.now();
+      window.requestAnimationFrame(tick);
+    }
+
+    function stop() {
+      playing = false;
+      play.textContent = "play";
+    }
+
+    play.addEventListener("click", function () {
+      if (playing) {
+        stop();
+      } else {
+        start();
+      }
+    });
+    seek.addEventListener("input", function () {
+      seekTo(parseFloat(seek.value));
+    });
+
+    // Replace the server-rendered final frame with rows the player can update.
+    screen.textContent = "";
+    seek.max = duration;
+    seekTo(duration);
+    controls.hidden = false;
+  }
+
+  document.querySelectorAll(".cast").forEach(init);
+})();
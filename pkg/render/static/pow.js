@@ -0,0 +1,142 @@
+// Solves a proof of work challenge before the new paste form is sent, for
+// users without an API key. SHA-256 is computed here, as crypto.subtle is
+// only available over HTTPS.
+(function () {
+  "use strict";
+
+  var form = document.querySelector("form[data-pow]");
+  if (!form) {
+    return;
+  }
+  var field = form.elements.pow;
+  var button = form.querySelector("button[type=submit]");
+  var label = button.textContent;
+  var solving = false;
+
+  var K = [
+    0x428a2f98, 0x71374491, 0xb5c0fbcf, 0xe9b5dba5, 0x3956c25b, 0x59f111f1, 0x923f82a4, 0xab1c5ed5,
+    0xd807aa98, 0x12835b01, 0x243185be, 0x550c7dc3, 0x72be5d74, 0x80deb1fe, 0x9bdc06a7, 0xc19bf174,
+    0xe49b69c1, 0xefbe4786, 0x0fc19dc6, 0x240ca1cc, 0x2de92c6f, 0x4a7484aa, 0x5cb0a9dc, 0x76f988da,
+    0x983e5152, 0xa831c66d, 0xb00327c8, 0xbf597fc7, 0xc6e00bf3, 0xd5a79147, 0x06ca6351, 0x14292967,
+    0x27b70a85, 0x2e1b2138, 0x4d2c6dfc, 0x53380d13, 0x650a7354, 0x766a0abb, 0x81c2c92e, 0x92722c85,
+    0xa2bfe8a1, 0xa81a664b, 0xc24b8b70, 0xc76c51a3, 0xd192e819, 0xd6990624, 0xf40e3585, 0x106aa070,
+    0x19a4c116, 0x1e376c08, 0x2748774c, 0x34b0bcb5, 0x391c0cb3, 0x4ed8aa4a, 0x5b9cca4f, 0x682e6ff3,
+    0x748f82ee, 0x78a5636f, 0x84c87814, 0x8cc70208, 0x90befffa, 0xa4506ceb, 0xbef9a3f7, 0xc67178f2
+  ];
+
+  function ror(x, n) {
+    return (x >>> n) | (x << (32 - n));
+  }
+
+  // sha256 returns the SHA-256 hash of the ASCII string s as eight words.
+  function sha256(s) {
+    var blocks = (s.length + 9 + 63) >> 6;
+    var words = new Array(blocks * 16).fill(0);
+    for (var i = 0; i < s.length; i++) {
+      words[i >> 2] |= s.charCodeAt(i) << (24 - (i & 3) * 8);
+    }
+    words[s.length >> 2] |= 0x80 << (24 - (s.length & 3) * 8);
+    words[words.length - 1] = s.length * 8;
+
+    var h = [0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a, 0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19];
+    var w = new Array(64);
+    for (var b = 0; b < blocks; b++) {
+      for (var t = 0; t < 64; t++) {
+        if (t < 16) {
+          w[t] = words[b * 16 + t];
+        } else {
+          var s0 = ror(w[t - 15], 7) ^ ror(w[t - 15], 18) ^ (w[t - 15] >>> 3);
+          var s1 = ror(w[t - 2], 17) ^ ror(w[t - 2], 19) ^ (w[t - 2] >>> 10);
+          w[t] = (w[t - 16] + s0 + w[t - 7] + s1) | 0;
+        }
+      }
+      var v = h.slice();
+      for (t = 0; t < 64; t++) {
+        var t1 = (v[7] + (ror(v[4], 6) ^ ror(v[4], 11) ^ ror(v[4], 25)) + ((v[4] & v[5]) ^ (~v[4] & v[6])) + K[t] + w[t]) | 0;
+        var t2 = ((ror(v[0], 2) ^ ror(v[0], 13) ^ ror(v[0], 22)) + ((v[0] & v[1]) ^ (v[0] & v[2]) ^ (v[1] & v[2]))) | 0;
+        v.pop();
+        v.unshift((t1 + t2) | 0);
+        v[4] = (v[4] + t1) | 0;
+      }
+      for (i = 0; i < 8; i++) {
+        h[i] = (h[i] + v[i]) | 0;
+      }
+    }
+    return h;
+  }
+
+  function zeroBits(hash) {
+    var bits = 0;
+    for (var i = 0; i < hash.length; i++) {
+      if (hash[i] !== 0) {
+        return bits + Math.clz32(hash[i]);
+      }
+      bits += 32;
+    }
+    return bits;
+  }
+
+  // solve counts up from zero until the hash of the token, a colon and the
+  // count has enough leading zero bits, yielding to the page between batches.
+  function solve(token, bits) {
+    return new Promise(function (resolve) {
+      var n = 0;
+      (function batch() {
+        for (var end = n + 20000; n < end; n++) {
+          if (zeroBits(sha256(token + ":" + n)) >= bits) {
+            resolve(String(n));
+            return;
+          }
+        }
+        setTimeout(batch, 0);
+      })();
+    });
+  }
+
+  function reset() {
+    solving = false;
+    button.disabled = false;
+    button.textContent = label;
+  }
+
+  form.addEventListener("submit", function (e) {
+    var key = form.elements.api_key;
+    if (field.value || (key && key.value)) {
+      return;
+    }
+    e.preventDefault();
+    if (solving) {
+      return;
+    }
+    solving = true;
+    button.disabled = true;
+    button.textContent = "Working…";
+    fetch(form.getAttribute("data-pow"), { headers: { Accept: "application/json" } })
+      .then(function (resp) {
+        if (!resp.ok) {
+          throw new Error("Could not get a challenge (" + resp.status + ")");
+        }
+        return resp.json();
+      })
+      .then(function (c) {
+        return solve(c.challenge, c.difficulty).then(function (solution) {
+          field.value = c.challenge + ":" + solution;
+          form.submit();
+        });
+      })
+      .catch(function (err) {
+        reset();
+        var p = document.querySelector(".form-error") || document.createElement("p");
+        p.className = "form-error";
+        p.setAttribute("role", "alert");
+        p.textContent = err.message;
+        form.parentNode.insertBefore(p, form);
+      });
+  });
+
+  // Pages restored from the history cache would send a used challenge.
+  window.addEventListener("pageshow", function () {
+    field.value = "";
+    reset();
+  });
+})();
@@ -0,0 +1,101 @@
+// Line range selection (#L10-L20), copy button and sortable tables for rendered pastes.
+(function () {
+  "use strict";
+
+  function parseRange(hash) {
+    var m = /^#L(\d+)(?:-L(\d+))?$/.exec(hash);
+    if (!m) {
+      return null;
+    }
+    var start = parseInt(m[1], 10);
+    var end = m[2] ? parseInt(m[2], 10) : start;
+    return start <= end ? [start, end] : [end, start];
+  }
+
+  function highlight() {
+    document.querySelectorAll(".line.selected").forEach(function (el) {
+      el.classList.remove("selected");
+    });
+    var range = parseRange(window.location.hash);
+    if (!range) {
+      return;
+    }
+    for (var i = range[0]; i <= range[1]; i++) {
+      var ln = document.getElementById("L" + i);
+      if (ln && ln.parentElement) {
+        ln.parentElement.classList.add("selected");
+      }
+    }
+    var first = document.getElementById("L" + range[0]);
+    if (first) {
+      first.scrollIntoView({ block: "center" });
+    }
+  }
+
+  // Shift-click on a line number extends the selection into a range.
+  document.addEventListener("click", function (e) {
+    var link = e.target.closest(".ln a");
+    if (!link || !e.shiftKey) {
+      return;
+    }
+    var current = parseRange(window.location.hash);
+    var clicked = parseRange(link.getAttribute("href"));
+    if (!current || !clicked) {
+      return;
+    }
+    e.preventDefault();
+    var start = Math.min(current[0], clicked[0]);
+    var end = Math.max(current[1], clicked[1]);
+    history.replaceState(null, "", "#L" + start + "-L" + end);
+    highlight();
+  });
+
+  window.addEventListener("hashchange", highlight);
+  highlight();
+
+  var copy = document.getElementById("copy");
+  if (copy && navigator.clipboard) {
+    copy.hidden = false;
+    copy.addEventListener("click", function () {
+      var lines = document.querySelectorAll("#paste .cl");
+      var text = Array.prototype.map.call(lines, function (el) {
+        return el.textContent;
+      }).join("");
+      navigator.clipboard.writeText(text).then(function () {
+        copy.textContent = "copied";
+        setTimeout(function () {
+          copy.textContent = "copy";
+        }, 1500);
+      });
+    });
+  }
+
+  // Clicking a table header sorts by that column, numerically if possible.
+  document.querySelectorAll("table.csv thead th").forEach(function (th, col) {
+    th.addEventListener("click", function () {
+      var table = th.closest("table");
+      var tbody = table.tBodies[0];
+      if (!tbody) {
+        return;
+      }
+      var asc = th.getAttribute("aria-sort") !== "ascending";
+      table.querySelectorAll("thead th").forEach(function (other) {
+        other.removeAttribute("aria-sort");
+      });
+      th.setAttribute("aria-sort", asc ? "ascending" : "descending");
+
+      var rows = Array.prototype.slice.call(tbody.rows);
+      rows.sort(function (a, b) {
+        var x = a.cells[col] ? a.cells[col].textContent : "";
+        var y = b.cells[col] ? b.cells[col].textContent : "";
+        var nx = parseFloat(x);
+        var ny = parseFloat(y);
+        var cmp = !isNaN(nx) && !isNaN(ny) ? nx - ny : x.localeCompare(y);
+        return asc ? cmp : -cmp;
+      });
+      rows.forEach(function (row) {
+        tbody.appendChild(row);
+      });
+    });
+  });
+})();
@@ -0,0 +1,151 @@
+package transforms
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Header bytes written by AdaptiveTransformer ahead of the payload.
+const (
+	adaptiveStored     byte = 0x00
+	adaptiveCompressed byte = 0x01
+)
+
+// DefaultEntropyThreshold is the Shannon entropy, in bits per byte, above which
+// a sample is considered incompressible.
+const DefaultEntropyThreshold = 7.5
+
+// DefaultSampleSize is the number of leading bytes inspected by AdaptiveTransformer.
+const DefaultSampleSize = 64 * 1024
+
+// compressedMagic lists the signatures of formats that are already compressed.
+var compressedMagic = []struct {
+	offset int
+	magic  []byte
+}{
+	{0, []byte{0x1f, 0x8b}},                       // gzip
+	{0, []byte{0x28, 0xb5, 0x2f, 0xfd}},           // zstd
+	{0, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},   // xz
+	{0, []byte{0x04, 0x22, 0x4d, 0x18}},           // lz4
+	{0, []byte("BZh")},                            // bzip2
+	{0, []byte{'P', 'K', 0x03, 0x04}},             // zip, jar, docx...
+	{0, []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c}}, // 7z
+	{0, []byte("Rar!\x1a\x07")},                   // rar
+	{0, []byte{0x89, 'P', 'N', 'G'}},              // png
+	{0, []byte{0xff, 0xd8, 0xff}},                 // jpeg
+	{0, []byte("GIF8")},                           // gif
+	{8, []byte("WEBP")},                           // webp
+	{4, []byte("ftyp")},                           // mp4, mov, heic
+	{0, []byte{0x1a, 0x45, 0xdf, 0xa3}},           // mkv, webm
+	{0, []byte("OggS")},                           // ogg
+	{0, []byte("ID3")},                            // mp3
+	{0, []byte{0x00, 0x61, 0x73, 0x6d}},           // wasm
+}
+
+// AdaptiveTransformer compresses data with an inner compressor only when a gain is expected.
+//
+// The leading bytes of the input are checked for the magic numbers of
+// already-compressed formats and for high entropy. A one byte header records
+// whether the payload was compressed so that ReverseTransform can undo it.
+type AdaptiveTransformer struct {
+	inner            Transformer
+	entropyThreshold float64
+	sampleSize       int
+}
+
+// NewAdaptiveTransformer creates a new AdaptiveTransformer around the given compressor.
+// Zero values for entropyThreshold and sampleSize select the defaults.
+func NewAdaptiveTransformer(inner Transformer, entropyThreshold float64, sampleSize int) (*AdaptiveTransformer, error) {
+	if inner == nil {
+		return nil, fmt.Errorf("adaptive transformer requires a compressor")
+	}
+	if entropyThreshold == 0 {
+		entropyThreshold = DefaultEntropyThreshold
+	}
+	if entropyThreshold < 0 || entropyThreshold > 8 {
+		return nil, fmt.Errorf("invalid entropy threshold: must be between 0 and 8")
+	}
+	if sampleSize <= 0 {
+		sampleSize = DefaultSampleSize
+	}
+	return &AdaptiveTransformer{inner: inner, entropyThreshold: entropyThreshold, sampleSize: sampleSize}, nil
+}
+
+// Transform compresses the input if it looks compressible and the result is smaller.
+func (t *AdaptiveTransformer) Transform(input io.Reader) (io.Reader, error) {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.shouldCompress(data) {
+		compressed, err := t.inner.Transform(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		out, err := io.ReadAll(compressed)
+		if err != nil {
+			return nil, err
+		}
+		if len(out) < len(data) {
+			return io.MultiReader(bytes.NewReader([]byte{adaptiveCompressed}), bytes.NewReader(out)), nil
+		}
+	}
+
+	return io.MultiReader(bytes.NewReader([]byte{adaptiveStored}), bytes.NewReader(data)), nil
+}
+
+// ReverseTransform reads the header byte and decompresses the payload if needed.
+func (t *AdaptiveTransformer) ReverseTransform(input io.Reader) (io.Reader, error) {
+	header := make([]byte, 1)
+	if _, err := io.ReadFull(input, header); err != nil {
+		return nil, fmt.Errorf("missing adaptive compression header: %v", err)
+	}
+
+	switch header[0] {
+	case adaptiveStored:
+		return input, nil
+	case adaptiveCompressed:
+		return t.inner.ReverseTransform(input)
+	default:
+		return nil, fmt.Errorf("unknown adaptive compression header %#x", header[0])
+	}
+}
+
+func (t *AdaptiveTransformer) shouldCompress(data []byte) bool {
+	if len(data) == 0 || isCompressedFormat(data) {
+		return false
+	}
+	sample := data[:min(len(data), t.sampleSize)]
+	return entropy(sample) < t.entropyThreshold
+}
+
+func isCompressedFormat(data []byte) bool {
+	for _, m := range compressedMagic {
+		if len(data) >= m.offset+len(m.magic) && bytes.Equal(data[m.offset:m.offset+len(m.magic)], m.magic) {
+			return true
+		}
+	}
+	return false
+}
+
+// entropy returns the Shannon entropy of data in bits per byte.
+func entropy(data []byte) float64 {
+	var counts [256]int
+	for _, b := range data {
+		counts[b]++
+	}
+
+	var e float64
+	n := float64(len(data))
+	for _, c := range counts {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / n
+		e -= p * math.Log2(p)
+	}
+	return e
+}
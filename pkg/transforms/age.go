@@ -0,0 +1,135 @@
+package transforms
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"filippo.io/age/armor"
+)
+
+// AgeTransformer encrypts data to a set of age recipients.
+//
+// The ciphertext is ASCII-armored. In store-only mode the server holds no
+// identities and ReverseTransform returns the armored ciphertext unchanged,
+// so pastes can only be read by holders of the matching private keys.
+type AgeTransformer struct {
+	recipients []age.Recipient
+	identities []age.Identity
+	storeOnly  bool
+}
+
+var _ StoreOnlyTransformer = (*AgeTransformer)(nil)
+
+// NewAgeTransformer creates a new AgeTransformer.
+// identities may be empty when storeOnly is true.
+func NewAgeTransformer(recipients []age.Recipient, identities []age.Identity, storeOnly bool) (*AgeTransformer, error) {
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("age transformer requires at least one recipient")
+	}
+	if !storeOnly && len(identities) == 0 {
+		return nil, fmt.Errorf("age transformer requires an identity unless store-only mode is enabled")
+	}
+	return &AgeTransformer{recipients: recipients, identities: identities, storeOnly: storeOnly}, nil
+}
+
+// StoreOnly reports whether the stored ciphertext is served without decryption.
+func (t *AgeTransformer) StoreOnly() bool {
+	return t.storeOnly
+}
+
+// Transform encrypts the input data to all recipients.
+func (t *AgeTransformer) Transform(input io.Reader) (io.Reader, error) {
+	var buf bytes.Buffer
+	aw := armor.NewWriter(&buf)
+
+	w, err := age.Encrypt(aw, t.recipients...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(w, input); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	if err := aw.Close(); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+// ReverseTransform decrypts the input data, or returns it unchanged in store-only mode.
+func (t *AgeTransformer) ReverseTransform(input io.Reader) (io.Reader, error) {
+	if t.storeOnly {
+		return input, nil
+	}
+	r, err := age.Decrypt(armor.NewReader(input), t.identities...)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, r); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+// ParseAgeRecipient parses an age X25519 recipient ("age1...") or an SSH public key.
+func ParseAgeRecipient(s string) (age.Recipient, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "age1") {
+		return age.ParseX25519Recipient(s)
+	}
+	if strings.HasPrefix(s, "ssh-") {
+		return agessh.ParseRecipient(s)
+	}
+	return nil, fmt.Errorf("unknown recipient type %q", s)
+}
+
+// ParseAgeRecipientsFile parses a recipients file with one recipient per line.
+// Empty lines and lines starting with '#' are ignored.
+func ParseAgeRecipientsFile(path string) ([]age.Recipient, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var recipients []age.Recipient
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r, err := ParseAgeRecipient(line)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, scanner.Err()
+}
+
+// ParseAgeIdentityFile parses an age identity file or an unencrypted SSH private key.
+func ParseAgeIdentityFile(path string) ([]age.Identity, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN")) {
+		id, err := agessh.ParseIdentity(data)
+		if err != nil {
+			return nil, err
+		}
+		return []age.Identity{id}, nil
+	}
+	return age.ParseIdentities(bytes.NewReader(data))
+}
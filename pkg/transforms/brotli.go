@@ -0,0 +1,44 @@
+package transforms
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/andybalholm/brotli"
+)
+
+// BrotliTransformer compresses and decompresses data using Brotli.
+type BrotliTransformer struct {
+	// Level is the brotli quality (0-11). Zero selects brotli.DefaultCompression.
+	Level int
+}
+
+// NewBrotliTransformer creates a new BrotliTransformer with the given compression level.
+func NewBrotliTransformer(level int) *BrotliTransformer {
+	return &BrotliTransformer{Level: level}
+}
+
+func (t *BrotliTransformer) Transform(input io.Reader) (io.Reader, error) {
+	level := t.Level
+	if level == 0 {
+		level = brotli.DefaultCompression
+	}
+
+	var buf bytes.Buffer
+	bw := brotli.NewWriterLevel(&buf, level)
+	if _, err := io.Copy(bw, input); err != nil {
+		return nil, err
+	}
+	if err := bw.Close(); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+func (t *BrotliTransformer) ReverseTransform(input io.Reader) (io.Reader, error) {
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, brotli.NewReader(input)); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
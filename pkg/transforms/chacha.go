@@ -0,0 +1,82 @@
+package transforms
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// ChaChaTransformer encrypts and decrypts data using ChaCha20-Poly1305.
+//
+// In extended mode it uses XChaCha20-Poly1305, whose 192-bit nonces can be
+// generated at random without a practical risk of collision.
+type ChaChaTransformer struct {
+	key      []byte
+	extended bool
+}
+
+// NewChaChaTransformer creates a new ChaChaTransformer with the given 32-byte key.
+// If extended is true, XChaCha20-Poly1305 is used.
+func NewChaChaTransformer(key []byte, extended bool) (*ChaChaTransformer, error) {
+	if len(key) != chacha20poly1305.KeySize {
+		return nil, fmt.Errorf("invalid key length: must be %d bytes", chacha20poly1305.KeySize)
+	}
+	return &ChaChaTransformer{key: key, extended: extended}, nil
+}
+
+func (t *ChaChaTransformer) aead() (cipher.AEAD, error) {
+	if t.extended {
+		return chacha20poly1305.NewX(t.key)
+	}
+	return chacha20poly1305.New(t.key)
+}
+
+// Transform encrypts the input data, prefixing the ciphertext with a random nonce.
+func (t *ChaChaTransformer) Transform(input io.Reader) (io.Reader, error) {
+	plaintext, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := t.aead()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(aead.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+// ReverseTransform decrypts and authenticates the input data.
+func (t *ChaChaTransformer) ReverseTransform(input io.Reader) (io.Reader, error) {
+	ciphertext, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := t.aead()
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := aead.NonceSize()
+	if len(ciphertext) < nonceSize+aead.Overhead() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+
+	nonce, encryptedData := ciphertext[:nonceSize], ciphertext[nonceSize:]
+	plaintext, err := aead.Open(nil, nonce, encryptedData, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(plaintext), nil
+}
@@ -0,0 +1,98 @@
+package transforms
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+func transformBytes(t *testing.T, tr Transformer, data []byte) []byte {
+	t.Helper()
+	r, err := tr.Transform(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Transform: %v", err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading transformed data: %v", err)
+	}
+	return out
+}
+
+func reverseBytes(tr Transformer, data []byte) ([]byte, error) {
+	r, err := tr.ReverseTransform(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// FuzzChaCha checks that both ChaCha20-Poly1305 variants, alone and in a
+// chain, round-trip any input and reject it after any byte of the nonce or
+// ciphertext is changed.
+func FuzzChaCha(f *testing.F) {
+	f.Add([]byte(""), uint(0), byte(1))
+	f.Add([]byte("hello, world"), uint(3), byte(0x80))
+	f.Add(bytes.Repeat([]byte("paste "), 1000), uint(12345), byte(0xff))
+
+	key := bytes.Repeat([]byte{0x42}, chacha20poly1305.KeySize)
+	type variant struct {
+		name string
+		tr   Transformer
+	}
+	var variants []variant
+	for _, extended := range []bool{false, true} {
+		cc, err := NewChaChaTransformer(key, extended)
+		if err != nil {
+			f.Fatal(err)
+		}
+		name := "chacha20"
+		if extended {
+			name = "xchacha20"
+		}
+		variants = append(variants,
+			variant{name, cc},
+			variant{name + " chain", NewChainTransformer(NewBase64Transformer(), cc)},
+		)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, pos uint, flip byte) {
+		if flip == 0 {
+			flip = 1
+		}
+		for _, tt := range variants {
+			sealed := transformBytes(t, tt.tr, data)
+			opened, err := reverseBytes(tt.tr, sealed)
+			if err != nil {
+				t.Fatalf("%s: ReverseTransform: %v", tt.name, err)
+			}
+			if !bytes.Equal(opened, data) {
+				t.Fatalf("%s: round trip changed %q to %q", tt.name, data, opened)
+			}
+
+			tampered := bytes.Clone(sealed)
+			tampered[pos%uint(len(tampered))] ^= flip
+			if _, err := reverseBytes(tt.tr, tampered); err == nil {
+				t.Fatalf("%s: accepted data with byte %d changed", tt.name, pos%uint(len(tampered)))
+			}
+		}
+	})
+}
+
+func TestChaChaRejectsTruncated(t *testing.T) {
+	key := bytes.Repeat([]byte{0x42}, chacha20poly1305.KeySize)
+	for _, extended := range []bool{false, true} {
+		cc, err := NewChaChaTransformer(key, extended)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sealed := transformBytes(t, cc, []byte("hello"))
+		for n := 0; n < len(sealed); n++ {
+			if _, err := reverseBytes(cc, sealed[:n]); err == nil {
+				t.Errorf("extended=%v: accepted %d of %d bytes", extended, n, len(sealed))
+			}
+		}
+	}
+}
@@ -16,22 +16,42 @@ func NewChainTransformer(transformers ...Transformer) *ChainTransformer {
 
 // Transform applies all transformers in sequence.
 func (ct *ChainTransformer) Transform(input io.Reader) (io.Reader, error) {
-	var err error
+	current, _, err := ct.TransformFlags(input)
+	return current, err
+}
+
+// TransformFlags applies all transformers in sequence and collects the flags
+// reported by any FlaggingTransformer in the chain.
+func (ct *ChainTransformer) TransformFlags(input io.Reader) (io.Reader, []string, error) {
+	var (
+		err   error
+		flags []string
+	)
 	current := input
 	for _, transformer := range ct.transformers {
-		current, err = transformer.Transform(current)
+		if ft, ok := transformer.(FlaggingTransformer); ok {
+			var f []string
+			current, f, err = ft.TransformFlags(current)
+			flags = append(flags, f...)
+		} else {
+			current, err = transformer.Transform(current)
+		}
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
-	return current, nil
+	return current, flags, nil
 }
 
 // ReverseTransform applies all transformers in reverse order.
+// It stops early at a store-only transformer, returning the data as that transformer stored it.
 func (ct *ChainTransformer) ReverseTransform(input io.Reader) (io.Reader, error) {
 	var err error
 	current := input
 	for i := len(ct.transformers) - 1; i >= 0; i-- {
+		if so, ok := ct.transformers[i].(StoreOnlyTransformer); ok && so.StoreOnly() {
+			return current, nil
+		}
 		current, err = ct.transformers[i].ReverseTransform(current)
 		if err != nil {
 			return nil, err
@@ -39,3 +59,14 @@ func (ct *ChainTransformer) ReverseTransform(input io.Reader) (io.Reader, error)
 	}
 	return current, nil
 }
+
+// StoreOnly reports whether ReverseTransform stops at a store-only transformer,
+// so that the data it returns is not the original paste.
+func (ct *ChainTransformer) StoreOnly() bool {
+	for _, t := range ct.transformers {
+		if so, ok := t.(StoreOnlyTransformer); ok && so.StoreOnly() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package transforms
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultExternalTimeout is the time an external transform may run if no timeout is configured.
+const DefaultExternalTimeout = 10 * time.Second
+
+// ErrOutputTooLarge is returned when an external transform writes more than its output limit.
+var ErrOutputTooLarge = errors.New("external transform output too large")
+
+// ExternalLimits bounds the resources used by an external transform.
+type ExternalLimits struct {
+	// Timeout is the maximum run time of a single invocation.
+	Timeout time.Duration
+
+	// MemoryLimit is the maximum memory, in bytes, available to a single invocation.
+	// Zero means no limit.
+	MemoryLimit int64
+
+	// MaxOutput is the maximum number of bytes an invocation may write. Zero means no limit.
+	MaxOutput int64
+}
+
+func (l ExternalLimits) timeout() time.Duration {
+	if l.Timeout <= 0 {
+		return DefaultExternalTimeout
+	}
+	return l.Timeout
+}
+
+// ExecTransformer runs an external program for each paste, writing the paste to
+// its stdin and reading the transformed data from its stdout.
+//
+// If no reverse command is configured, the transform is one-way and
+// ReverseTransform returns its input unchanged.
+type ExecTransformer struct {
+	forward []string
+	reverse []string
+	limits  ExternalLimits
+}
+
+// NewExecTransformer creates a new ExecTransformer.
+// forward and reverse are argument vectors; reverse may be empty.
+func NewExecTransformer(forward, reverse []string, limits ExternalLimits) (*ExecTransformer, error) {
+	if len(forward) == 0 {
+		return nil, fmt.Errorf("exec transformer requires a command")
+	}
+	if limits.MemoryLimit > 0 && !memoryLimitSupported {
+		return nil, fmt.Errorf("memory limits for exec transforms are only supported on linux")
+	}
+	return &ExecTransformer{forward: forward, reverse: reverse, limits: limits}, nil
+}
+
+func (t *ExecTransformer) Transform(input io.Reader) (io.Reader, error) {
+	return t.run(t.forward, input)
+}
+
+func (t *ExecTransformer) ReverseTransform(input io.Reader) (io.Reader, error) {
+	if len(t.reverse) == 0 {
+		return input, nil
+	}
+	return t.run(t.reverse, input)
+}
+
+func (t *ExecTransformer) run(argv []string, input io.Reader) (io.Reader, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), t.limits.timeout())
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	out := &limitedBuffer{buf: &stdout, limit: t.limits.MaxOutput}
+	name := argv[0]
+	if t.limits.MemoryLimit > 0 {
+		argv = withMemoryLimit(argv, t.limits.MemoryLimit)
+	}
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stdin = input
+	cmd.Stdout = out
+	cmd.Stderr = &limitedBuffer{buf: &stderr, limit: 4096}
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("%s timed out after %s", name, t.limits.timeout())
+	}
+	if out.exceeded {
+		return nil, ErrOutputTooLarge
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %v: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return &stdout, nil
+}
+
+// limitedBuffer is a writer that fails once more than limit bytes are written.
+// A zero limit means no limit.
+type limitedBuffer struct {
+	buf      *bytes.Buffer
+	limit    int64
+	exceeded bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.limit > 0 && int64(b.buf.Len()+len(p)) > b.limit {
+		b.exceeded = true
+		return 0, ErrOutputTooLarge
+	}
+	return b.buf.Write(p)
+}
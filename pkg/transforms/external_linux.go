@@ -0,0 +1,15 @@
+package transforms
+
+import "strconv"
+
+// memoryLimitSupported reports whether ExternalLimits.MemoryLimit is enforced
+// for exec transforms on this platform.
+const memoryLimitSupported = true
+
+// withMemoryLimit returns argv wrapped in a shell that caps its address space
+// at limit bytes and then execs the program, so the program never runs
+// without the limit.
+func withMemoryLimit(argv []string, limit int64) []string {
+	kb := strconv.FormatInt(max(limit/1024, 1), 10)
+	return append([]string{"/bin/sh", "-c", `ulimit -v "$0" && exec "$@"`, kb}, argv...)
+}
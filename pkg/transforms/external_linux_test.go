@@ -0,0 +1,34 @@
+package transforms
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestExecTransformerMemoryLimit(t *testing.T) {
+	// The limit must already apply when the program starts.
+	tr, err := NewExecTransformer([]string{"sh", "-c", "ulimit -v"}, nil, ExternalLimits{MemoryLimit: 64 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tr.Transform(strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(out)
+	if strings.TrimSpace(string(got)) != "65536" {
+		t.Fatalf("ulimit -v in the program = %q, want 65536", got)
+	}
+}
+
+func TestExecTransformerMemoryLimitExceeded(t *testing.T) {
+	tr, err := NewExecTransformer([]string{"sh", "-c", `x=$(head -c 67108864 /dev/zero | tr '\0' a); echo done`}, nil, ExternalLimits{MemoryLimit: 32 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := tr.Transform(strings.NewReader("")); err == nil {
+		got, _ := io.ReadAll(out)
+		t.Fatalf("program ran past its memory limit: %q", got)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package transforms
+
+// memoryLimitSupported reports whether ExternalLimits.MemoryLimit is enforced
+// for exec transforms on this platform.
+const memoryLimitSupported = false
+
+// withMemoryLimit is never called, since NewExecTransformer rejects memory
+// limits on this platform.
+func withMemoryLimit(argv []string, limit int64) []string {
+	return argv
+}
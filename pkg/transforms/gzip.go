@@ -6,12 +6,29 @@ import (
 	"io"
 )
 
-type GZipTransformer struct{}
+// GZipTransformer compresses and decompresses data using gzip.
+type GZipTransformer struct {
+	// Level is the gzip compression level. Zero selects gzip.DefaultCompression.
+	Level int
+}
+
+// NewGZipTransformer creates a new GZipTransformer with the given compression level.
+func NewGZipTransformer(level int) *GZipTransformer {
+	return &GZipTransformer{Level: level}
+}
 
 func (t *GZipTransformer) Transform(input io.Reader) (io.Reader, error) {
+	level := t.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+
 	var buf bytes.Buffer
-	gz := gzip.NewWriter(&buf)
-	_, err := io.Copy(gz, input)
+	gz, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(gz, input)
 	if err != nil {
 		return nil, err
 	}
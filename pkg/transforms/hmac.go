@@ -0,0 +1,59 @@
+package transforms
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"io"
+)
+
+// HMACTransformer appends an HMAC-SHA256 tag to the data and verifies it on read.
+//
+// It detects tampering and bit-rot in the storage backend when no
+// authenticated encryption transform is configured.
+type HMACTransformer struct {
+	key []byte
+}
+
+// NewHMACTransformer creates a new HMACTransformer with the given key.
+func NewHMACTransformer(key []byte) (*HMACTransformer, error) {
+	if len(key) == 0 {
+		return nil, fmt.Errorf("hmac key must not be empty")
+	}
+	return &HMACTransformer{key: key}, nil
+}
+
+// Transform appends the HMAC-SHA256 tag of the input data.
+func (t *HMACTransformer) Transform(input io.Reader) (io.Reader, error) {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, t.key)
+	mac.Write(data)
+
+	return io.MultiReader(bytes.NewReader(data), bytes.NewReader(mac.Sum(nil))), nil
+}
+
+// ReverseTransform verifies and strips the trailing tag.
+// It returns ErrIntegrity if the tag is missing or does not match.
+func (t *HMACTransformer) ReverseTransform(input io.Reader) (io.Reader, error) {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < sha256.Size {
+		return nil, ErrIntegrity
+	}
+
+	payload, tag := data[:len(data)-sha256.Size], data[len(data)-sha256.Size:]
+	mac := hmac.New(sha256.New, t.key)
+	mac.Write(payload)
+	if !hmac.Equal(tag, mac.Sum(nil)) {
+		return nil, ErrIntegrity
+	}
+
+	return bytes.NewReader(payload), nil
+}
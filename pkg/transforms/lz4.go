@@ -0,0 +1,51 @@
+package transforms
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/pierrec/lz4/v4"
+)
+
+// LZ4Transformer compresses and decompresses data using the LZ4 frame format.
+type LZ4Transformer struct {
+	level lz4.CompressionLevel
+}
+
+// NewLZ4Transformer creates a new LZ4Transformer.
+// level is 0 (fast) or 1-9 for the high compression modes.
+func NewLZ4Transformer(level int) (*LZ4Transformer, error) {
+	if level < 0 || level > 9 {
+		return nil, fmt.Errorf("invalid lz4 level %d: must be between 0 and 9", level)
+	}
+	l := lz4.Fast
+	if level > 0 {
+		// lz4.Level1..Level9 are successive powers of two.
+		l = lz4.CompressionLevel(1 << (8 + level))
+	}
+	return &LZ4Transformer{level: l}, nil
+}
+
+func (t *LZ4Transformer) Transform(input io.Reader) (io.Reader, error) {
+	var buf bytes.Buffer
+	zw := lz4.NewWriter(&buf)
+	if err := zw.Apply(lz4.CompressionLevelOption(t.level)); err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(zw, input); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+func (t *LZ4Transformer) ReverseTransform(input io.Reader) (io.Reader, error) {
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, lz4.NewReader(input)); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
@@ -0,0 +1,118 @@
+package transforms
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// ansiEscape matches CSI sequences (colors, cursor movement), OSC sequences
+// (window titles, hyperlinks) and two-byte escapes.
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// Line ending styles accepted by NormalizeOptions.LineEndings.
+const (
+	LineEndingsKeep = ""
+	LineEndingsLF   = "lf"
+	LineEndingsCRLF = "crlf"
+)
+
+// NormalizeOptions selects the normalizations applied by NormalizeTransformer.
+type NormalizeOptions struct {
+	// StripANSI removes ANSI escape sequences.
+	StripANSI bool
+
+	// CollapseCarriageReturns keeps only the last non-empty redraw of lines
+	// rewritten with '\r', such as progress bars.
+	CollapseCarriageReturns bool
+
+	// TrimTrailingWhitespace removes spaces and tabs at the end of each line.
+	TrimTrailingWhitespace bool
+
+	// LineEndings is one of LineEndingsKeep, LineEndingsLF or LineEndingsCRLF.
+	LineEndings string
+}
+
+// NormalizeTransformer cleans up text captured from terminals.
+//
+// It is one-way: the original bytes cannot be recovered, and ReverseTransform
+// returns its input unchanged. Input that looks binary is stored as-is.
+type NormalizeTransformer struct {
+	opts NormalizeOptions
+}
+
+// NewNormalizeTransformer creates a new NormalizeTransformer.
+func NewNormalizeTransformer(opts NormalizeOptions) (*NormalizeTransformer, error) {
+	switch opts.LineEndings {
+	case LineEndingsKeep, LineEndingsLF, LineEndingsCRLF:
+	default:
+		return nil, fmt.Errorf("unknown line ending style %s", opts.LineEndings)
+	}
+	return &NormalizeTransformer{opts: opts}, nil
+}
+
+// Transform normalizes the input text.
+func (t *NormalizeTransformer) Transform(input io.Reader) (io.Reader, error) {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.IndexByte(data[:min(len(data), 8192)], 0) >= 0 {
+		return bytes.NewReader(data), nil
+	}
+
+	if t.opts.StripANSI {
+		data = ansiEscape.ReplaceAll(data, nil)
+	}
+
+	var buf bytes.Buffer
+	lines := bytes.Split(data, []byte{'\n'})
+	for i, line := range lines {
+		crlf := bytes.HasSuffix(line, []byte{'\r'})
+		if crlf {
+			line = line[:len(line)-1]
+		}
+
+		if t.opts.CollapseCarriageReturns {
+			line = lastRedraw(line)
+		}
+		if t.opts.TrimTrailingWhitespace {
+			line = bytes.TrimRight(line, " \t")
+		}
+		buf.Write(line)
+
+		if i == len(lines)-1 {
+			break
+		}
+		switch {
+		case t.opts.LineEndings == LineEndingsCRLF:
+			buf.WriteString("\r\n")
+		case t.opts.LineEndings == LineEndingsKeep && crlf:
+			buf.WriteString("\r\n")
+		default:
+			buf.WriteByte('\n')
+		}
+	}
+
+	return &buf, nil
+}
+
+// ReverseTransform returns the input unchanged, since normalization cannot be undone.
+func (t *NormalizeTransformer) ReverseTransform(input io.Reader) (io.Reader, error) {
+	return input, nil
+}
+
+// lastRedraw returns the last non-empty segment of a line split on '\r'.
+func lastRedraw(line []byte) []byte {
+	if bytes.IndexByte(line, '\r') < 0 {
+		return line
+	}
+	segments := bytes.Split(line, []byte{'\r'})
+	for i := len(segments) - 1; i >= 0; i-- {
+		if len(segments[i]) > 0 {
+			return segments[i]
+		}
+	}
+	return nil
+}
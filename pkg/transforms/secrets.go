@@ -0,0 +1,233 @@
+package transforms
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SecretAction is what a SecretsTransformer does when it finds a secret.
+type SecretAction string
+
+const (
+	// SecretActionRedact replaces matches with a placeholder.
+	SecretActionRedact SecretAction = "redact"
+
+	// SecretActionReject fails the upload with a *SecretsError.
+	SecretActionReject SecretAction = "reject"
+
+	// SecretActionFlag stores the paste unchanged and reports flags for its metadata.
+	SecretActionFlag SecretAction = "flag"
+)
+
+// ErrSecretDetected is matched by the error returned when an upload is rejected for containing secrets.
+var ErrSecretDetected = errors.New("possible secrets detected")
+
+// SecretsError is returned by SecretsTransformer in reject mode.
+type SecretsError struct {
+	// Rules are the names of the rules that matched.
+	Rules []string
+}
+
+func (e *SecretsError) Error() string {
+	return fmt.Sprintf("%v (%s); remove them and try again", ErrSecretDetected, strings.Join(e.Rules, ", "))
+}
+
+func (e *SecretsError) Unwrap() error {
+	return ErrSecretDetected
+}
+
+// SecretRule is a named pattern that identifies a secret.
+type SecretRule struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// BuiltinSecretRules are the default patterns for common credential formats.
+var BuiltinSecretRules = []SecretRule{
+	{"aws_access_key_id", regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[A-Z0-9]{16}\b`)},
+	{"aws_secret_access_key", regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?[A-Za-z0-9/+=]{40}`)},
+	{"private_key", regexp.MustCompile(`-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----[\s\S]*?-----END (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----`)},
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{5,}\.eyJ[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]{10,}`)},
+	{"github_token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{22,255})\b`)},
+	{"gitlab_token", regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}\b`)},
+	{"slack_token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{"stripe_key", regexp.MustCompile(`\b(?:sk|rk)_live_[A-Za-z0-9]{24,}\b`)},
+	{"google_api_key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+}
+
+// entropyCandidate matches the tokens considered by the entropy heuristic.
+var entropyCandidate = regexp.MustCompile(`[A-Za-z0-9+/_=-]+`)
+
+// SecretsTransformer scans pastes for credentials.
+//
+// It should come before any encoding, compression or encryption transform so
+// that it sees the plaintext. Its ReverseTransform is a no-op.
+type SecretsTransformer struct {
+	rules  []SecretRule
+	action SecretAction
+
+	// entropyThreshold is the minimum entropy in bits per character for a token
+	// to be reported. Zero disables the heuristic.
+	entropyThreshold float64
+	entropyMinLength int
+}
+
+var _ FlaggingTransformer = (*SecretsTransformer)(nil)
+
+// NewSecretsTransformer creates a new SecretsTransformer.
+// A zero entropyThreshold disables the entropy heuristic.
+func NewSecretsTransformer(rules []SecretRule, action SecretAction, entropyThreshold float64, entropyMinLength int) (*SecretsTransformer, error) {
+	switch action {
+	case SecretActionRedact, SecretActionReject, SecretActionFlag:
+	case "":
+		action = SecretActionRedact
+	default:
+		return nil, fmt.Errorf("unknown secrets action %s", action)
+	}
+	if len(rules) == 0 && entropyThreshold == 0 {
+		return nil, fmt.Errorf("secrets transformer requires at least one rule or an entropy threshold")
+	}
+	if entropyMinLength <= 0 {
+		entropyMinLength = 20
+	}
+	return &SecretsTransformer{
+		rules:            rules,
+		action:           action,
+		entropyThreshold: entropyThreshold,
+		entropyMinLength: entropyMinLength,
+	}, nil
+}
+
+// Transform scans the input and applies the configured action.
+func (t *SecretsTransformer) Transform(input io.Reader) (io.Reader, error) {
+	out, _, err := t.TransformFlags(input)
+	return out, err
+}
+
+// TransformFlags scans the input and applies the configured action.
+// In flag mode it returns a "secret:<rule>" flag for every rule that matched.
+func (t *SecretsTransformer) TransformFlags(input io.Reader) (io.Reader, []string, error) {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	matches := t.scan(data)
+	if len(matches) == 0 {
+		return bytes.NewReader(data), nil, nil
+	}
+
+	rules := matchedRules(matches)
+	switch t.action {
+	case SecretActionReject:
+		return nil, nil, &SecretsError{Rules: rules}
+	case SecretActionFlag:
+		flags := make([]string, len(rules))
+		for i, r := range rules {
+			flags[i] = "secret:" + r
+		}
+		return bytes.NewReader(data), flags, nil
+	default:
+		return bytes.NewReader(redact(data, matches)), nil, nil
+	}
+}
+
+// ReverseTransform returns the input unchanged.
+func (t *SecretsTransformer) ReverseTransform(input io.Reader) (io.Reader, error) {
+	return input, nil
+}
+
+type secretMatch struct {
+	rule       string
+	start, end int
+}
+
+func (t *SecretsTransformer) scan(data []byte) []secretMatch {
+	var matches []secretMatch
+	for _, rule := range t.rules {
+		for _, loc := range rule.Pattern.FindAllIndex(data, -1) {
+			matches = append(matches, secretMatch{rule.Name, loc[0], loc[1]})
+		}
+	}
+
+	if t.entropyThreshold > 0 {
+		for _, loc := range entropyCandidate.FindAllIndex(data, -1) {
+			token := data[loc[0]:loc[1]]
+			if len(token) < t.entropyMinLength || !hasLettersAndDigits(token) {
+				continue
+			}
+			if overlaps(matches, loc[0], loc[1]) {
+				continue
+			}
+			if entropy(token) >= t.entropyThreshold {
+				matches = append(matches, secretMatch{"high_entropy_string", loc[0], loc[1]})
+			}
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].start < matches[j].start })
+	return matches
+}
+
+// redact replaces every match with a placeholder naming the rule.
+// Overlapping matches are merged into the first one, so that no part of
+// either is left in the output.
+func redact(data []byte, matches []secretMatch) []byte {
+	matches = append([]secretMatch(nil), matches...)
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].start < matches[j].start })
+
+	var buf bytes.Buffer
+	pos := 0
+	for i := 0; i < len(matches); {
+		m := matches[i]
+		end := m.end
+		for i++; i < len(matches) && matches[i].start < end; i++ {
+			end = max(end, matches[i].end)
+		}
+		buf.Write(data[pos:m.start])
+		buf.WriteString("[REDACTED:" + m.rule + "]")
+		pos = end
+	}
+	buf.Write(data[pos:])
+	return buf.Bytes()
+}
+
+func matchedRules(matches []secretMatch) []string {
+	seen := make(map[string]bool)
+	var rules []string
+	for _, m := range matches {
+		if !seen[m.rule] {
+			seen[m.rule] = true
+			rules = append(rules, m.rule)
+		}
+	}
+	sort.Strings(rules)
+	return rules
+}
+
+func overlaps(matches []secretMatch, start, end int) bool {
+	for _, m := range matches {
+		if start < m.end && m.start < end {
+			return true
+		}
+	}
+	return false
+}
+
+func hasLettersAndDigits(token []byte) bool {
+	var letter, digit bool
+	for _, c := range token {
+		switch {
+		case c >= '0' && c <= '9':
+			digit = true
+		case (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			letter = true
+		}
+	}
+	return letter && digit
+}
@@ -0,0 +1,73 @@
+package transforms
+
+import "testing"
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		matches []secretMatch
+		want    string
+	}{
+		{
+			name: "none",
+			data: "nothing to see",
+			want: "nothing to see",
+		},
+		{
+			name:    "single",
+			data:    "key=SECRET end",
+			matches: []secretMatch{{"a", 4, 10}},
+			want:    "key=[REDACTED:a] end",
+		},
+		{
+			name:    "overlapping",
+			data:    "xxAAAABBBByy",
+			matches: []secretMatch{{"a", 2, 8}, {"b", 6, 10}},
+			want:    "xx[REDACTED:a]yy",
+		},
+		{
+			name:    "overlapping out of order",
+			data:    "xxAAAABBBByy",
+			matches: []secretMatch{{"b", 6, 10}, {"a", 2, 8}},
+			want:    "xx[REDACTED:a]yy",
+		},
+		{
+			name:    "chain of overlaps",
+			data:    "0123456789",
+			matches: []secretMatch{{"a", 1, 4}, {"b", 3, 6}, {"c", 5, 8}},
+			want:    "0[REDACTED:a]89",
+		},
+		{
+			name:    "nested",
+			data:    "xxAAAAAAAAyy",
+			matches: []secretMatch{{"a", 2, 10}, {"b", 4, 6}},
+			want:    "xx[REDACTED:a]yy",
+		},
+		{
+			name:    "nested then overlapping",
+			data:    "0123456789",
+			matches: []secretMatch{{"a", 1, 6}, {"b", 2, 3}, {"c", 5, 8}},
+			want:    "0[REDACTED:a]89",
+		},
+		{
+			name:    "adjacent",
+			data:    "xxAAAABBBByy",
+			matches: []secretMatch{{"a", 2, 6}, {"b", 6, 10}},
+			want:    "xx[REDACTED:a][REDACTED:b]yy",
+		},
+		{
+			name:    "whole input",
+			data:    "SECRET",
+			matches: []secretMatch{{"a", 0, 6}},
+			want:    "[REDACTED:a]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(redact([]byte(tt.data), tt.matches)); got != tt.want {
+				t.Errorf("redact(%q) = %q, want %q", tt.data, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,10 +1,36 @@
 package transforms
 
-import "io"
-
+import (
+	"errors"
+	"io"
+)
 
 // Transformer defines an interface for bi-directional transformations on an io.Reader.
+//
+// Some transformers are one-way (e.g. NormalizeTransformer, SecretsTransformer):
+// their changes cannot be undone, and their ReverseTransform is a no-op that
+// returns its input unchanged.
 type Transformer interface {
 	Transform(input io.Reader) (io.Reader, error)
 	ReverseTransform(input io.Reader) (io.Reader, error)
 }
+
+// StoreOnlyTransformer is implemented by transformers that may serve their stored
+// form as-is. When StoreOnly returns true, ChainTransformer.ReverseTransform stops
+// at that transformer and returns its input without reversing earlier transformers.
+type StoreOnlyTransformer interface {
+	Transformer
+	StoreOnly() bool
+}
+
+// FlaggingTransformer is implemented by transformers that can label a paste
+// while transforming it. The flags are recorded in the paste's metadata.
+type FlaggingTransformer interface {
+	Transformer
+	TransformFlags(input io.Reader) (io.Reader, []string, error)
+}
+
+var (
+	// ErrIntegrity is returned when stored data fails an integrity check.
+	ErrIntegrity = errors.New("integrity check failed")
+)
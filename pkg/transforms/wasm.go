@@ -0,0 +1,109 @@
+package transforms
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// wasmPageSize is the size of a WebAssembly memory page.
+const wasmPageSize = 64 * 1024
+
+// WASMTransformer runs a WASI module for each paste, writing the paste to its
+// stdin and reading the transformed data from its stdout.
+//
+// The module is compiled once and instantiated per invocation with the
+// forward or reverse arguments. If no reverse arguments are configured, the
+// transform is one-way and ReverseTransform returns its input unchanged.
+type WASMTransformer struct {
+	runtime wazero.Runtime
+	module  wazero.CompiledModule
+	forward []string
+	reverse []string
+	limits  ExternalLimits
+}
+
+// NewWASMTransformer compiles the given WASI module.
+// forward and reverse are the arguments passed to the module; reverse may be nil.
+func NewWASMTransformer(wasm []byte, forward, reverse []string, limits ExternalLimits) (*WASMTransformer, error) {
+	ctx := context.Background()
+
+	rc := wazero.NewRuntimeConfig().WithCloseOnContextDone(true)
+	if limits.MemoryLimit > 0 {
+		pages := limits.MemoryLimit / wasmPageSize
+		if pages < 1 {
+			return nil, fmt.Errorf("wasm memory limit must be at least %d bytes", wasmPageSize)
+		}
+		rc = rc.WithMemoryLimitPages(uint32(min(pages, 65536)))
+	}
+
+	r := wazero.NewRuntimeWithConfig(ctx, rc)
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, r); err != nil {
+		r.Close(ctx)
+		return nil, err
+	}
+
+	module, err := r.CompileModule(ctx, wasm)
+	if err != nil {
+		r.Close(ctx)
+		return nil, fmt.Errorf("could not compile wasm module: %v", err)
+	}
+
+	return &WASMTransformer{runtime: r, module: module, forward: forward, reverse: reverse, limits: limits}, nil
+}
+
+func (t *WASMTransformer) Transform(input io.Reader) (io.Reader, error) {
+	return t.run(t.forward, input)
+}
+
+func (t *WASMTransformer) ReverseTransform(input io.Reader) (io.Reader, error) {
+	if t.reverse == nil {
+		return input, nil
+	}
+	return t.run(t.reverse, input)
+}
+
+func (t *WASMTransformer) run(args []string, input io.Reader) (io.Reader, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), t.limits.timeout())
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	out := &limitedBuffer{buf: &stdout, limit: t.limits.MaxOutput}
+	mc := wazero.NewModuleConfig().
+		WithName("").
+		WithArgs(append([]string{t.module.Name()}, args...)...).
+		WithStdin(input).
+		WithStdout(out).
+		WithStderr(&limitedBuffer{buf: &stderr, limit: 4096})
+
+	mod, err := t.runtime.InstantiateModule(ctx, t.module, mc)
+	if mod != nil {
+		defer mod.Close(ctx)
+	}
+
+	var exitErr *sys.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 0 {
+		err = nil
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("wasm module timed out after %s", t.limits.timeout())
+	}
+	if out.exceeded {
+		return nil, ErrOutputTooLarge
+	}
+	if err != nil {
+		return nil, fmt.Errorf("wasm module failed: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return &stdout, nil
+}
+
+// Close releases the runtime and compiled module.
+func (t *WASMTransformer) Close() error {
+	return t.runtime.Close(context.Background())
+}
@@ -0,0 +1,66 @@
+package transforms
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/ulikunitz/xz"
+)
+
+// xzDictCaps maps levels (0-9) to LZMA2 dictionary sizes, taken from the
+// presets of the xz command line tool. Only the dictionary size is set: the
+// encoder has no other tuning, so a level is not equivalent to its xz preset,
+// and levels only differ for pastes larger than 1 MiB.
+var xzDictCaps = [...]int{
+	256 << 10, 1 << 20, 2 << 20, 4 << 20, 4 << 20,
+	8 << 20, 8 << 20, 16 << 20, 32 << 20, 64 << 20,
+}
+
+// XZTransformer compresses and decompresses data using xz (LZMA2).
+type XZTransformer struct {
+	// Level (0-9) selects the dictionary size. Zero selects the package
+	// default of 8 MiB.
+	Level int
+}
+
+// NewXZTransformer creates a new XZTransformer with the given level.
+func NewXZTransformer(level int) (*XZTransformer, error) {
+	if level < 0 || level >= len(xzDictCaps) {
+		return nil, fmt.Errorf("invalid xz level %d: must be between 0 and 9", level)
+	}
+	return &XZTransformer{Level: level}, nil
+}
+
+func (t *XZTransformer) Transform(input io.Reader) (io.Reader, error) {
+	cfg := xz.WriterConfig{}
+	if t.Level > 0 && t.Level < len(xzDictCaps) {
+		cfg.DictCap = xzDictCaps[t.Level]
+	}
+
+	var buf bytes.Buffer
+	xw, err := cfg.NewWriter(&buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(xw, input); err != nil {
+		return nil, err
+	}
+	if err := xw.Close(); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+func (t *XZTransformer) ReverseTransform(input io.Reader) (io.Reader, error) {
+	xr, err := xz.NewReader(input)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, xr); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
@@ -0,0 +1,68 @@
+package transforms
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ZstdTransformer compresses and decompresses data using Zstandard.
+//
+// An optional dictionary can be supplied to improve the ratio on small pastes.
+// The same dictionary must be available when reading pastes back.
+type ZstdTransformer struct {
+	level zstd.EncoderLevel
+	dict  []byte
+}
+
+// NewZstdTransformer creates a new ZstdTransformer.
+// level follows the zstd command line scale (1-22); zero selects the default level.
+// dict may be nil.
+func NewZstdTransformer(level int, dict []byte) *ZstdTransformer {
+	l := zstd.SpeedDefault
+	if level != 0 {
+		l = zstd.EncoderLevelFromZstd(level)
+	}
+	return &ZstdTransformer{level: l, dict: dict}
+}
+
+func (t *ZstdTransformer) Transform(input io.Reader) (io.Reader, error) {
+	opts := []zstd.EOption{zstd.WithEncoderLevel(t.level)}
+	if len(t.dict) > 0 {
+		opts = append(opts, zstd.WithEncoderDict(t.dict))
+	}
+
+	var buf bytes.Buffer
+	enc, err := zstd.NewWriter(&buf, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(enc, input); err != nil {
+		enc.Close()
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+func (t *ZstdTransformer) ReverseTransform(input io.Reader) (io.Reader, error) {
+	var opts []zstd.DOption
+	if len(t.dict) > 0 {
+		opts = append(opts, zstd.WithDecoderDicts(t.dict))
+	}
+
+	dec, err := zstd.NewReader(input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Close()
+
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, dec); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
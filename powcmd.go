@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/cbrnrd/pasted/pkg/pow"
+	"github.com/urfave/cli/v3"
+)
+
+var powCommand = &cli.Command{
+	Name:      "pow",
+	Usage:     "Solve a proof of work challenge and print the proof for the X-Proof-Of-Work header",
+	ArgsUsage: "CHALLENGE",
+	Action: func(ctx context.Context, c *cli.Command) error {
+		token := c.Args().First()
+		if token == "" {
+			return fmt.Errorf("the challenge is required")
+		}
+		solution, err := pow.Solve(token)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s:%s\n", token, solution)
+		return nil
+	},
+}
+
+// challengeWait is how long anonymous clients wait for a proof of work
+// challenge from paste listeners, which only send one if they require it.
+const challengeWait = 2 * time.Second
+
+// answerChallenge solves the proof of work challenge a paste listener sends
+// to anonymous clients, if it sends one. It returns the reader for the rest
+// of the listener's replies.
+func answerChallenge(conn net.Conn) (io.Reader, error) {
+	r := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(challengeWait))
+	line, err := r.ReadString('\n')
+	conn.SetReadDeadline(time.Time{})
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) != 3 || fields[0]+" " != powLinePrefix {
+		return nil, fmt.Errorf("unexpected reply %q", strings.TrimSpace(line))
+	}
+	solution, err := pow.Solve(fields[2])
+	if err != nil {
+		return nil, err
+	}
+	_, err = fmt.Fprintf(conn, "%s%s\n", powLinePrefix, solution)
+	return r, err
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// realIP returns middleware that replaces the remote address of requests
+// from trusted proxies with the client address they pass on in
+// X-Forwarded-For or X-Real-IP. Requests from anywhere else keep their own
+// address, so that clients cannot choose theirs.
+func realIP(proxies []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if peer, ok := remoteAddr(r); ok && trusted(proxies, peer) {
+				if client, ok := forwardedFor(r, proxies); ok {
+					r.RemoteAddr = client.String()
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// remoteAddr returns the address of the peer that sent r.
+func remoteAddr(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	return addr.Unmap(), err == nil
+}
+
+// forwardedFor returns the client address a trusted proxy passed on. Each
+// proxy appends the address it received the request from to
+// X-Forwarded-For, so the client is the last address that is not a trusted
+// proxy; anything before it could have been sent by the client.
+func forwardedFor(r *http.Request, proxies []netip.Prefix) (netip.Addr, bool) {
+	var hops []string
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+	var client netip.Addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = addr.Unmap()
+		if !trusted(proxies, client) {
+			break
+		}
+	}
+	if client.IsValid() {
+		return client, true
+	}
+
+	addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP")))
+	return addr.Unmap(), err == nil
+}
+
+// trusted reports whether addr is one of the trusted proxies.
+func trusted(proxies []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range proxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/cbrnrd/pasted/pkg/backends"
+	"github.com/cbrnrd/pasted/pkg/metrics"
+	"github.com/cbrnrd/pasted/pkg/quota"
+)
+
+// reapInterval is how often expired pastes are deleted in the background.
+// It must stay well below the time Redis keeps expired pastes, so that they
+// are released from quotas before Redis removes them.
+const reapInterval = 10 * time.Minute
+
+// reapExpired deletes expired pastes every reapInterval, starting at once.
+// Pastes are also deleted when they are requested after expiring, but those
+// that never are would otherwise take up space and count against quotas
+// forever.
+func reapExpired(backend backends.Backend, quotas *quota.Tracker) {
+	for {
+		if err := reapOnce(backend, quotas, time.Now()); err != nil {
+			log.Printf("could not delete expired pastes: %v", err)
+		}
+		time.Sleep(reapInterval)
+	}
+}
+
+// reapOnce deletes the pastes that expired before now and stops counting
+// them against quotas.
+func reapOnce(backend backends.Backend, quotas *quota.Tracker, now time.Time) error {
+	pastes, err := backend.List(backends.Filter{All: true})
+	if err != nil {
+		return err
+	}
+	for key, meta := range pastes {
+		if !meta.Expired(now) {
+			continue
+		}
+		// A paste requested at the same time may already have been deleted
+		// and released; only the deletion that succeeds releases it.
+		switch err := backend.Delete(key); {
+		case errors.Is(err, backends.ErrNotFound):
+		case err != nil:
+			log.Printf("could not delete expired paste %s: %v", key, err)
+		default:
+			releasePaste(quotas, meta)
+			metrics.PastesExpired.Add(1)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cbrnrd/pasted/pkg/backends"
+	"github.com/cbrnrd/pasted/pkg/quota"
+)
+
+func TestReapOnce(t *testing.T) {
+	backend := backends.NewMemoryBackend()
+	quotas := quota.NewTracker(quota.Limits{PerIP: quota.Limit{Pastes: 2}})
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+
+	put := func(content string, expires *time.Time) string {
+		t.Helper()
+		size := int64(len(content))
+		if err := quotas.Reserve("", "192.0.2.1", size); err != nil {
+			t.Fatal(err)
+		}
+		key, err := backend.Put(strings.NewReader(content), &backends.Metadata{SourceIP: "192.0.2.1", Size: &size, ExpiresAt: expires})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	expired := put("expired", &past)
+	live := put("live", &future)
+	if err := quotas.Check("", "192.0.2.1"); err == nil {
+		t.Fatal("quota not exceeded before reaping")
+	}
+
+	if err := reapOnce(backend, quotas, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.Stat(expired); err != backends.ErrNotFound {
+		t.Errorf("expired paste: Stat() error = %v, want %v", err, backends.ErrNotFound)
+	}
+	if _, err := backend.Stat(live); err != nil {
+		t.Errorf("live paste: Stat() error = %v", err)
+	}
+	usage := quotas.Report().IPs["192.0.2.1"]
+	if usage != (quota.Usage{Bytes: int64(len("live")), Pastes: 1}) {
+		t.Errorf("usage after reaping = %+v", usage)
+	}
+	if err := quotas.Check("", "192.0.2.1"); err != nil {
+		t.Errorf("quota still exceeded after reaping: %v", err)
+	}
+
+	// A second pass finds nothing more to release.
+	if err := reapOnce(backend, quotas, now); err != nil {
+		t.Fatal(err)
+	}
+	if usage := quotas.Report().IPs["192.0.2.1"]; usage.Pastes != 1 {
+		t.Errorf("usage after second pass = %+v", usage)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cbrnrd/pasted/pkg/asciicast"
+	"github.com/creack/pty"
+	"github.com/urfave/cli/v3"
+	"golang.org/x/term"
+)
+
+var recordCommand = &cli.Command{
+	Name:  "record",
+	Usage: "Record a terminal session and stream it to a paste listener",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "addr",
+			Usage:    "Address of the paste listener",
+			Sources:  cli.EnvVars("PASTED_ADDR"),
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:    "command",
+			Aliases: []string{"c"},
+			Usage:   "Command to record instead of an interactive shell",
+		},
+		&cli.StringFlag{
+			Name:  "title",
+			Usage: "Title of the recording",
+		},
+		&cli.FloatFlag{
+			Name:  "idle-time-limit",
+			Usage: "Limit pauses to this many seconds during playback",
+		},
+		&cli.StringFlag{
+			Name:    "token",
+			Usage:   "API key to authenticate the upload with",
+			Sources: cli.EnvVars("PASTED_TOKEN"),
+		},
+	},
+	Action: recordSession,
+}
+
+// recordSession runs a shell in a pseudo-terminal and streams its output to
+// the paste listener as an asciicast v2 recording. The recording is uploaded
+// as it happens, and the paste URL is printed when the shell exits.
+func recordSession(ctx context.Context, c *cli.Command) error {
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	cmd := exec.Command(shell)
+	if command := c.String("command"); command != "" {
+		cmd = exec.Command(shell, "-c", command)
+	}
+
+	stdin := int(os.Stdin.Fd())
+	interactive := term.IsTerminal(stdin)
+	cols, rows := 80, 24
+	if interactive {
+		if w, h, err := term.GetSize(stdin); err == nil {
+			cols, rows = w, h
+		}
+	}
+
+	conn, err := net.Dial("tcp", c.String("addr"))
+	if err != nil {
+		return fmt.Errorf("could not connect to paste listener: %v", err)
+	}
+	defer conn.Close()
+
+	var replies io.Reader = conn
+	if token := c.String("token"); token != "" {
+		if _, err := fmt.Fprintf(conn, "AUTH %s\n", token); err != nil {
+			return fmt.Errorf("could not send API key: %v", err)
+		}
+	} else if replies, err = answerChallenge(conn); err != nil {
+		return fmt.Errorf("could not answer the proof of work challenge: %v", err)
+	}
+
+	rec, err := asciicast.NewWriter(conn, asciicast.Header{
+		Width:         cols,
+		Height:        rows,
+		Timestamp:     time.Now().Unix(),
+		Title:         c.String("title"),
+		IdleTimeLimit: c.Float("idle-time-limit"),
+		Env:           map[string]string{"SHELL": shell, "TERM": os.Getenv("TERM")},
+	})
+	if err != nil {
+		return fmt.Errorf("could not start recording: %v", err)
+	}
+
+	ptmx, err := pty.StartWithSize(cmd, &pty.Winsize{Cols: uint16(cols), Rows: uint16(rows)})
+	if err != nil {
+		return fmt.Errorf("could not start %s: %v", shell, err)
+	}
+	defer ptmx.Close()
+
+	restore := func() {}
+	if interactive {
+		state, err := term.MakeRaw(stdin)
+		if err != nil {
+			return fmt.Errorf("could not set terminal to raw mode: %v", err)
+		}
+		restore = func() { term.Restore(stdin, state) }
+		defer restore()
+	}
+
+	start := time.Now()
+	var mu sync.Mutex
+	var recErr error
+	record := func(typ, data string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if recErr == nil {
+			recErr = rec.WriteEvent(asciicast.Event{Time: time.Since(start).Seconds(), Type: typ, Data: data})
+		}
+	}
+
+	stopResize := sync.OnceFunc(watchResize(func() {
+		w, h, err := term.GetSize(stdin)
+		if err != nil {
+			return
+		}
+		pty.Setsize(ptmx, &pty.Winsize{Cols: uint16(w), Rows: uint16(h)})
+		record(asciicast.EventResize, fmt.Sprintf("%dx%d", w, h))
+	}))
+	defer stopResize()
+
+	go io.Copy(ptmx, os.Stdin)
+
+	// Events must be valid UTF-8, so a sequence split across reads is held back.
+	buf := make([]byte, 32*1024)
+	var pending []byte
+	for {
+		n, err := ptmx.Read(buf)
+		if n > 0 {
+			os.Stdout.Write(buf[:n])
+			pending = append(pending, buf[:n]...)
+			valid := len(pending)
+			for i := 1; i < utf8.UTFMax && i <= len(pending); i++ {
+				if utf8.RuneStart(pending[len(pending)-i]) {
+					if !utf8.FullRune(pending[len(pending)-i:]) {
+						valid = len(pending) - i
+					}
+					break
+				}
+			}
+			if valid > 0 {
+				record(asciicast.EventOutput, string(pending[:valid]))
+			}
+			pending = append(pending[:0], pending[valid:]...)
+		}
+		if err != nil {
+			// Linux returns EIO once the shell exits and the pty is closed.
+			break
+		}
+	}
+	cmd.Wait()
+	stopResize()
+	restore()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if recErr != nil {
+		return fmt.Errorf("recording was not uploaded: %v", recErr)
+	}
+
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.CloseWrite()
+	}
+	resp, err := io.ReadAll(replies)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("could not read response: %v", err)
+	}
+	fmt.Printf("\r\n%s\r\n", resp)
+	return nil
+}
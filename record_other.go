@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// watchResize is only supported on Unix; recordings keep their initial size.
+func watchResize(fn func()) func() {
+	return func() {}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cbrnrd/pasted/pkg/backends"
+	"github.com/cbrnrd/pasted/pkg/metrics"
+	"github.com/cbrnrd/pasted/pkg/moderation"
+	"github.com/cbrnrd/pasted/pkg/render"
+	"github.com/go-chi/chi/v5"
+)
+
+// errNoReason is returned for a report without a reason.
+var errNoReason = errors.New("a reason is required")
+
+// reportablePaste returns the metadata of the paste at key if it can be
+// reported: it exists, has not expired and has not been hidden already.
+func (s *webServer) reportablePaste(key string) (*backends.Metadata, error) {
+	meta, err := s.statPaste(key)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Hidden {
+		return nil, errHidden
+	}
+	return meta, nil
+}
+
+// reportPaste records a report about the paste at key from the client of r.
+func (s *webServer) reportPaste(r *http.Request, key, reason string) (*moderation.Report, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, errNoReason
+	}
+	report := moderation.Report{Key: key, Reason: reason, ReporterIP: clientIP(r)}
+	if apiKey := requestKey(r); apiKey != nil {
+		report.Reporter = apiKey.OwnerName()
+	}
+	stored, err := s.mod.AddReport(report)
+	if err != nil {
+		return nil, err
+	}
+	metrics.AbuseReports.Add(1)
+	return stored, nil
+}
+
+// handleReportForm serves the form for reporting a paste.
+func (s *webServer) handleReportForm(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "key")
+	meta, err := s.reportablePaste(key)
+	if err == nil && meta.Namespace != chi.URLParam(r, "namespace") {
+		err = backends.ErrNotFound
+	}
+	if err != nil {
+		writeLoadError(w, key, err)
+		return
+	}
+	writeReportForm(w, r, http.StatusOK, &render.ReportForm{})
+}
+
+// handleReport records a report posted from the report form.
+func (s *webServer) handleReport(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUnlockFormBytes)
+	key := chi.URLParam(r, "key")
+	meta, err := s.reportablePaste(key)
+	if err == nil && meta.Namespace != chi.URLParam(r, "namespace") {
+		err = backends.ErrNotFound
+	}
+	if err != nil {
+		writeLoadError(w, key, err)
+		return
+	}
+
+	form := &render.ReportForm{Reason: r.PostFormValue("reason")}
+	switch _, err := s.reportPaste(r, key, form.Reason); {
+	case errors.Is(err, errNoReason):
+		form.Error = "Please say what is wrong with the paste"
+		writeReportForm(w, r, http.StatusBadRequest, form)
+	case errors.Is(err, moderation.ErrTooManyReports):
+		form.Error = "This paste has already been reported many times and is waiting for a moderator"
+		writeReportForm(w, r, http.StatusTooManyRequests, form)
+	case err != nil:
+		form.Error = "Could not record the report"
+		writeReportForm(w, r, http.StatusInternalServerError, form)
+	default:
+		writeReportForm(w, r, http.StatusCreated, &render.ReportForm{Done: true})
+	}
+}
+
+// writeReportForm writes the report form for the paste named by the route.
+func writeReportForm(w http.ResponseWriter, r *http.Request, status int, form *render.ReportForm) {
+	form.Key = chi.URLParam(r, "key")
+	form.Action = r.URL.Path
+	form.MaxLength = moderation.MaxReasonLength
+	writeHTML(w, status, func(w io.Writer) error {
+		return render.WriteReportForm(w, form)
+	})
+}
+
+// apiReportRequest is the JSON body of a report request.
+type apiReportRequest struct {
+	Reason string `json:"reason"`
+}
+
+// apiReport is the JSON representation of a report, as returned to the reporter.
+type apiReport struct {
+	ID        string    `json:"id"`
+	PasteID   string    `json:"paste_id"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// handleAPIReport reports a paste to the moderators.
+func (s *webServer) handleAPIReport(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "id")
+	if _, err := s.reportablePaste(key); err != nil {
+		writeAPILoadError(w, key, err)
+		return
+	}
+
+	var req apiReportRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxUnlockFormBytes)).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body: "+err.Error())
+		return
+	}
+	report, err := s.reportPaste(r, key, req.Reason)
+	switch {
+	case errors.Is(err, errNoReason):
+		writeAPIError(w, http.StatusBadRequest, "invalid_request", "reason is required")
+		return
+	case errors.Is(err, moderation.ErrTooManyReports):
+		writeAPIError(w, http.StatusTooManyRequests, "rate_limited", "The paste has too many open reports")
+		return
+	case err != nil:
+		writeAPIError(w, http.StatusInternalServerError, "backend_error", "Could not record the report")
+		return
+	}
+	writeJSON(w, http.StatusCreated, &apiReport{
+		ID:        report.ID,
+		PasteID:   report.Key,
+		Reason:    report.Reason,
+		CreatedAt: report.CreatedAt,
+	})
+}
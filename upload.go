@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cbrnrd/pasted/pkg/auth"
+	"github.com/cbrnrd/pasted/pkg/backends"
+	"github.com/cbrnrd/pasted/pkg/config"
+	"github.com/cbrnrd/pasted/pkg/content"
+	"github.com/cbrnrd/pasted/pkg/media"
+	"github.com/cbrnrd/pasted/pkg/metrics"
+	"github.com/cbrnrd/pasted/pkg/moderation"
+	"github.com/cbrnrd/pasted/pkg/pow"
+	"github.com/cbrnrd/pasted/pkg/quota"
+	"github.com/cbrnrd/pasted/pkg/transforms"
+	"github.com/cbrnrd/pasted/pkg/util"
+)
+
+// contentTypeError is returned by storePaste for pastes whose type is not allowed.
+type contentTypeError struct {
+	contentType string
+}
+
+func (e *contentTypeError) Error() string {
+	return "content type " + e.contentType + " is not allowed"
+}
+
+// errStoreTransform wraps errors from running the transform chain on a new paste.
+var errStoreTransform = errors.New("could not transform paste")
+
+// errImageMetadata is returned by storePaste for images whose metadata could
+// not be removed. They are rejected rather than stored with it.
+var errImageMetadata = errors.New("could not remove metadata from the image")
+
+// Errors returned by authorizeUpload.
+var (
+	errKeyRequired      = errors.New("an API key is required")
+	errKeyScope         = errors.New("the API key does not allow uploads")
+	errNoNamespace      = errors.New("no such namespace")
+	errNamespaceMembers = errors.New("only members can create pastes in the namespace")
+	errBanned           = errors.New("uploads from this client are banned")
+	errCertNotListed    = errors.New("the client certificate is not listed in an API key")
+)
+
+// authorizeUpload checks that a client with key, which is nil for anonymous
+// clients, uploading from ip may create a paste in namespace, which is empty
+// for the default keyspace, and counts the paste against the key's quota.
+func authorizeUpload(cfg *config.CLIConfig, keys *auth.Store, mod *moderation.Store, key *auth.Key, ip, namespace string) error {
+	var keyID string
+	if key != nil {
+		keyID = key.ID
+	}
+	if mod.Banned(keyID, ip) != nil {
+		return errBanned
+	}
+
+	if namespace != "" {
+		ns := cfg.Namespace(namespace)
+		switch {
+		case ns == nil:
+			return errNoNamespace
+		case key == nil:
+			return errKeyRequired
+		case !ns.IsMember(key):
+			return errNamespaceMembers
+		}
+	}
+
+	switch {
+	case key == nil && cfg.Auth.Requires(auth.ScopeWrite):
+		return errKeyRequired
+	case key == nil:
+		return nil
+	case !key.Has(auth.ScopeWrite):
+		return errKeyScope
+	default:
+		return keys.Allow(key)
+	}
+}
+
+// checkProofOfWork checks the proof of work of an anonymous client, which
+// sent proof as the challenge token, a colon and the solution. Clients with
+// a key need none, and none are needed if work is nil.
+func checkProofOfWork(work *pow.Verifier, key *auth.Key, proof string) error {
+	if work == nil || key != nil {
+		return nil
+	}
+	token, solution, _ := strings.Cut(strings.TrimSpace(proof), ":")
+	return work.Verify(token, solution)
+}
+
+// countUploadRejection counts an upload refused by authorizeUpload or
+// checkProofOfWork.
+func countUploadRejection(err error) {
+	if errors.Is(err, auth.ErrQuotaExceeded) || errors.Is(err, errBanned) ||
+		errors.Is(err, pow.ErrRequired) || errors.Is(err, pow.ErrInvalid) {
+		metrics.PastesRejected.Add(1)
+	} else {
+		metrics.AuthFailures.Add(1)
+	}
+}
+
+// storePaste detects the type of the paste read from r, runs it through chain
+// and stores it with meta, which is filled in with the detected type, flags,
+// the default expiry, the stored size and the owner of apiKey, if the client
+// authenticated. meta.SourceIP must be set by the caller. The paste is
+// counted against quotas. It returns the new key.
+//
+// Pastes are rejected with a *contentTypeError, errImageMetadata, a
+// transforms.SecretsError or a *quota.ExceededError. Errors from the chain
+// are wrapped in errStoreTransform; other errors come from the backend.
+func storePaste(r io.Reader, cfg *config.CLIConfig, backend backends.Backend, chain *transforms.ChainTransformer, quotas *quota.Tracker, apiKey *auth.Key, meta *backends.Metadata) (string, error) {
+	if apiKey != nil {
+		meta.Owner = apiKey.OwnerName()
+		meta.KeyID = apiKey.ID
+		if max := apiKey.Quota.MaxPasteBytes; max > 0 {
+			r = &maxBytesReader{r: r, n: max}
+		}
+	}
+
+	// Reject clients that are already at a quota before reading the paste.
+	if err := quotas.Check(meta.Owner, meta.SourceIP); err != nil {
+		metrics.QuotaRejections.Add(1)
+		return "", err
+	}
+
+	// Peek at the start of the paste so its type can be recorded before it is transformed.
+	input := bufio.NewReaderSize(r, content.SampleSize)
+	sample, _ := input.Peek(content.SampleSize)
+	meta.ContentType = content.Detect(sample)
+
+	if !cfg.ContentTypes.Allowed(meta.ContentType) {
+		metrics.PastesRejected.Add(1)
+		return "", &contentTypeError{meta.ContentType}
+	}
+
+	if meta.ExpiresAt == nil {
+		lifetime, _ := cfg.ExpiryFor(meta.Namespace).Lifetime(0)
+		if lifetime > 0 {
+			expires := time.Now().UTC().Add(lifetime)
+			meta.ExpiresAt = &expires
+		}
+	}
+
+	var body io.Reader = input
+	var tooLarge *http.MaxBytesError
+	if !cfg.Images.KeepMetadata && media.CanStrip(meta.ContentType) {
+		stripped, err := stripImageMetadata(input, meta.ContentType, cfg.SizeLimitBytes)
+		switch {
+		case errors.Is(err, errImageMetadata) || errors.Is(err, backends.ErrFileTooLarge) || errors.As(err, &tooLarge):
+			metrics.PastesRejected.Add(1)
+			return "", err
+		case err != nil:
+			metrics.TransformErrors.Add(1)
+			return "", fmt.Errorf("%w: %w", errStoreTransform, err)
+		}
+		body = stripped
+	}
+
+	transformed, flags, err := chain.TransformFlags(body)
+	if errors.Is(err, transforms.ErrSecretDetected) || errors.Is(err, backends.ErrFileTooLarge) {
+		metrics.PastesRejected.Add(1)
+		return "", err
+	}
+	if err != nil {
+		metrics.TransformErrors.Add(1)
+		return "", fmt.Errorf("%w: %w", errStoreTransform, err)
+	}
+	meta.Flags = append(meta.Flags, flags...)
+
+	stored, err := readStored(transformed, cfg.SizeLimitBytes, quotas.Remaining(meta.Owner, meta.SourceIP))
+	switch {
+	case errors.Is(err, transforms.ErrSecretDetected) || errors.Is(err, backends.ErrFileTooLarge) || errors.As(err, &tooLarge):
+		metrics.PastesRejected.Add(1)
+		return "", err
+	case err != nil:
+		metrics.TransformErrors.Add(1)
+		return "", fmt.Errorf("%w: %w", errStoreTransform, err)
+	}
+	size := int64(len(stored))
+	meta.Size = &size
+	if err := quotas.Reserve(meta.Owner, meta.SourceIP, size); err != nil {
+		metrics.QuotaRejections.Add(1)
+		return "", err
+	}
+
+	key, err := backend.Put(bytes.NewReader(stored), meta)
+	if err != nil {
+		quotas.Release(meta.Owner, meta.SourceIP, size)
+		metrics.BackendErrors.Add(1)
+		return "", err
+	}
+	metrics.PastesCreated.Add(1)
+	return key, nil
+}
+
+// readStored reads a transformed paste into memory, so that its size is
+// known before it is counted against quotas. Pastes over sizeLimit fail with
+// backends.ErrFileTooLarge. If remaining is not negative, at most one byte
+// more than it is read, which is enough for quota.Tracker.Reserve to reject
+// the paste.
+func readStored(r io.Reader, sizeLimit, remaining int64) ([]byte, error) {
+	if sizeLimit > 0 {
+		r = &maxBytesReader{r: r, n: sizeLimit}
+	}
+	if remaining >= 0 {
+		r = io.LimitReader(r, remaining+1)
+	}
+	return io.ReadAll(r)
+}
+
+// releasePaste stops counting a deleted paste against quotas. Pastes stored
+// before quotas were tracked were never counted.
+func releasePaste(quotas *quota.Tracker, meta *backends.Metadata) {
+	if meta.Size != nil {
+		quotas.Release(meta.Owner, meta.SourceIP, *meta.Size)
+	}
+}
+
+// countStored counts the pastes already in backend against quotas, so that
+// usage carries over restarts and includes pastes stored by other servers
+// sharing the backend. Like releasePaste, it skips pastes without a size.
+func countStored(backend backends.Backend, quotas *quota.Tracker) error {
+	pastes, err := backend.List(backends.Filter{All: true})
+	if err != nil {
+		return err
+	}
+	for _, meta := range pastes {
+		if meta.Size != nil {
+			quotas.Count(meta.Owner, meta.SourceIP, *meta.Size)
+		}
+	}
+	return nil
+}
+
+// clientIP returns the address of the client of r, as set by realIP or the
+// server.
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// maxBytesReader fails with backends.ErrFileTooLarge once more than n bytes
+// have been read.
+type maxBytesReader struct {
+	r io.Reader
+	n int64
+}
+
+func (m *maxBytesReader) Read(p []byte) (int, error) {
+	if m.n < 0 {
+		return 0, backends.ErrFileTooLarge
+	}
+	if int64(len(p)) > m.n+1 {
+		p = p[:m.n+1]
+	}
+	n, err := m.r.Read(p)
+	m.n -= int64(n)
+	if m.n < 0 {
+		return n, backends.ErrFileTooLarge
+	}
+	return n, err
+}
+
+// storeErrorStatus maps an error from storePaste to an HTTP status, an API
+// error code and a message for the client.
+func storeErrorStatus(err error) (status int, code, message string) {
+	var typeErr *contentTypeError
+	var tooLarge *http.MaxBytesError
+	var exceeded *quota.ExceededError
+	switch {
+	case errors.As(err, &typeErr):
+		return http.StatusUnsupportedMediaType, "unsupported_content_type", err.Error()
+	case errors.Is(err, transforms.ErrSecretDetected):
+		return http.StatusUnprocessableEntity, "secret_detected", err.Error()
+	case errors.Is(err, errImageMetadata):
+		return http.StatusUnprocessableEntity, "invalid_image", "The image's metadata could not be removed, so it was not stored"
+	case errors.Is(err, errKeyRequired):
+		return http.StatusUnauthorized, "unauthorized", "An API key is required"
+	case errors.Is(err, errKeyScope):
+		return http.StatusForbidden, "forbidden", "The API key does not allow uploads"
+	case errors.Is(err, errNoNamespace):
+		return http.StatusBadRequest, "invalid_request", "No such namespace"
+	case errors.Is(err, errBanned):
+		return http.StatusForbidden, "banned", "Uploads from this client are banned"
+	case errors.Is(err, pow.ErrRequired):
+		return http.StatusForbidden, "proof_of_work_required", "A proof of work is required; get a challenge from " + apiPrefix + "/pow"
+	case errors.Is(err, pow.ErrInvalid):
+		return http.StatusForbidden, "proof_of_work_required", "Invalid proof of work" + strings.TrimPrefix(err.Error(), pow.ErrInvalid.Error())
+	case errors.Is(err, errNamespaceMembers):
+		return http.StatusForbidden, "forbidden", "Only members can create pastes in the namespace"
+	case errors.Is(err, auth.ErrQuotaExceeded):
+		return http.StatusTooManyRequests, "quota_exceeded", "The API key's quota is used up; try again later"
+	case errors.As(err, &exceeded):
+		return http.StatusInsufficientStorage, "storage_quota_exceeded", "Storage quota exceeded: " + exceeded.Reason()
+	case errors.Is(err, backends.ErrFileTooLarge), errors.As(err, &tooLarge):
+		return http.StatusRequestEntityTooLarge, "too_large", "Paste is too large"
+	case errors.Is(err, errStoreTransform):
+		log.Printf("could not store paste: %v", err)
+		return http.StatusInternalServerError, "transform_error", "Error storing paste"
+	default:
+		log.Printf("could not store paste: %v", err)
+		return http.StatusInternalServerError, "backend_error", "Error storing paste"
+	}
+}
+
+// expiryTime returns the expiry of a paste in namespace that asked to be kept
+// for expiresIn, given as a Go duration or a number of seconds, or nil if it
+// never expires. An empty expiresIn asks for the default.
+func expiryTime(cfg *config.CLIConfig, namespace, expiresIn string) (*time.Time, error) {
+	lifetime, err := parseExpiresIn(expiresIn)
+	if err != nil {
+		return nil, err
+	}
+	if lifetime, err = cfg.ExpiryFor(namespace).Lifetime(lifetime); err != nil || lifetime == 0 {
+		return nil, err
+	}
+	expires := time.Now().UTC().Add(lifetime)
+	return &expires, nil
+}
+
+// parseExpiresIn parses a lifetime given as a Go duration or a number of seconds.
+func parseExpiresIn(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Duration(secs) * time.Second, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// newDeleteToken returns a token that allows a new paste to be deleted, and
+// the hash that is stored in its metadata.
+func newDeleteToken() (token, hash string, err error) {
+	token, err = util.GenerateRandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	return token, auth.HashToken(token), nil
+}
+
+// pasteURL returns the public URL of the paste at key in namespace.
+func pasteURL(cfg *config.CLIConfig, namespace, key string) string {
+	return cfg.Domain + pastePrefix(namespace) + key
+}
+
+// pastePrefix returns the path under which the pastes in namespace are
+// served, which is the root for the default keyspace.
+func pastePrefix(namespace string) string {
+	if namespace == "" {
+		return "/"
+	}
+	return "/" + namespace + "/"
+}
+
+// maxStripBytes bounds the images read into memory for stripping when no size limit is configured.
+const maxStripBytes = 64 << 20
+
+// stripImageMetadata removes metadata from an image paste. Images that
+// cannot be parsed fail with errImageMetadata, and images over the size limit
+// with backends.ErrFileTooLarge, so that no image is stored with its
+// metadata by mistake.
+func stripImageMetadata(r io.Reader, contentType string, limit int64) (io.Reader, error) {
+	if limit <= 0 {
+		limit = maxStripBytes
+	}
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, backends.ErrFileTooLarge
+	}
+
+	stripped, err := media.StripMetadata(contentType, data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errImageMetadata, err)
+	}
+	return bytes.NewReader(stripped), nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cbrnrd/pasted/pkg/backends"
+	"github.com/cbrnrd/pasted/pkg/quota"
+)
+
+func TestCountStored(t *testing.T) {
+	backend := backends.NewMemoryBackend()
+	put := func(content string, meta *backends.Metadata) {
+		t.Helper()
+		if _, err := backend.Put(strings.NewReader(content), meta); err != nil {
+			t.Fatal(err)
+		}
+	}
+	size := func(n int64) *int64 { return &n }
+	put("by ci", &backends.Metadata{Owner: "ci", Size: size(5)})
+	put("by ci again", &backends.Metadata{Owner: "ci", SourceIP: "192.0.2.1", Size: size(11)})
+	put("anonymous", &backends.Metadata{SourceIP: "192.0.2.1", Size: size(9)})
+	put("from an old version", &backends.Metadata{Owner: "ci"})
+
+	quotas := quota.NewTracker(quota.Limits{PerOwner: quota.Limit{Pastes: 2}})
+	if err := countStored(backend, quotas); err != nil {
+		t.Fatal(err)
+	}
+	report := quotas.Report()
+	if want := (quota.Usage{Bytes: 16, Pastes: 2}); report.Owners["ci"] != want {
+		t.Errorf("usage of ci = %+v, want %+v", report.Owners["ci"], want)
+	}
+	if want := (quota.Usage{Bytes: 9, Pastes: 1}); report.IPs["192.0.2.1"] != want {
+		t.Errorf("usage of 192.0.2.1 = %+v, want %+v", report.IPs["192.0.2.1"], want)
+	}
+	if want := (quota.Usage{Bytes: 25, Pastes: 3}); report.Global != want {
+		t.Errorf("global usage = %+v, want %+v", report.Global, want)
+	}
+	if err := quotas.Check("ci", ""); err == nil {
+		t.Error("ci can store more pastes than its quota after a restart")
+	}
+}
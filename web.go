@@ -0,0 +1,737 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cbrnrd/pasted/pkg/asciicast"
+	"github.com/cbrnrd/pasted/pkg/auth"
+	"github.com/cbrnrd/pasted/pkg/backends"
+	"github.com/cbrnrd/pasted/pkg/config"
+	"github.com/cbrnrd/pasted/pkg/content"
+	"github.com/cbrnrd/pasted/pkg/ipfilter"
+	"github.com/cbrnrd/pasted/pkg/media"
+	"github.com/cbrnrd/pasted/pkg/metrics"
+	"github.com/cbrnrd/pasted/pkg/moderation"
+	"github.com/cbrnrd/pasted/pkg/pow"
+	"github.com/cbrnrd/pasted/pkg/quota"
+	"github.com/cbrnrd/pasted/pkg/render"
+	"github.com/cbrnrd/pasted/pkg/transforms"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/httprate"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// validKey matches keys that can be generated by any backend.
+var validKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// rawCSP is the Content-Security-Policy sent with raw paste bodies.
+const rawCSP = "default-src 'none'; img-src 'self'; media-src 'self'; style-src 'unsafe-inline'; sandbox"
+
+// webServer serves pastes over HTTP.
+type webServer struct {
+	backend backends.Backend
+	cfg     *config.CLIConfig
+	chain   *transforms.ChainTransformer
+	keys    *auth.Store
+	quotas  *quota.Tracker
+	mod     *moderation.Store
+	filter  *ipfilter.Filter
+
+	// work is nil unless anonymous uploads need a proof of work.
+	work *pow.Verifier
+
+	// oidc and sessions are nil unless single sign-on is configured.
+	oidc     *auth.OIDC
+	sessions *auth.Sessions
+
+	// burning holds the keys of burn-after-read pastes being claimed.
+	burning sync.Map
+}
+
+func startWebServer(backend backends.Backend, cfg *config.CLIConfig, chain *transforms.ChainTransformer, keys *auth.Store, quotas *quota.Tracker, mod *moderation.Store, filter *ipfilter.Filter, proxies []netip.Prefix, work *pow.Verifier, oidc *auth.OIDC) {
+	s := &webServer{backend: backend, cfg: cfg, chain: chain, keys: keys, quotas: quotas, mod: mod, filter: filter, work: work, oidc: oidc}
+	if oidc != nil {
+		s.sessions = cfg.Auth.OIDC.GetSessions()
+	}
+	http.ListenAndServe(cfg.HttpListenAddr, s.routes(proxies))
+}
+
+// routes returns the router for the web interface and the API. Client
+// addresses are taken from headers set by proxies.
+func (s *webServer) routes(proxies []netip.Prefix) chi.Router {
+	router := chi.NewRouter()
+
+	router.Use(realIP(proxies))
+	router.Use(middleware.RequestID)
+	router.Use(middleware.Logger)
+	router.Use(middleware.Recoverer)
+	router.Use(s.filterIP)
+
+	router.Handle(render.StaticPrefix+"/*", http.StripPrefix(render.StaticPrefix, render.StaticHandler()))
+
+	router.Group(func(router chi.Router) {
+		router.Use(httprate.Limit(10, 1*time.Minute,
+			httprate.WithKeyByIP(),
+			httprate.WithLimitHandler(s.rateLimited(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			})),
+		))
+		router.Use(s.sameOrigin)
+		router.Use(s.authenticate(writeAuthError))
+		router.Use(s.session)
+
+		if s.oidc != nil {
+			s.loginRoutes(router)
+		}
+		router.Get("/", s.handleNew)
+		router.Post("/", s.handleCreate)
+		router.Group(s.moderationRoutes)
+
+		router.Group(func(router chi.Router) {
+			router.Use(s.requireScope(auth.ScopeRead, writeAuthError))
+
+			s.pasteRoutes(router, "")
+			s.pasteRoutes(router, "/{namespace}")
+		})
+	})
+
+	router.Route(apiPrefix, s.apiRoutes)
+	return router
+}
+
+func startMetricsServer(cfg *config.CLIConfig) {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", metrics.Handler())
+	if err := http.ListenAndServe(cfg.MetricsListenAddr, mux); err != nil {
+		log.Printf("metrics server stopped: %v", err)
+	}
+}
+
+// pasteRoutes registers the routes that serve pastes under prefix, which is
+// empty for the default keyspace and "/{namespace}" for namespaces.
+func (s *webServer) pasteRoutes(router chi.Router, prefix string) {
+	router.Get(prefix+"/raw/{key}", s.handleRaw)
+	router.Head(prefix+"/raw/{key}", s.handleRaw)
+	router.Get(prefix+"/thumb/{key}", s.handleThumbnail)
+	router.Get(prefix+"/{key}", s.handleView)
+	router.Head(prefix+"/{key}", s.handleView)
+	router.Post(prefix+"/{key}", s.handleUnlock)
+	router.Get(prefix+"/report/{key}", s.handleReportForm)
+	router.Post(prefix+"/report/{key}", s.handleReport)
+}
+
+// keyContextKey is the request context key for the authenticated API key.
+type keyContextKey struct{}
+
+// requestKey returns the API key the request was authenticated with, or nil.
+func requestKey(r *http.Request) *auth.Key {
+	key, _ := r.Context().Value(keyContextKey{}).(*auth.Key)
+	return key
+}
+
+// authenticate returns middleware that identifies clients by an API key sent
+// as a bearer token. Requests without one continue anonymously; requests with
+// an invalid one are refused with fail.
+func (s *webServer) authenticate(fail func(w http.ResponseWriter, status int, message string)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key, err := s.keys.Authenticate(strings.TrimSpace(token))
+			if err != nil {
+				metrics.AuthFailures.Add(1)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="pasted"`)
+				fail(w, http.StatusUnauthorized, "Invalid API key")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), keyContextKey{}, key)))
+		})
+	}
+}
+
+// sameOrigin is middleware that refuses form posts and other unsafe requests
+// sent from pages of another origin. SameSite cookies do not stop sibling
+// subdomains or older browsers from posting with a user's session.
+func (s *webServer) sameOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if !s.fromSameOrigin(r) {
+				http.Error(w, "Cross-origin requests are not allowed", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// fromSameOrigin reports whether r was sent from a page of this server, by
+// Sec-Fetch-Site, or else by Origin or Referer compared with the configured
+// domain. Requests with none of them do not come from a browser.
+func (s *webServer) fromSameOrigin(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none":
+		return true
+	case "":
+	default:
+		return false
+	}
+
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Header.Get("Referer")
+	}
+	if source == "" {
+		return true
+	}
+	u, err := url.Parse(source)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if domain, err := url.Parse(s.cfg.Domain); err == nil && domain.Host != "" {
+		return u.Scheme == domain.Scheme && u.Host == domain.Host
+	}
+	return u.Host == r.Host
+}
+
+// requireScope returns middleware that refuses requests without a key that
+// allows scope, if the configuration requires one for it.
+func (s *webServer) requireScope(scope auth.Scope, fail func(w http.ResponseWriter, status int, message string)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !s.cfg.Auth.Requires(scope) {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch key := requestKey(r); {
+			case key == nil:
+				metrics.AuthFailures.Add(1)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="pasted"`)
+				fail(w, http.StatusUnauthorized, "An API key is required")
+			case !key.Has(scope):
+				metrics.AuthFailures.Add(1)
+				fail(w, http.StatusForbidden, fmt.Sprintf("The API key does not allow %s access", scope))
+			default:
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// writeAuthError reports an authentication failure on a page route.
+func writeAuthError(w http.ResponseWriter, status int, message string) {
+	http.Error(w, message, status)
+}
+
+// handleRaw serves the paste bytes.
+func (s *webServer) handleRaw(w http.ResponseWriter, r *http.Request) {
+	key, _ := splitKey(chi.URLParam(r, "key"))
+
+	body, meta, err := s.loadRoutePaste(r, key)
+	if err != nil {
+		writeLoadError(w, key, err)
+		return
+	}
+
+	if !authorize(w, r, meta) {
+		return
+	}
+	if err := s.claim(r, key, meta); err != nil {
+		writeLoadError(w, key, err)
+		return
+	}
+
+	s.writeRaw(w, r, key, body, meta)
+	metrics.PastesServed.Add(1)
+}
+
+// handleThumbnail serves a PNG thumbnail of an image paste.
+func (s *webServer) handleThumbnail(w http.ResponseWriter, r *http.Request) {
+	key, _ := splitKey(chi.URLParam(r, "key"))
+
+	body, meta, err := s.loadRoutePaste(r, key)
+	if err != nil {
+		writeLoadError(w, key, err)
+		return
+	}
+	if s.chain.StoreOnly() || meta.Protected() || !isImage(s.contentType(body, meta)) {
+		http.Error(w, "No preview available", http.StatusNotFound)
+		return
+	}
+
+	thumb, err := media.Thumbnail(body, s.cfg.Images.GetThumbnailSize())
+	if err != nil {
+		log.Printf("could not create thumbnail for paste %s: %v", key, err)
+		http.Error(w, "No preview available", http.StatusNotFound)
+		return
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "image/png")
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Content-Security-Policy", rawCSP)
+	serveContent(w, r, thumb, meta, cacheImmutable)
+}
+
+// handleView serves an HTML page for browsers and the raw paste to everything else.
+// An extension in the key (e.g. /abcde.go) selects the highlighting language.
+func (s *webServer) handleView(w http.ResponseWriter, r *http.Request) {
+	key, ext := splitKey(chi.URLParam(r, "key"))
+
+	body, meta, err := s.loadRoutePaste(r, key)
+	if err != nil {
+		writeLoadError(w, key, err)
+		return
+	}
+
+	if !wantsHTML(r) || s.chain.StoreOnly() {
+		if !authorize(w, r, meta) {
+			return
+		}
+		if err := s.claim(r, key, meta); err != nil {
+			writeLoadError(w, key, err)
+			return
+		}
+		s.writeTerminal(w, r, key, ext, body, meta)
+		metrics.PastesServed.Add(1)
+		return
+	}
+
+	// Browsers, and link previewers that pretend to be browsers, must ask
+	// before a protected paste is shown.
+	if meta.Protected() {
+		writeUnlockForm(w, r, meta, "", http.StatusOK)
+		return
+	}
+	s.writePage(w, r, key, ext, body, meta)
+}
+
+// writeTerminal writes the paste for clients that do not want an HTML page.
+// They get the final screen of a recording rather than its event log.
+func (s *webServer) writeTerminal(w http.ResponseWriter, r *http.Request, key, ext string, body []byte, meta *backends.Metadata) {
+	if s.isCast(ext, body, meta) {
+		if c, err := asciicast.Decode(bytes.NewReader(body)); err == nil {
+			writeText(w, r, asciicast.FinalFrame(c).String(), meta)
+			return
+		}
+	}
+	s.writeRaw(w, r, key, body, meta)
+}
+
+// handleUnlock shows a protected paste once its password, or the confirmation
+// for a burn-after-read paste, has been posted from the unlock form.
+func (s *webServer) handleUnlock(w http.ResponseWriter, r *http.Request) {
+	key, ext := splitKey(chi.URLParam(r, "key"))
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUnlockFormBytes)
+	body, meta, err := s.loadRoutePaste(r, key)
+	if err != nil {
+		writeLoadError(w, key, err)
+		return
+	}
+	if !meta.Protected() || s.chain.StoreOnly() {
+		http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+		return
+	}
+	if meta.PasswordHash != "" && !passwordMatches(meta, r.PostFormValue("password")) {
+		writeUnlockForm(w, r, meta, "Wrong password", http.StatusForbidden)
+		return
+	}
+	if err := s.claim(r, key, meta); err != nil {
+		writeLoadError(w, key, err)
+		return
+	}
+
+	s.writePage(w, r, key, ext, body, meta)
+}
+
+// maxUnlockFormBytes bounds the body of a posted unlock form.
+const maxUnlockFormBytes = 64 << 10
+
+// writePage renders the paste as an HTML page.
+func (s *webServer) writePage(w http.ResponseWriter, r *http.Request, key, ext string, body []byte, meta *backends.Metadata) {
+	prefix := pastePrefix(meta.Namespace)
+	page := &render.Page{
+		Key:       key,
+		RawURL:    prefix + "raw/" + key,
+		CreatedAt: meta.CreatedAt,
+	}
+	if meta.BurnAfterRead {
+		// The paste is deleted once this page is served, so there is nothing to link to.
+		page.RawURL = ""
+	} else {
+		page.ReportURL = prefix + "report/" + key
+	}
+
+	contentType := s.contentType(body, meta)
+	switch {
+	case isImage(contentType):
+		format, width, height, err := media.Config(body)
+		if err != nil {
+			page.Language, page.Content = contentType, render.Hexdump(body)
+			break
+		}
+		page.Language = fmt.Sprintf("%s image, %d×%d", strings.ToUpper(format), width, height)
+		if meta.Protected() {
+			// Protected images are embedded, as the raw URL needs the password or is gone.
+			src := "data:" + content.Safe(contentType).ContentType + ";base64," + base64.StdEncoding.EncodeToString(body)
+			page.Content = render.Image(src, width, height)
+			break
+		}
+		page.Content = render.Image(page.RawURL, width, height)
+		page.Thumbnail = s.cfg.Domain + prefix + "thumb/" + key
+
+	case !content.IsText(contentType):
+		// Binaries that cannot be previewed are shown as a hexdump; the raw link downloads them.
+		page.Language, page.Content = fmt.Sprintf("%s, %d bytes", contentType, len(body)), render.Hexdump(body)
+
+	default:
+		// Structured formats are rendered if they parse, and highlighted otherwise.
+		if format, ok := render.SelectFormat(ext, meta.Language, contentType); ok {
+			if rendered, err := format.Render(body); err == nil {
+				page.Language, page.Content = format.Name, rendered
+			}
+		}
+		if page.Content == "" {
+			lexer := render.Lexer(ext, meta.Language, body)
+			highlighted, err := render.Highlight(lexer, body)
+			if err != nil {
+				log.Printf("could not highlight paste %s: %v", key, err)
+				s.writeRaw(w, r, key, body, meta)
+				metrics.PastesServed.Add(1)
+				return
+			}
+			page.Language, page.Content = lexer.Config().Name, highlighted
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := render.WritePage(&buf, page); err != nil {
+		log.Printf("could not render paste %s: %v", key, err)
+		http.Error(w, "Error rendering paste", http.StatusInternalServerError)
+		return
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Content-Security-Policy", render.CSP)
+	h.Set("Vary", "Accept")
+	// Pages change with the templates, so they are revalidated rather than cached for good.
+	serveContent(w, r, buf.Bytes(), meta, cacheRevalidate)
+	metrics.PastesServed.Add(1)
+}
+
+// writeUnlockForm asks for the password of a protected paste, or for
+// confirmation before a burn-after-read paste is shown. The form is posted
+// back to the page's URL.
+func writeUnlockForm(w http.ResponseWriter, r *http.Request, meta *backends.Metadata, message string, status int) {
+	key, _ := splitKey(chi.URLParam(r, "key"))
+	writeHTML(w, status, func(w io.Writer) error {
+		return render.WriteUnlockForm(w, &render.UnlockForm{
+			Key:           key,
+			Action:        r.URL.Path,
+			Password:      meta.PasswordHash != "",
+			BurnAfterRead: meta.BurnAfterRead,
+			Error:         message,
+		})
+	})
+}
+
+// writeHTML renders a page that is not derived from a single paste, such as a
+// form. Such pages are never cached, as they may hold passwords or tokens.
+func writeHTML(w http.ResponseWriter, status int, write func(io.Writer) error) {
+	var buf bytes.Buffer
+	if err := write(&buf); err != nil {
+		log.Printf("could not render page: %v", err)
+		http.Error(w, "Error rendering page", http.StatusInternalServerError)
+		return
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Content-Security-Policy", render.CSP)
+	h.Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// authorize checks the password of a paste, sent with HTTP basic
+// authentication (e.g. curl -u :password), and asks for it if it is missing
+// or wrong. Pastes without a password are always authorized.
+func authorize(w http.ResponseWriter, r *http.Request, meta *backends.Metadata) bool {
+	if meta.PasswordHash == "" {
+		return true
+	}
+	if _, password, ok := r.BasicAuth(); ok && passwordMatches(meta, password) {
+		return true
+	}
+	w.Header().Set("WWW-Authenticate", `Basic realm="pasted", charset="UTF-8"`)
+	http.Error(w, "Password required", http.StatusUnauthorized)
+	return false
+}
+
+// hashPassword returns the hash of a paste password, as stored in metadata.
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// passwordMatches reports whether password unlocks the paste.
+func passwordMatches(meta *backends.Metadata, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(meta.PasswordHash), []byte(password)) == nil
+}
+
+// claim deletes a burn-after-read paste before it is served from memory, and
+// returns backends.ErrNotFound if another request deleted it first, so that
+// only one request ever gets the paste. Range and conditional headers are
+// dropped, as a partial or empty response would burn the paste all the same.
+// HEAD requests do not count as reads.
+func (s *webServer) claim(r *http.Request, key string, meta *backends.Metadata) error {
+	if !meta.BurnAfterRead || r.Method == http.MethodHead {
+		return nil
+	}
+	for _, h := range []string{"Range", "If-Range", "If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since"} {
+		r.Header.Del(h)
+	}
+
+	// Backends report a paste that is already deleted, but some cannot tell
+	// when two deletions race, so claims on this server are also serialized.
+	if _, busy := s.burning.LoadOrStore(key, struct{}{}); busy {
+		return backends.ErrNotFound
+	}
+	defer s.burning.Delete(key)
+
+	err := s.deletePaste(key, meta)
+	if err != nil && !errors.Is(err, backends.ErrNotFound) {
+		log.Printf("could not delete burn-after-read paste %s: %v", key, err)
+	}
+	return err
+}
+
+// deletePaste deletes the paste at key, whose metadata is meta, and stops
+// counting it against quotas.
+func (s *webServer) deletePaste(key string, meta *backends.Metadata) error {
+	if err := s.backend.Delete(key); err != nil {
+		return err
+	}
+	releasePaste(s.quotas, meta)
+	return nil
+}
+
+// loadPaste reads the paste at key from the backend and reverses the transform chain.
+func (s *webServer) loadPaste(key string) ([]byte, *backends.Metadata, error) {
+	if !validKey.MatchString(key) {
+		return nil, nil, backends.ErrNotFound
+	}
+
+	meta, err := s.backend.Stat(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if meta.Expired(time.Now()) {
+		if err := s.deletePaste(key, meta); err != nil && !errors.Is(err, backends.ErrNotFound) {
+			log.Printf("could not delete expired paste %s: %v", key, err)
+		}
+		return nil, nil, backends.ErrNotFound
+	}
+	if meta.Hidden {
+		return nil, nil, errHidden
+	}
+
+	body, err := s.readPaste(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return body, meta, nil
+}
+
+// readPaste reads the content of the paste at key and reverses the transform
+// chain, without checking its metadata.
+func (s *webServer) readPaste(key string) ([]byte, error) {
+	var stored bytes.Buffer
+	if err := s.backend.Get(key, &stored); err != nil {
+		return nil, err
+	}
+
+	reversed, err := s.chain.ReverseTransform(&stored)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errTransform, err)
+	}
+	body, err := io.ReadAll(reversed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errTransform, err)
+	}
+	return body, nil
+}
+
+// loadRoutePaste loads the paste at key for a paste route. Pastes in a
+// namespace are only found under its prefix, and other pastes only at the root.
+func (s *webServer) loadRoutePaste(r *http.Request, key string) ([]byte, *backends.Metadata, error) {
+	body, meta, err := s.loadPaste(key)
+	if err == nil && meta.Namespace != chi.URLParam(r, "namespace") {
+		return nil, nil, backends.ErrNotFound
+	}
+	return body, meta, err
+}
+
+// errTransform wraps errors from reversing the transform chain.
+var errTransform = errors.New("could not reverse transforms")
+
+// errHidden is returned for pastes hidden by a moderator.
+var errHidden = errors.New("paste hidden by a moderator")
+
+// writeLoadError reports an error from loadPaste and counts it.
+func writeLoadError(w http.ResponseWriter, key string, err error) {
+	switch {
+	case errors.Is(err, backends.ErrNotFound):
+		http.Error(w, "Paste not found", http.StatusNotFound)
+	case errors.Is(err, errHidden):
+		http.Error(w, "Paste was removed by a moderator", http.StatusGone)
+	case errors.Is(err, transforms.ErrIntegrity):
+		metrics.IntegrityFailures.Add(1)
+		log.Printf("paste %s failed integrity check", key)
+		http.Error(w, "Paste failed integrity check", http.StatusInternalServerError)
+	case errors.Is(err, errTransform):
+		metrics.TransformErrors.Add(1)
+		http.Error(w, "Error retrieving paste", http.StatusInternalServerError)
+	default:
+		metrics.BackendErrors.Add(1)
+		http.Error(w, "Error retrieving paste", http.StatusInternalServerError)
+	}
+}
+
+// contentType returns the type of the paste as it is served.
+func (s *webServer) contentType(body []byte, meta *backends.Metadata) string {
+	switch {
+	case s.chain.StoreOnly():
+		// The body is the stored ciphertext, not the paste that was detected.
+		return content.TypeText
+	case meta.ContentType == "":
+		return content.Detect(body)
+	default:
+		return meta.ContentType
+	}
+}
+
+// isImage reports whether pastes of contentType are served inline as images.
+func isImage(contentType string) bool {
+	resp := content.Safe(contentType)
+	return resp.Inline && strings.HasPrefix(resp.ContentType, "image/")
+}
+
+// isCast reports whether the paste is an asciicast recording.
+func (s *webServer) isCast(ext string, body []byte, meta *backends.Metadata) bool {
+	if s.chain.StoreOnly() {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(s.contentType(body, meta))
+	return mediaType == asciicast.ContentType || ext == "cast"
+}
+
+// writeText writes text generated from a paste as text/plain.
+func writeText(w http.ResponseWriter, r *http.Request, text string, meta *backends.Metadata) {
+	h := w.Header()
+	h.Set("Content-Type", content.TypeText)
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Content-Security-Policy", rawCSP)
+	h.Set("Vary", "Accept")
+	serveContent(w, r, []byte(text), meta, cacheImmutable)
+}
+
+// writeRaw writes the paste body with a safe Content-Type and restrictive headers.
+func (s *webServer) writeRaw(w http.ResponseWriter, r *http.Request, key string, body []byte, meta *backends.Metadata) {
+	resp := content.Safe(s.contentType(body, meta))
+
+	disposition := "attachment"
+	if resp.Inline {
+		disposition = "inline"
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", resp.ContentType)
+	h.Set("Content-Disposition", fmt.Sprintf("%s; filename=%q", disposition, key+resp.Extension))
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Content-Security-Policy", rawCSP)
+	h.Set("Vary", "Accept")
+	serveContent(w, r, body, meta, cacheImmutable)
+}
+
+// Cache-Control values. Pastes never change once stored, so anything derived
+// only from the paste can be cached indefinitely, or until the paste expires.
+const (
+	cacheImmutable  = "public, max-age=31536000, immutable"
+	cacheRevalidate = "no-cache"
+
+	// cacheNever is used for pastes with a password or that are deleted once read.
+	cacheNever = "private, no-store"
+)
+
+// serveContent writes a response body with a strong ETag (a hash of the body)
+// and a Last-Modified time from the paste metadata. Conditional requests are
+// answered with 304 Not Modified, Range requests with the requested bytes,
+// and HEAD requests with the headers only.
+func serveContent(w http.ResponseWriter, r *http.Request, body []byte, meta *backends.Metadata, cacheControl string) {
+	sum := sha256.Sum256(body)
+
+	h := w.Header()
+	switch {
+	case meta.Protected():
+		cacheControl = cacheNever
+	case cacheControl == cacheImmutable && meta.ExpiresAt != nil:
+		cacheControl = fmt.Sprintf("public, max-age=%d", max(int(time.Until(*meta.ExpiresAt).Seconds()), 0))
+	}
+	h.Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	h.Set("Cache-Control", cacheControl)
+	http.ServeContent(w, r, "", meta.CreatedAt, bytes.NewReader(body))
+}
+
+// splitKey splits a key such as "abcde.go" into the key and extension.
+func splitKey(s string) (key, ext string) {
+	key, ext, _ = strings.Cut(s, ".")
+	return key, ext
+}
+
+// wantsHTML reports whether the client prefers an HTML page over raw bytes.
+// Browsers list text/html explicitly; curl and most tools send only */*.
+func wantsHTML(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.TrimSpace(mediaType) != "text/html" {
+			continue
+		}
+		for _, p := range strings.Split(params, ";") {
+			if q, ok := strings.CutPrefix(strings.TrimSpace(p), "q="); ok {
+				v, err := strconv.ParseFloat(q, 64)
+				return err == nil && v > 0
+			}
+		}
+		return true
+	}
+	return false
+}
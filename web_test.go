@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cbrnrd/pasted/pkg/config"
+)
+
+func TestSameOrigin(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		domain  string
+		method  string
+		headers map[string]string
+		allowed bool
+	}{
+		{name: "get from another site", method: http.MethodGet, headers: map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://evil.test"}, allowed: true},
+		{name: "no browser headers", allowed: true},
+		{name: "same origin", headers: map[string]string{"Sec-Fetch-Site": "same-origin"}, allowed: true},
+		{name: "typed by the user", headers: map[string]string{"Sec-Fetch-Site": "none"}, allowed: true},
+		{name: "sibling subdomain", headers: map[string]string{"Sec-Fetch-Site": "same-site", "Origin": "https://evil.pasted.test"}},
+		{name: "cross site", headers: map[string]string{"Sec-Fetch-Site": "cross-site"}},
+		{name: "origin", headers: map[string]string{"Origin": "https://pasted.test"}, allowed: true},
+		{name: "other origin", headers: map[string]string{"Origin": "https://evil.pasted.test"}},
+		{name: "other scheme", headers: map[string]string{"Origin": "http://pasted.test"}},
+		{name: "null origin", headers: map[string]string{"Origin": "null"}},
+		{name: "referer", headers: map[string]string{"Referer": "https://pasted.test/admin/moderation"}, allowed: true},
+		{name: "other referer", headers: map[string]string{"Referer": "https://evil.test/pasted.test"}},
+		{name: "no domain, same host", domain: "-", headers: map[string]string{"Origin": "http://example.com"}, allowed: true},
+		{name: "no domain, other host", domain: "-", headers: map[string]string{"Origin": "http://evil.test"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			domain := "https://pasted.test"
+			if tc.domain == "-" {
+				domain = ""
+			}
+			method := http.MethodPost
+			if tc.method != "" {
+				method = tc.method
+			}
+			s := &webServer{cfg: &config.CLIConfig{Domain: domain}}
+			handler := s.sameOrigin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}))
+
+			r := httptest.NewRequest(method, "/", nil)
+			for k, v := range tc.headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if allowed := w.Code == http.StatusNoContent; allowed != tc.allowed {
+				t.Fatalf("status %d, allowed = %v, want %v", w.Code, allowed, tc.allowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cbrnrd/pasted/pkg/auth"
+	"github.com/cbrnrd/pasted/pkg/backends"
+	"github.com/cbrnrd/pasted/pkg/config"
+	"github.com/cbrnrd/pasted/pkg/metrics"
+	"github.com/cbrnrd/pasted/pkg/render"
+)
+
+// expiryPresets are the lifetimes offered by the form, within the configured maximum.
+var expiryPresets = []struct {
+	lifetime time.Duration
+	label    string
+}{
+	{10 * time.Minute, "10 minutes"},
+	{time.Hour, "1 hour"},
+	{24 * time.Hour, "1 day"},
+	{7 * 24 * time.Hour, "1 week"},
+	{30 * 24 * time.Hour, "30 days"},
+	{365 * 24 * time.Hour, "1 year"},
+}
+
+// maxFormMemory is the part of a posted form, including an uploaded file, held in memory.
+const maxFormMemory = 8 << 20
+
+// maxFormOverheadBytes allows for the other fields and multipart encoding
+// around a paste that is at the size limit.
+const maxFormOverheadBytes = 64 << 10
+
+// handleNew serves the form for creating a paste.
+func (s *webServer) handleNew(w http.ResponseWriter, r *http.Request) {
+	s.writeNewPasteForm(w, r, http.StatusOK, &render.NewPasteForm{})
+}
+
+// handleCreate stores a paste posted from the form and shows its link. The
+// paste is taken from an uploaded file, if one was chosen, or the text area.
+func (s *webServer) handleCreate(w http.ResponseWriter, r *http.Request) {
+	if limit := s.cfg.SizeLimitBytes; limit > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, limit+maxFormOverheadBytes)
+	}
+	if err := r.ParseMultipartForm(maxFormMemory); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			s.writeNewPasteForm(w, r, http.StatusRequestEntityTooLarge, &render.NewPasteForm{Error: "Paste is too large"})
+			return
+		}
+		s.writeNewPasteForm(w, r, http.StatusBadRequest, &render.NewPasteForm{Error: "Invalid form"})
+		return
+	}
+	if r.MultipartForm != nil {
+		defer r.MultipartForm.RemoveAll()
+	}
+
+	// Values are sent back with the form if the paste is rejected. The password is not.
+	form := &render.NewPasteForm{
+		Content:   r.PostFormValue("content"),
+		Language:  r.PostFormValue("language"),
+		ExpiresIn: r.PostFormValue("expires_in"),
+		Namespace: r.PostFormValue("namespace"),
+	}
+	form.BurnAfterRead, _ = strconv.ParseBool(r.PostFormValue("burn_after_read"))
+	fail := func(status int, message string) {
+		form.Error = message
+		s.writeNewPasteForm(w, r, status, form)
+	}
+
+	// Browsers send the text area with CRLF line breaks whatever the platform.
+	var input io.Reader = strings.NewReader(strings.ReplaceAll(form.Content, "\r\n", "\n"))
+	if file, header, err := r.FormFile("file"); err == nil && header.Size > 0 {
+		defer file.Close()
+		input = file
+	} else if strings.TrimSpace(form.Content) == "" {
+		fail(http.StatusBadRequest, "Paste is empty")
+		return
+	}
+
+	expiresAt, err := expiryTime(s.cfg, form.Namespace, form.ExpiresIn)
+	if err != nil {
+		fail(http.StatusBadRequest, "Invalid expiry: "+err.Error())
+		return
+	}
+	deleteToken, deleteTokenHash, err := newDeleteToken()
+	if err != nil {
+		fail(http.StatusInternalServerError, "Could not generate a delete token")
+		return
+	}
+	meta := &backends.Metadata{
+		Language:        form.Language,
+		ExpiresAt:       expiresAt,
+		DeleteTokenHash: deleteTokenHash,
+		BurnAfterRead:   form.BurnAfterRead,
+		Namespace:       form.Namespace,
+		SourceIP:        clientIP(r),
+	}
+	if password := r.PostFormValue("password"); password != "" {
+		if meta.PasswordHash, err = hashPassword(password); err != nil {
+			fail(http.StatusBadRequest, "Invalid password: "+err.Error())
+			return
+		}
+	}
+
+	// Browsers cannot send a bearer token, so the form has a field for the key.
+	apiKey := requestKey(r)
+	if token := r.PostFormValue("api_key"); apiKey == nil && token != "" {
+		if apiKey, err = s.keys.Authenticate(token); err != nil {
+			metrics.AuthFailures.Add(1)
+			fail(http.StatusUnauthorized, "Invalid API key")
+			return
+		}
+	}
+	err = authorizeUpload(s.cfg, s.keys, s.mod, apiKey, clientIP(r), form.Namespace)
+	if err == nil {
+		err = checkProofOfWork(s.work, apiKey, r.PostFormValue("pow"))
+	}
+	if err != nil {
+		countUploadRejection(err)
+		status, _, message := storeErrorStatus(err)
+		fail(status, message)
+		return
+	}
+
+	key, err := storePaste(input, s.cfg, s.backend, s.chain, s.quotas, apiKey, meta)
+	if err != nil {
+		status, _, message := storeErrorStatus(err)
+		fail(status, message)
+		return
+	}
+
+	writeHTML(w, http.StatusCreated, func(w io.Writer) error {
+		return render.WriteCreatedPaste(w, &render.CreatedPaste{
+			Account:       s.account(r),
+			Key:           key,
+			URL:           pasteURL(s.cfg, meta.Namespace, key),
+			ExpiresAt:     meta.ExpiresAt,
+			BurnAfterRead: meta.BurnAfterRead,
+			Password:      meta.PasswordHash != "",
+			DeleteToken:   deleteToken,
+		})
+	})
+}
+
+// writeNewPasteForm writes the form for creating a paste, with the choices
+// allowed by the configuration. Users who logged in do not need an API key.
+func (s *webServer) writeNewPasteForm(w http.ResponseWriter, r *http.Request, status int, form *render.NewPasteForm) {
+	form.Account = s.account(r)
+	form.Languages = render.Languages()
+	form.Expiries = expiryOptions(&s.cfg.Expiry)
+	form.KeyField = s.keys.Enabled() && requestKey(r) == nil
+	form.Namespaces = s.cfg.MemberOf(requestKey(r))
+	form.KeyRequired = s.cfg.Auth.Requires(auth.ScopeWrite)
+	form.ProofOfWork = s.work != nil && requestKey(r) == nil
+	writeHTML(w, status, func(w io.Writer) error {
+		return render.WriteNewPasteForm(w, form)
+	})
+}
+
+// expiryOptions returns the lifetimes offered by forms under the expiry rules
+// in expiry. The first, which is selected by default, is the rules' default.
+func expiryOptions(expiry *config.ExpiryConfig) []render.Option {
+	lifetime, _ := expiry.Lifetime(0)
+	label := "Never"
+	if lifetime > 0 {
+		label = lifetime.String()
+	}
+
+	options := []render.Option{{Value: "", Label: label}}
+	for _, p := range expiryPresets {
+		if max := expiry.Max; max > 0 && p.lifetime > max {
+			break
+		}
+		if p.lifetime == lifetime {
+			options[0].Label = p.label
+			continue
+		}
+		options = append(options, render.Option{Value: p.lifetime.String(), Label: p.label})
+	}
+	return options
+}